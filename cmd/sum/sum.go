@@ -10,6 +10,7 @@ import (
 	logutil "github.com/VeritasOS/plugin-manager/utils/log"
 	"github.com/VeritasOS/software-update-manager/repo"
 	"github.com/VeritasOS/software-update-manager/update"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
 	"github.com/VeritasOS/software-update-manager/validate"
 	"os"
 	"path/filepath"
@@ -24,6 +25,13 @@ var (
 	version = "5.9"
 )
 
+// exitCode returns the exit status for the error of an operation.
+// INFO: The exit statuses of the classes of failures are documented in the
+// 	README, and are stable across the releases.
+func exitCode(err error) int {
+	return errcode.ExitStatus(errcode.Of(err))
+}
+
 func mainRegisterCmdOptions() {
 	mainCmdOptions.versionCmd = flag.NewFlagSet(progname+" version", flag.ContinueOnError)
 	mainCmdOptions.versionPtr = mainCmdOptions.versionCmd.Bool("version", false, "print Plugin Manager version.")
@@ -46,7 +54,7 @@ func main() {
 
 	if len(os.Args) < 2 {
 		fmt.Fprintf(os.Stderr, "Subcommand as operation is required.\n")
-		os.Exit(1)
+		os.Exit(errcode.ExitStatus(errcode.InvalidUsage))
 	}
 
 	cmd := os.Args[1]
@@ -61,12 +69,12 @@ func main() {
 	case "version":
 		logutil.PrintNLog("%s version %s %s\n", progname, version, buildDate)
 
-	case "commit", "install", "reboot", "rollback":
+	case "commit", "history", "install", "postreboot", "reboot", "resume", "rollback", "schedule", "status":
 		library := filepath.Clean(
 			filepath.Dir(absprogpath) + string(os.PathSeparator) + "library")
 		err := update.ScanCommandOptions(map[string]interface{}{"library": library})
 		if nil != err {
-			os.Exit(1)
+			os.Exit(exitCode(err))
 		}
 
 	case "pm":
@@ -83,7 +91,7 @@ func main() {
 		if len(os.Args) < 3 {
 			fmt.Fprintf(os.Stderr, "Subcommand %s requires arguments.\n",
 				cmd)
-			os.Exit(1)
+			os.Exit(errcode.ExitStatus(errcode.InvalidUsage))
 		}
 		options := map[string]interface{}{
 			"progname":  progname + " " + cmd,
@@ -91,7 +99,7 @@ func main() {
 		}
 		err = repo.ScanCommandOptions(options)
 		if err != nil {
-			os.Exit(1)
+			os.Exit(exitCode(err))
 		}
 
 	case "validate":
@@ -109,7 +117,7 @@ func main() {
 
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown subcommand: %s.\n", os.Args[1])
-		os.Exit(1)
+		os.Exit(errcode.ExitStatus(errcode.InvalidUsage))
 	}
 }
 
@@ -127,11 +135,16 @@ Usage:
 The commands are:
 
 	commit		commits the installed software update.
+	history		lists the update operations run on the node.
 	install		installs software update.
 	pm   		perform Plugin Manager (PM) operations.
+	postreboot	runs the post-reboot actions of the software update after restart.
 	reboot		reboots/restarts the node running reboots specific action for installing software update.
 	repo 		perform Software Repository management operations.
+	resume		resumes the interrupted install, commit or rollback of the software update.
 	rollback	rolls back the installed software update.
+	schedule	schedules the install, reboot or commit to run in a maintenance window.
+	status		displays the status of the software update.
 	version		print Software Updates Management (SUM) version.
 
 Use "PROGNAME help [command]" for more information about a command.
@@ -141,7 +154,7 @@ Use "PROGNAME help [command]" for more information about a command.
 	case "version":
 		mainCmdOptions.versionCmd.Usage()
 
-	case "commit", "install", "reboot", "rollback":
+	case "commit", "history", "install", "postreboot", "reboot", "resume", "rollback", "schedule", "status":
 		update.ScanCommandOptions(nil)
 
 	case "pm":
@@ -9,65 +9,277 @@ import (
 	"github.com/VeritasOS/plugin-manager/config"
 	logutil "github.com/VeritasOS/plugin-manager/utils/log"
 	osutils "github.com/VeritasOS/plugin-manager/utils/os"
+	"github.com/VeritasOS/plugin-manager/utils/output"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 )
 
 // Add the software file present in the staging area to the software repo after
-// 	validation.
+// 	validation, and writes the result of the add.
 func Add(rpmPath string, params map[string]string) error {
 	log.Printf("Entering repo::Add(%v, %v)", rpmPath, params)
 	defer log.Println("Exiting repo::Add")
 
+	result, err := add(rpmPath, params)
+	if result != nil {
+		output.Write(result)
+	}
+	return err
+}
+
+// add adds the software file to the software repo. It returns the result of
+// 	the add, when the software is either added or rejected due to conflicts.
+func add(rpmPath string, params map[string]string) (result *AddResult, err error) {
 	productVersion := params["productVersion"]
 	swRepo := params["softwareRepo"]
+	onConflict := params["onConflict"]
+	if onConflict == "" {
+		onConflict = OnConflictReject
+	}
+	if err = validateOnConflict(onConflict); err != nil {
+		return nil, errcode.New(errcode.InvalidUsage, "Invalid usage. %s.", err.Error())
+	}
 
 	fi, err := os.Stat(rpmPath)
-	if err != nil {
-		return logutil.PrintNLogError(
+	if os.IsNotExist(err) {
+		return nil, errcode.New(errcode.SoftwareNotFound,
+			"Unable to stat on %s software. Error: %s\n",
+			rpmPath, err.Error())
+	} else if err != nil {
+		return nil, logutil.PrintNLogError(
 			"Unable to stat on %s software. Error: %s\n",
 			rpmPath, err.Error())
 	} else if fi.IsDir() {
-		return logutil.PrintNLogError(
+		return nil, logutil.PrintNLogError(
 			"%s is not a valid software.\n",
 			rpmPath)
 	}
 
-	info, err := ListRPMFilesInfo([]string{rpmPath}, productVersion)
+	checksum, err := fileChecksum(rpmPath)
 	if err != nil {
-		return err
+		return nil, logutil.PrintNLogError("Failed to compute the checksum of %s software.",
+			rpmPath)
+	}
+	// INFO: The expected checksum is either specified, or read from the
+	// 	checksum file (Ex: a-1.0.0-1.x86_64.rpm.sha256) next to the software.
+	expected := params["checksum"]
+	if expected == "" {
+		if expected, err = readChecksumFile(rpmPath); err != nil {
+			return nil, logutil.PrintNLogError("Failed to read the checksum file of %s software.",
+				rpmPath)
+		}
+	}
+	if expected != "" {
+		if expected, err = parseChecksum(expected); err != nil {
+			return nil, errcode.New(errcode.InvalidUsage, "Invalid usage. %s.", err.Error())
+		}
+		if checksum != expected {
+			return nil, newChecksumError(rpmPath, expected, checksum)
+		}
+	}
+
+	metaData, err := readMetaData(rpmPath)
+	if err != nil {
+		return nil, err
 	}
 
-	// As listing was done for one RPM, the list is expected to have just one RPM.
-	rpmType := info[0].GetRPMType()
+	rpmType := newRPMInfo(rpmPath, metaData, productVersion).GetRPMType()
 	if "" == rpmType {
-		return logutil.PrintNLogError("Failed to determine the software type of the %s file.",
+		return nil, logutil.PrintNLogError("Failed to determine the software type of the %s file.",
 			rpmPath)
 	}
 	rpmType = strings.ToLower(rpmType)
 
 	repoTypeLocation := filepath.FromSlash(swRepo + "/" + rpmType)
 	if err := osutils.OsMkdirAll(repoTypeLocation, 0755); nil != err {
-		return logutil.PrintNLogError("Failed to create the plugins logs directory: %s. "+
+		return nil, logutil.PrintNLogError("Failed to create the plugins logs directory: %s. "+
 			"Error: %s", config.GetPluginsLogDir(), err.Error())
 	}
 
-	const cmdStr = "/usr/bin/mv"
-	cmdParams := []string{"-f", rpmPath, repoTypeLocation}
-	cmd := exec.Command(os.ExpandEnv(cmdStr), cmdParams...)
-	stdOutErr, err := cmd.CombinedOutput()
-	log.Println("Stdout & Stderr:", string(stdOutErr))
-	if err != nil {
-		log.Printf("Failed to move %s RPM to software update repository %s. Error: %s\n",
-			rpmPath, repoTypeLocation, err.Error())
+	swPath := filepath.Join(repoTypeLocation, filepath.Base(rpmPath))
+	result = &AddResult{
+		Type:     rpmType,
+		FileName: filepath.Base(rpmPath),
+		Name:     metaData["Name"],
+		Version:  metaData["Version"],
+		Release:  metaData["Release"],
+		Status:   AddStatusRejected,
+	}
+	result.Conflicts = []Conflict{}
+	// INFO: The software at the same path is a duplicate, which is overwritten
+	// 	only when the conflicts aren't rejected. The software being added from
+	// 	the repository itself doesn't conflict with itself.
+	if existing, err := os.Stat(swPath); err == nil {
+		if onConflict == OnConflictReject && !os.SameFile(existing, fi) {
+			conflict := Conflict{Kind: ConflictDuplicate, Type: rpmType, FileName: result.FileName}
+			if md, err := loadMetaData(loadIndex(swRepo), swPath); err == nil {
+				conflict.Version, conflict.Release = md["Version"], md["Release"]
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+		} else {
+			result.Replaced = append(result.Replaced, rpmType+"/"+result.FileName)
+		}
+	}
+	result.Conflicts = append(result.Conflicts,
+		findConflicts(swRepo, rpmType, swPath, metaData)...)
+	for _, conflict := range result.Conflicts {
+		logutil.PrintNLogWarning("%s software %s conflicts with the %s %s software %s.",
+			rpmType, result.FileName, conflict.Kind, conflict.Type, conflict.FileName)
+	}
+	if len(result.Conflicts) != 0 && onConflict == OnConflictReject {
+		return result, newConflictError(result)
+	}
+	// INFO: The changes made to the repository are undone in the reverse
+	// 	order when the add fails, so that neither a partial software is
+	// 	left in the repository, nor the software it replaces is lost.
+	var undo []func()
+	defer func() {
+		if err != nil {
+			for i := len(undo) - 1; i >= 0; i-- {
+				undo[i]()
+			}
+		}
+	}()
+	addFailed := func() error {
 		return logutil.PrintNLogError("Failed to add %s software to "+
 			"software repository.", rpmPath)
 	}
 
-	return nil
+	tmpPath, err := copyToTempFile(rpmPath, repoTypeLocation)
+	if err != nil {
+		return nil, addFailed()
+	}
+	undo = append(undo, func() { os.Remove(tmpPath) })
+	// The copy is validated, so that a partially written software is not
+	// 	added.
+	if tmpChecksum, err := fileChecksum(tmpPath); err != nil {
+		return nil, addFailed()
+	} else if tmpChecksum != checksum {
+		log.Printf("The checksum %s of the copy %s doesn't match the checksum %s of %s.",
+			tmpChecksum, tmpPath, checksum, rpmPath)
+		return nil, addFailed()
+	}
+
+	stashes := []string{}
+	for _, file := range []string{swPath, swPath + checksumFileSuffix} {
+		stash, err := stashFile(file)
+		if err != nil {
+			return nil, addFailed()
+		}
+		if stash != "" {
+			stashes = append(stashes, stash)
+			file := file
+			undo = append(undo, func() { os.Rename(stash, file) })
+		}
+	}
+
+	if err = os.Rename(tmpPath, swPath); err != nil {
+		log.Printf("os.Rename(%s, %s); Error: %s", tmpPath, swPath, err.Error())
+		return nil, addFailed()
+	}
+	undo = append(undo, func() { os.Remove(swPath) })
+	syncDir(repoTypeLocation)
+
+	if err = writeChecksumFile(swPath, checksum); err != nil {
+		return nil, logutil.PrintNLogError("Failed to record the checksum of %s software.",
+			rpmPath)
+	}
+	undo = append(undo, func() { os.Remove(swPath + checksumFileSuffix) })
+	if err = updateIndex(swRepo, swPath, metaData, checksum); err != nil {
+		return nil, err
+	}
+
+	for _, stash := range stashes {
+		os.Remove(stash)
+	}
+	if onConflict == OnConflictReplace {
+		for _, conflict := range result.Conflicts {
+			path := filepath.Join(filepath.FromSlash(swRepo), conflict.Type, conflict.FileName)
+			if removeSoftware(swRepo, path) == nil {
+				result.Replaced = append(result.Replaced, conflict.Type+"/"+conflict.FileName)
+			}
+		}
+	}
+	result.Status = AddStatusAdded
+
+	// INFO: In copy mode, the software is left in the staging area.
+	srcPath, _ := filepath.Abs(rpmPath)
+	dstPath, _ := filepath.Abs(swPath)
+	if params["copy"] != "true" && srcPath != dstPath {
+		if err := os.Remove(rpmPath); err != nil {
+			log.Printf("os.Remove(%s); Error: %s", rpmPath, err.Error())
+		}
+		os.Remove(rpmPath + checksumFileSuffix)
+	}
+
+	return result, nil
+}
+
+// copyToTempFile copies the file to a temporary file in the specified
+// 	directory, and syncs it to the disk. It returns the path of the
+// 	temporary file.
+// INFO: The temporary file is hidden, and doesn't have the `.rpm` suffix, so
+// 	that it's not listed as a software of the repository.
+func copyToTempFile(file, dir string) (string, error) {
+	log.Printf("Entering repo::copyToTempFile(%s, %s)", file, dir)
+	defer log.Println("Exiting repo::copyToTempFile")
+
+	src, err := os.Open(file)
+	if err != nil {
+		log.Printf("os.Open(%s); Error: %s", file, err.Error())
+		return "", err
+	}
+	defer src.Close()
+
+	tmpFile, err := ioutil.TempFile(dir, "."+filepath.Base(file)+".")
+	if err != nil {
+		log.Printf("ioutil.TempFile(%s); Error: %s", dir, err.Error())
+		return "", err
+	}
+	tmpName := tmpFile.Name()
+	if _, err = io.Copy(tmpFile, src); err == nil {
+		err = tmpFile.Sync()
+	}
+	if cerr := tmpFile.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmpName, 0644)
+	}
+	if err != nil {
+		log.Printf("Failed to copy %s to %s. Error: %s", file, tmpName, err.Error())
+		os.Remove(tmpName)
+		return "", err
+	}
+	return tmpName, nil
+}
+
+// stashFile moves the existing file aside, so that it can be restored when
+// 	the add fails. It returns the path of the stashed file, if the file
+// 	exists.
+func stashFile(file string) (string, error) {
+	if _, err := os.Lstat(file); os.IsNotExist(err) {
+		return "", nil
+	}
+	stash := filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".orig")
+	if err := os.Rename(file, stash); err != nil {
+		log.Printf("os.Rename(%s, %s); Error: %s", file, stash, err.Error())
+		return "", err
+	}
+	return stash, nil
+}
+
+// syncDir syncs the directory, so that the renames in it are persisted.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
 }
 
 //  registerCommandAdd registers the add command that enables one to
@@ -91,6 +303,13 @@ func registerCommandAdd(progname string) {
 		"",
 		"Path of the software.",
 	)
+	cmdOptions.addCmd.StringVar(
+		&cmdOptions.checksum,
+		"sha256",
+		"",
+		"Expected SHA-256 checksum of the software. "+
+			"(Default: read from the ${filepath}.sha256 file, if any)",
+	)
 	cmdOptions.addCmd.StringVar(
 		&cmdOptions.softwareRepo,
 		"repo",
@@ -98,16 +317,19 @@ func registerCommandAdd(progname string) {
 		"Path of the software repository.",
 	)
 	cmdOptions.addCmd.StringVar(
-		&cmdOptions.outputFile,
-		"output-file",
-		"",
-		"Name of the file to write the results.",
+		&cmdOptions.onConflict,
+		"on-conflict",
+		OnConflictReject,
+		"Action to take when the software conflicts with a software in the "+
+			"repository. Supported actions are 'reject', 'replace', 'keep-both'.",
 	)
-	cmdOptions.addCmd.StringVar(
-		&cmdOptions.outputFormat,
-		"output-format",
-		"yaml",
-		"The format of output to display the results. "+
-			"Supported output formats are 'json', 'yaml'.",
+	output.RegisterCommandOptions(cmdOptions.addCmd,
+		map[string]string{"output-format": "yaml"})
+	cmdOptions.addCmd.BoolVar(
+		&cmdOptions.copy,
+		"copy",
+		false,
+		"Copy the software to repository, leaving it in the staging area.",
 	)
+	registerWaitOption(cmdOptions.addCmd)
 }
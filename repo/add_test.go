@@ -0,0 +1,89 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+// Package repo defines software repository functions like listing, removing
+// 	packages from software repository.
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "repo-add")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	defer func(f func(string) ([]byte, error)) { getRPMPackageInfo = f }(getRPMPackageInfo)
+	queries := 0
+	getRPMPackageInfo = fakeRPMPackageInfo(&queries)
+
+	swRepo := filepath.Join(tmpDir, "repository")
+	staged := filepath.Join(tmpDir, "a-1.0.0-1.x86_64.rpm")
+	added := filepath.Join(swRepo, "update", "a-1.0.0-1.x86_64.rpm")
+	readFile := func(file string) string {
+		data, _ := ioutil.ReadFile(file)
+		return string(data)
+	}
+	// repoFiles returns the files in the type directory of the repository,
+	// 	including the hidden ones.
+	repoFiles := func() []string {
+		files, _ := filepath.Glob(filepath.Join(swRepo, "update", "*"))
+		hidden, _ := filepath.Glob(filepath.Join(swRepo, "update", ".*"))
+		return append(files, hidden...)
+	}
+
+	// In copy mode, the software is left in the staging area.
+	ioutil.WriteFile(staged, []byte("a"), 0644)
+	if err = Add(staged, map[string]string{"softwareRepo": swRepo, "copy": "true"}); err != nil {
+		t.Fatalf("Add(copy) error = %v", err)
+	}
+	if readFile(staged) != "a" || readFile(added) != "a" {
+		t.Errorf("Add(copy) staged = %q, added = %q, want both \"a\"",
+			readFile(staged), readFile(added))
+	}
+	if files := repoFiles(); len(files) != 2 {
+		t.Errorf("Add(copy) repository files = %v, want the software and its checksum", files)
+	}
+
+	// When the index can't be updated, the add is undone, and the software
+	// 	it replaces is restored.
+	ioutil.WriteFile(staged, []byte("b"), 0644)
+	os.Remove(getIndexPath(swRepo))
+	os.Mkdir(getIndexPath(swRepo), 0755)
+	replace := map[string]string{"softwareRepo": swRepo, "onConflict": OnConflictReplace}
+	if err = Add(staged, replace); err == nil {
+		t.Fatalf("Add(index failure) error = nil, want error")
+	}
+	if readFile(staged) != "b" || readFile(added) != "a" {
+		t.Errorf("Add(index failure) staged = %q, added = %q, want \"b\", \"a\"",
+			readFile(staged), readFile(added))
+	}
+	if err = VerifyChecksum(added, false); err != nil {
+		t.Errorf("Add(index failure) didn't restore the checksum. Error: %v", err)
+	}
+	if files := repoFiles(); len(files) != 2 {
+		t.Errorf("Add(index failure) repository files = %v, want the software and its checksum", files)
+	}
+
+	// Otherwise, the software is moved from the staging area.
+	os.Remove(getIndexPath(swRepo))
+	if err = Add(staged, replace); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err = os.Stat(staged); !os.IsNotExist(err) || readFile(added) != "b" {
+		t.Errorf("Add() left the staged software, or added %q, want \"b\"", readFile(added))
+	}
+	if err = VerifyChecksum(added, false); err != nil {
+		t.Errorf("VerifyChecksum() error = %v", err)
+	}
+
+	// Adding the software already in the repository keeps it.
+	if err = Add(added, map[string]string{"softwareRepo": swRepo}); err != nil ||
+		readFile(added) != "b" {
+		t.Errorf("Add(in repository) = %v, added = %q, want \"b\"", err, readFile(added))
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+// Package repo defines software repository functions like listing, removing
+// 	packages from software repository.
+package repo
+
+import (
+	"fmt"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Actions to take when the software being added conflicts with the software
+// 	in the repository.
+const (
+	// OnConflictReject rejects the software being added.
+	OnConflictReject = "reject"
+	// OnConflictReplace removes the conflicting software from the repository.
+	OnConflictReplace = "replace"
+	// OnConflictKeepBoth adds the software next to the conflicting software.
+	OnConflictKeepBoth = "keep-both"
+)
+
+// Kinds of conflicts of the software being added.
+const (
+	// ConflictDuplicate is a software of the same type, and of the same
+	// 	Name-Version-Release or at the same path.
+	ConflictDuplicate = "duplicate"
+	// ConflictNewer is a software of the same name and type, but of a newer
+	// 	Version-Release.
+	ConflictNewer = "newer"
+)
+
+// Statuses of the software being added.
+const (
+	AddStatusAdded    = "added"
+	AddStatusRejected = "rejected"
+)
+
+// Conflict is a software in the repository that conflicts with the software
+// 	being added.
+type Conflict struct {
+	Kind     string
+	Type     string
+	FileName string
+	Version  string
+	Release  string
+}
+
+// AddResult is the result of adding a software to the repository.
+type AddResult struct {
+	Type     string
+	FileName string
+	Name     string
+	Version  string
+	Release  string
+	Status   string
+	// Conflicts are the conflicting software in the repository, and Replaced
+	// 	are the software (Ex: update/a-1.0.0-1.x86_64.rpm) that were replaced
+	// 	by the added software.
+	Conflicts []Conflict `yaml:",omitempty" json:",omitempty"`
+	Replaced  []string   `yaml:",omitempty" json:",omitempty"`
+}
+
+// ConflictError is returned when the software being added is rejected as it
+// 	conflicts with the software in the repository.
+type ConflictError struct {
+	Result *AddResult
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("Rejected %s software %s as it conflicts with %d "+
+		"software in repository.", e.Result.Type, e.Result.FileName,
+		len(e.Result.Conflicts))
+}
+
+// ErrorCode returns the class of the failure.
+func (e *ConflictError) ErrorCode() errcode.Code {
+	return errcode.SoftwareConflict
+}
+
+// newConflictError prints and logs the rejection of the software, and
+// 	returns the error.
+func newConflictError(result *AddResult) error {
+	err := &ConflictError{Result: result}
+	logutil.PrintNLogError("%s", err.Error())
+	return err
+}
+
+// validateOnConflict validates the action to take on conflicts.
+func validateOnConflict(onConflict string) error {
+	switch onConflict {
+	case OnConflictReject, OnConflictReplace, OnConflictKeepBoth:
+		return nil
+	}
+	return fmt.Errorf("invalid -on-conflict %q, expected one of %s, %s, %s",
+		onConflict, OnConflictReject, OnConflictReplace, OnConflictKeepBoth)
+}
+
+// findConflicts returns the software in the repository that conflicts with
+// 	the software of the specified type and metadata being added as the
+// 	specified file. The software of the same name, type, version and
+// 	release is a duplicate, and the software of the same name and type, but
+// 	of a newer version or release conflicts as the software being added is
+// 	older.
+// INFO: The software at the same path is handled by the add.
+func findConflicts(swRepo, swType, swPath string, metaData map[string]string) []Conflict {
+	log.Printf("Entering repo::findConflicts(%s, %s, %s)", swRepo, swType, swPath)
+	defer log.Println("Exiting repo::findConflicts")
+
+	conflicts := []Conflict{}
+	if metaData["Name"] == "" {
+		return conflicts
+	}
+	files, err := listRepo(map[string]string{"softwareRepo": swRepo})
+	if err != nil {
+		return conflicts
+	}
+	idx := loadIndex(swRepo)
+	for _, file := range files {
+		if filepath.Clean(file) == filepath.Clean(swPath) {
+			continue
+		}
+		existing, err := loadMetaData(idx, file)
+		if err != nil {
+			log.Printf("Skipping %s as its details couldn't be read.", file)
+			continue
+		}
+		if existing["Name"] != metaData["Name"] {
+			continue
+		}
+		conflict := Conflict{
+			Type:     filepath.Base(filepath.Dir(file)),
+			FileName: filepath.Base(file),
+			Version:  existing["Version"],
+			Release:  existing["Release"],
+		}
+		cmp := compareVersions(existing["Version"], metaData["Version"])
+		if cmp == 0 {
+			cmp = compareVersions(existing["Release"], metaData["Release"])
+		}
+		switch {
+		case cmp == 0 && conflict.Type == swType:
+			conflict.Kind = ConflictDuplicate
+		case cmp > 0 && conflict.Type == swType:
+			conflict.Kind = ConflictNewer
+		default:
+			continue
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts
+}
+
+// removeSoftware removes the software along with its checksum file from the
+// 	repository, and from its index.
+func removeSoftware(swRepo, path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("os.Remove(%s); Error: %s", path, err.Error())
+		return logutil.PrintNLogWarning("Failed to remove %s software %s.",
+			filepath.Base(filepath.Dir(path)), filepath.Base(path))
+	}
+	os.Remove(path + checksumFileSuffix)
+	pruneIndex(swRepo, path)
+	return nil
+}
+
+// compareVersions compares the versions (or releases) the same way as rpm
+// 	does. It returns 1 if v1 is newer, -1 if v2 is newer, and 0 if they're
+// 	the same.
+// INFO: The versions are compared segment by segment, where a segment is a
+// 	run of digits or of letters. The numeric segments are compared as numbers,
+// 	and are newer than the alphabetic ones. A version with more segments is
+// 	newer, except that a `~` sorts before everything.
+func compareVersions(v1, v2 string) int {
+	if v1 == v2 {
+		return 0
+	}
+	isSep := func(r rune) bool {
+		return !unicode.IsDigit(r) && !unicode.IsLetter(r) && r != '~'
+	}
+	for {
+		v1 = strings.TrimLeftFunc(v1, isSep)
+		v2 = strings.TrimLeftFunc(v2, isSep)
+		if strings.HasPrefix(v1, "~") || strings.HasPrefix(v2, "~") {
+			if !strings.HasPrefix(v1, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(v2, "~") {
+				return -1
+			}
+			v1, v2 = v1[1:], v2[1:]
+			continue
+		}
+		if v1 == "" || v2 == "" {
+			break
+		}
+
+		var seg1, seg2 string
+		numeric := unicode.IsDigit(rune(v1[0]))
+		seg1, v1 = splitSegment(v1, numeric)
+		seg2, v2 = splitSegment(v2, numeric)
+		if seg2 == "" {
+			// A numeric segment is newer than an alphabetic one.
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		if numeric {
+			seg1 = strings.TrimLeft(seg1, "0")
+			seg2 = strings.TrimLeft(seg2, "0")
+			if len(seg1) != len(seg2) {
+				if len(seg1) > len(seg2) {
+					return 1
+				}
+				return -1
+			}
+		}
+		if c := strings.Compare(seg1, seg2); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case v1 == "" && v2 == "":
+		return 0
+	case v1 == "":
+		return -1
+	}
+	return 1
+}
+
+// splitSegment splits the leading run of digits (if numeric) or of letters
+// 	from the version.
+func splitSegment(v string, numeric bool) (string, string) {
+	i := strings.IndexFunc(v, func(r rune) bool {
+		if numeric {
+			return !unicode.IsDigit(r)
+		}
+		return !unicode.IsLetter(r)
+	})
+	if i < 0 {
+		return v, ""
+	}
+	return v[:i], v[i:]
+}
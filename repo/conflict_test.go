@@ -0,0 +1,146 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+// Package repo defines software repository functions like listing, removing
+// 	packages from software repository.
+package repo
+
+import (
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func Test_compareVersions(t *testing.T) {
+	tests := []struct {
+		v1, v2 string
+		want   int
+	}{
+		{v1: "1.0.0", v2: "1.0.0", want: 0},
+		{v1: "1.0.10", v2: "1.0.9", want: 1},
+		{v1: "1.0", v2: "1.0.1", want: -1},
+		{v1: "1.01", v2: "1.1", want: 0},
+		{v1: "2.el7", v2: "2.el8", want: -1},
+		{v1: "1.0a", v2: "1.0", want: 1},
+		{v1: "1.0.1", v2: "1.0a", want: 1},
+		{v1: "1.0~rc1", v2: "1.0", want: -1},
+		{v1: "1.0~rc2", v2: "1.0~rc1", want: 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.v1, tt.v2); got != tt.want {
+			t.Errorf("compareVersions(%s, %s) = %d, want %d", tt.v1, tt.v2, got, tt.want)
+		}
+		if got := compareVersions(tt.v2, tt.v1); got != -tt.want {
+			t.Errorf("compareVersions(%s, %s) = %d, want %d", tt.v2, tt.v1, got, -tt.want)
+		}
+	}
+}
+
+func TestAdd_onConflict(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "repo-conflict")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	// The metadata of the software is its contents.
+	defer func(f func(string) ([]byte, error)) { getRPMPackageInfo = f }(getRPMPackageInfo)
+	getRPMPackageInfo = ioutil.ReadFile
+
+	swRepo := filepath.Join(tmpDir, "repository")
+	stage := func(name, version, release string) string {
+		path := filepath.Join(tmpDir, name)
+		ioutil.WriteFile(path, []byte("Name        : a\n"+
+			"Version     : "+version+"\n"+
+			"Release     : "+release+"\n"+
+			"Type        : Update\n"), 0644)
+		return path
+	}
+	repoFiles := func() []string {
+		files, _ := filepath.Glob(filepath.Join(swRepo, "update", "*.rpm"))
+		for i := range files {
+			files[i] = filepath.Base(files[i])
+		}
+		sort.Strings(files)
+		return files
+	}
+	params := func(onConflict string) map[string]string {
+		return map[string]string{"softwareRepo": swRepo, "onConflict": onConflict}
+	}
+
+	if _, err = add(stage("a-1.0.0-2.x86_64.rpm", "1.0.0", "2"), params("")); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+
+	// A duplicate is rejected by default.
+	dup := stage("a-copy.rpm", "1.0.0", "2")
+	result, err := add(dup, params(""))
+	if code := errcode.Of(err); code != errcode.SoftwareConflict {
+		t.Fatalf("add(duplicate) code = %s, want %s", code, errcode.SoftwareConflict)
+	}
+	if result.Status != AddStatusRejected || len(result.Conflicts) != 1 ||
+		result.Conflicts[0].Kind != ConflictDuplicate ||
+		result.Conflicts[0].FileName != "a-1.0.0-2.x86_64.rpm" {
+		t.Errorf("add(duplicate) = %+v", result)
+	}
+	if _, err = os.Stat(dup); err != nil {
+		t.Errorf("add(duplicate) removed the rejected software. Error: %v", err)
+	}
+
+	// The software at the same path is a duplicate, which is not overwritten.
+	same := stage("a-1.0.0-2.x86_64.rpm", "1.0.0", "3")
+	result, err = add(same, params(""))
+	if errcode.Of(err) != errcode.SoftwareConflict || len(result.Conflicts) != 1 ||
+		result.Conflicts[0].Kind != ConflictDuplicate || result.Conflicts[0].Release != "2" ||
+		len(result.Replaced) != 0 {
+		t.Errorf("add(same path) = %+v, %v", result, err)
+	}
+	if md, _ := readMetaData(filepath.Join(swRepo, "update", "a-1.0.0-2.x86_64.rpm")); md["Release"] != "2" {
+		t.Errorf("add(same path) overwrote the software in the repository")
+	}
+	os.Remove(same)
+
+	// The software of another type doesn't conflict.
+	hotfix := filepath.Join(tmpDir, "a-hotfix.rpm")
+	ioutil.WriteFile(hotfix, []byte("Name        : a\nVersion     : 1.0.0\n"+
+		"Release     : 2\nType        : Hotfix\n"), 0644)
+	result, err = add(hotfix, params(""))
+	if err != nil || result.Status != AddStatusAdded || len(result.Conflicts) != 0 {
+		t.Errorf("add(other type) = %+v, %v", result, err)
+	}
+
+	// An older release is kept next to the newer one when asked to.
+	result, err = add(stage("a-1.0.0-1.x86_64.rpm", "1.0.0", "1"), params(OnConflictKeepBoth))
+	if err != nil || result.Status != AddStatusAdded || len(result.Conflicts) != 1 ||
+		result.Conflicts[0].Kind != ConflictNewer {
+		t.Errorf("add(older) = %+v, %v", result, err)
+	}
+	if files := repoFiles(); len(files) != 2 {
+		t.Errorf("add(older) repository = %v, want both releases", files)
+	}
+
+	// A newer release doesn't conflict.
+	result, err = add(stage("a-1.0.1-1.x86_64.rpm", "1.0.1", "1"), params(""))
+	if err != nil || result.Status != AddStatusAdded || len(result.Conflicts) != 0 {
+		t.Errorf("add(newer) = %+v, %v", result, err)
+	}
+
+	// The conflicting software is replaced when asked to.
+	result, err = add(stage("a-0.9.0-1.x86_64.rpm", "0.9.0", "1"), params(OnConflictReplace))
+	if err != nil || result.Status != AddStatusAdded || len(result.Conflicts) != 3 ||
+		len(result.Replaced) != 3 {
+		t.Errorf("add(replace) = %+v, %v", result, err)
+	}
+	if files := repoFiles(); len(files) != 1 || files[0] != "a-0.9.0-1.x86_64.rpm" {
+		t.Errorf("add(replace) repository = %v, want only the added software", files)
+	}
+	if idx := loadIndex(swRepo); len(idx.Packages) != 2 {
+		t.Errorf("add(replace) index = %+v, want only the added software and the hotfix",
+			idx.Packages)
+	}
+
+	if _, err = add(dup, params("overwrite")); errcode.Of(err) != errcode.InvalidUsage {
+		t.Errorf("add(overwrite) error = %v, want invalid usage", err)
+	}
+}
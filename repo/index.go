@@ -0,0 +1,343 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+// Package repo defines software repository functions like listing, removing
+// 	packages from software repository.
+package repo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/software-update-manager/utils/fsutil"
+	"github.com/VeritasOS/software-update-manager/utils/lock"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// indexFileName is the file in the software repository that holds the
+// 	metadata of the packages, so that listing the repository doesn't have
+// 	to query each of the packages.
+const indexFileName = ".index.yaml"
+
+// indexVersion is the format version of the repository index.
+const indexVersion = 1
+
+// repoIndex is the metadata index of the software repository.
+type repoIndex struct {
+	Version int
+	// Packages are the indexed packages, keyed by their path relative to
+	// 	the repository (Ex: update/a-1.0.0-1.x86_64.rpm).
+	Packages map[string]indexEntry
+
+	// swRepo is the path of the software repository of the index.
+	swRepo string
+}
+
+// indexEntry is the metadata of a package in the repository index.
+type indexEntry struct {
+	Size     int64
+	ModTime  time.Time `yaml:"mod-time"`
+	Checksum string
+	// MetaData is the parsed RPM metadata of the package, from which its
+	// 	RPMInfo is derived for the product version being listed.
+	MetaData map[string]string `yaml:"meta-data"`
+}
+
+func getIndexPath(swRepo string) string {
+	return filepath.Join(filepath.FromSlash(swRepo), indexFileName)
+}
+
+// loadIndex loads the index of the software repository. An index that is
+// 	missing or can't be read is treated as empty, so that the packages are
+// 	queried instead.
+func loadIndex(swRepo string) *repoIndex {
+	log.Printf("Entering repo::loadIndex(%s)", swRepo)
+	defer log.Println("Exiting repo::loadIndex")
+
+	idx := &repoIndex{Version: indexVersion, Packages: map[string]indexEntry{}, swRepo: swRepo}
+	path := getIndexPath(swRepo)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("ioutil.ReadFile(%s); Error: %s", path, err.Error())
+		}
+		return idx
+	}
+	loaded := repoIndex{}
+	if err = yaml.Unmarshal(data, &loaded); err != nil {
+		log.Printf("yaml.Unmarshal(%s); Error: %s", path, err.Error())
+		return idx
+	}
+	if loaded.Version != indexVersion {
+		log.Printf("Ignoring the index %s of version %d.", path, loaded.Version)
+		return idx
+	}
+	for key, entry := range loaded.Packages {
+		idx.Packages[key] = entry
+	}
+	return idx
+}
+
+// save writes the index to the software repository atomically.
+func (idx *repoIndex) save() error {
+	log.Printf("Entering repo::repoIndex::save(%s)", idx.swRepo)
+	defer log.Println("Exiting repo::repoIndex::save")
+
+	// INFO: The index is not written when the repository itself was removed.
+	if _, err := os.Stat(filepath.FromSlash(idx.swRepo)); os.IsNotExist(err) {
+		return nil
+	}
+	data, err := yaml.Marshal(idx)
+	if err != nil {
+		log.Printf("yaml.Marshal(%+v); Error: %s", idx, err.Error())
+		return err
+	}
+	return fsutil.WriteFileAtomic(getIndexPath(idx.swRepo), data, 0644)
+}
+
+// key returns the key of the file in the index i.e., the path of the file
+// 	relative to the repository.
+func (idx *repoIndex) key(file string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(idx.swRepo), file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// lookup returns the indexed metadata of the file, if the file hasn't
+// 	changed since it was indexed.
+func (idx *repoIndex) lookup(file string) (map[string]string, bool) {
+	if idx == nil {
+		return nil, false
+	}
+	key := idx.key(file)
+	entry, ok := idx.Packages[key]
+	if key == "" || !ok {
+		log.Printf("%s is not indexed.", file)
+		return nil, false
+	}
+	fi, err := os.Stat(file)
+	if err != nil || fi.Size() != entry.Size || !fi.ModTime().Equal(entry.ModTime) {
+		log.Printf("%s has changed since it was indexed.", file)
+		return nil, false
+	}
+	return entry.MetaData, true
+}
+
+// loadMetaData returns the metadata of the file from the index, or by
+// 	querying it when the file is not indexed.
+func loadMetaData(idx *repoIndex, file string) (map[string]string, error) {
+	if metaData, ok := idx.lookup(file); ok {
+		return metaData, nil
+	}
+	return readMetaData(file)
+}
+
+// update indexes the file with the specified metadata and checksum. The
+// 	checksum of the file is computed, if it's not specified.
+func (idx *repoIndex) update(file string, metaData map[string]string, checksum string) error {
+	log.Printf("Entering repo::repoIndex::update(%s)", file)
+	defer log.Println("Exiting repo::repoIndex::update")
+
+	if checksum == "" {
+		var err error
+		if checksum, err = fileChecksum(file); err != nil {
+			return err
+		}
+	}
+	return idx.put(file, metaData, checksum)
+}
+
+// put indexes the file with the specified metadata and checksum.
+func (idx *repoIndex) put(file string, metaData map[string]string, checksum string) error {
+	key := idx.key(file)
+	if key == "" {
+		log.Printf("%s is not in the %s repository.", file, idx.swRepo)
+		return nil
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		log.Printf("os.Stat(%s); Error: %s", file, err.Error())
+		return err
+	}
+	idx.Packages[key] = indexEntry{
+		Size:     fi.Size(),
+		ModTime:  fi.ModTime(),
+		Checksum: checksum,
+		MetaData: metaData,
+	}
+	return nil
+}
+
+// updateQueried indexes the file whose metadata was queried as it wasn't
+// 	indexed (Ex: copied into the repository without `add`, or changed since
+// 	it was indexed), so that it isn't queried again. The checksum is taken
+// 	from its checksum file, if any.
+// INFO: The checksum of the file isn't computed, as the file isn't known to
+// 	be intact, and the indexed checksum is used to verify the software.
+func (idx *repoIndex) updateQueried(file string, metaData map[string]string) error {
+	checksum, err := readChecksumFile(file)
+	if err != nil {
+		checksum = ""
+	}
+	return idx.put(file, metaData, checksum)
+}
+
+// saveQueried indexes the queried files with their metadata, and writes the
+// 	index. The index is written only when no other operation holds the
+// 	lock, and is reloaded under the lock, so that the changes made by a
+// 	concurrent add or remove are not overwritten.
+// INFO: The index is only a cache of the metadata, so failing to write it
+// 	just gets the packages queried again by the next list.
+func (idx *repoIndex) saveQueried(queried map[string]map[string]string) {
+	log.Printf("Entering repo::repoIndex::saveQueried(%s)", idx.swRepo)
+	defer log.Println("Exiting repo::repoIndex::saveQueried")
+
+	l, err := lock.Acquire("repo list", 0)
+	if err != nil {
+		log.Printf("Skipping indexing the queried packages. Error: %s", err.Error())
+		return
+	}
+	defer l.Release()
+
+	cur := loadIndex(idx.swRepo)
+	indexed := false
+	for file, metaData := range queried {
+		if _, ok := cur.lookup(file); ok {
+			// INFO: Indexed by a concurrent add.
+			continue
+		}
+		if err = cur.updateQueried(file, metaData); err != nil {
+			log.Printf("Unable to index %s. Error: %s", file, err.Error())
+			continue
+		}
+		indexed = true
+	}
+	if !indexed {
+		return
+	}
+	if err = cur.save(); err != nil {
+		log.Printf("Unable to index the queried packages. Error: %s", err.Error())
+		return
+	}
+	*idx = *cur
+}
+
+// checksum returns the indexed checksum of the file, if any.
+func (idx *repoIndex) checksum(file string) string {
+	return idx.Packages[idx.key(file)].Checksum
+}
+
+// prune removes the entries of the files under the specified path of the
+// 	repository from the index.
+func (idx *repoIndex) prune(path string) {
+	key := idx.key(path)
+	for k := range idx.Packages {
+		if key == "." || k == key || strings.HasPrefix(k, key+"/") {
+			delete(idx.Packages, k)
+		}
+	}
+}
+
+// fileChecksum returns the SHA-256 checksum of the file.
+func fileChecksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		log.Printf("os.Open(%s); Error: %s", file, err.Error())
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		log.Printf("Failed to read %s file. Error: %s", file, err.Error())
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// updateIndex indexes the file added to the software repository.
+func updateIndex(swRepo, file string, metaData map[string]string, checksum string) error {
+	idx := loadIndex(swRepo)
+	err := idx.update(file, metaData, checksum)
+	if err == nil {
+		err = idx.save()
+	}
+	if err != nil {
+		return logutil.PrintNLogError("Failed to update the index of the " +
+			"software repository.")
+	}
+	return nil
+}
+
+// pruneIndex removes the path removed from the software repository from
+// 	the index.
+// INFO: The index is only a cache of the metadata of the packages, so a
+// 	failure to update it doesn't fail the removal; the packages that
+// 	aren't indexed are queried when listed.
+func pruneIndex(swRepo, path string) {
+	idx := loadIndex(swRepo)
+	idx.prune(path)
+	if err := idx.save(); err != nil {
+		logutil.PrintNLogWarning("Failed to update the index of the software " +
+			"repository. Run `reindex` to rebuild it.")
+	}
+}
+
+// Reindex rebuilds the index of the software repository from the packages
+// 	present in the repository.
+func Reindex(swRepo string) error {
+	log.Printf("Entering repo::Reindex(%s)", swRepo)
+	defer log.Println("Exiting repo::Reindex")
+
+	if swRepo == "" {
+		return logutil.PrintNLogError("Unable to reindex. " +
+			"Failed to determine software repository.")
+	}
+	files, err := listRepo(map[string]string{"softwareRepo": swRepo})
+	if err != nil {
+		return err
+	}
+
+	idx := &repoIndex{Version: indexVersion, Packages: map[string]indexEntry{}, swRepo: swRepo}
+	for _, file := range files {
+		metaData, err := readMetaData(file)
+		if err != nil {
+			logutil.PrintNLogWarning("Skipping %s as its details couldn't be read.", file)
+			continue
+		}
+		if err = idx.update(file, metaData, ""); err != nil {
+			logutil.PrintNLogWarning("Skipping %s as it couldn't be indexed.", file)
+		}
+	}
+	if err = idx.save(); err != nil {
+		return logutil.PrintNLogError("Failed to write the index of the software repository.")
+	}
+
+	logutil.PrintNLog("Indexed %d software in repository.\n", len(idx.Packages))
+	return nil
+}
+
+// registerCommandReindex registers the reindex command that enables one to
+// 	rebuild the metadata index of the software repository.
+func registerCommandReindex(progname string) {
+	log.Printf("Entering repo::registerCommandReindex(%s)", progname)
+	defer log.Println("Exiting repo::registerCommandReindex")
+
+	cmdOptions.reindexCmd = flag.NewFlagSet(progname+" reindex", flag.PanicOnError)
+	cmdOptions.reindexCmd.StringVar(
+		&cmdOptions.softwareRepo,
+		"repo",
+		SoftwareRepoPath,
+		"Path of the software repository.",
+	)
+	registerWaitOption(cmdOptions.reindexCmd)
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+// Package repo defines software repository functions like listing, removing
+// 	packages from software repository.
+package repo
+
+import (
+	"errors"
+	"github.com/VeritasOS/software-update-manager/utils/lock"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeRPMPackageInfo returns the metadata of the RPM files from their name,
+// 	and counts the queries.
+func fakeRPMPackageInfo(queries *int) func(string) ([]byte, error) {
+	return func(rpmPath string) ([]byte, error) {
+		*queries++
+		if _, err := os.Stat(rpmPath); err != nil {
+			return nil, errors.New("not an rpm")
+		}
+		return []byte("Name        : " + filepath.Base(rpmPath) + "\n" +
+			"Version     : 1.0.0\n" +
+			"Type        : Update\n"), nil
+	}
+}
+
+func TestIndex(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "repo-index")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	defer func(f func(string) ([]byte, error)) { getRPMPackageInfo = f }(getRPMPackageInfo)
+	queries := 0
+	getRPMPackageInfo = fakeRPMPackageInfo(&queries)
+	lock.SetLockFile(filepath.Join(tmpDir, "sum.lock"))
+	defer lock.SetLockFile(lock.DefaultLockFile)
+
+	swRepo := filepath.Join(tmpDir, "repository") + string(os.PathSeparator)
+	staged := filepath.Join(tmpDir, "a-1.0.0-1.x86_64.rpm")
+	ioutil.WriteFile(staged, []byte("a"), 0644)
+	os.MkdirAll(filepath.Join(swRepo, "update"), 0755)
+	other := filepath.Join(swRepo, "update", "b-1.0.0-1.x86_64.rpm")
+	ioutil.WriteFile(other, []byte("b"), 0644)
+
+	if err = Add(staged, map[string]string{"softwareRepo": swRepo}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	added := filepath.Join(swRepo, "update", "a-1.0.0-1.x86_64.rpm")
+	idx := loadIndex(swRepo)
+	entry, ok := idx.Packages["update/a-1.0.0-1.x86_64.rpm"]
+	if !ok || len(idx.Packages) != 1 || entry.Size != 1 || entry.Checksum == "" ||
+		entry.MetaData["Type"] != "Update" {
+		t.Fatalf("Add() index = %+v", idx.Packages)
+	}
+
+	// The indexed package isn't queried, while the one added without `add`
+	// 	is, and gets indexed.
+	queries = 0
+	info, err := List(map[string]string{"softwareRepo": swRepo})
+	if err != nil || len(info) != 2 || queries != 1 {
+		t.Errorf("List() = %v, %v with %d queries, want 2 packages with 1 query",
+			info, err, queries)
+	}
+	idx = loadIndex(swRepo)
+	if entry, ok = idx.Packages["update/b-1.0.0-1.x86_64.rpm"]; !ok ||
+		entry.Size != 1 || entry.Checksum != "" || entry.MetaData["Type"] != "Update" {
+		t.Errorf("List() index = %+v, want the queried package indexed without a checksum",
+			idx.Packages)
+	}
+	queries = 0
+	if info, err = List(map[string]string{"softwareRepo": swRepo}); err != nil ||
+		len(info) != 2 || queries != 0 {
+		t.Errorf("List() again = %v, %v with %d queries, want 2 packages with no query",
+			info, err, queries)
+	}
+
+	if err = Reindex(swRepo); err != nil {
+		t.Fatalf("Reindex() error = %v", err)
+	}
+	queries = 0
+	if info, err = List(map[string]string{"softwareRepo": swRepo}); err != nil ||
+		len(info) != 2 || queries != 0 {
+		t.Errorf("List() after Reindex() = %v, %v with %d queries, want 2 packages with no query",
+			info, err, queries)
+	}
+
+	// A package changed since it was indexed is queried, and indexed again.
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(other, later, later)
+	queries = 0
+	if info, err = List(map[string]string{"softwareRepo": swRepo}); err != nil ||
+		len(info) != 2 || queries != 1 {
+		t.Errorf("List() after change = %v, %v with %d queries, want 2 packages with 1 query",
+			info, err, queries)
+	}
+	queries = 0
+	if info, err = List(map[string]string{"softwareRepo": swRepo}); err != nil ||
+		len(info) != 2 || queries != 0 {
+		t.Errorf("List() after reindexing the change = %v, %v with %d queries, want no query",
+			info, err, queries)
+	}
+
+	if err = Remove("a-1.0.0-1.x86_64.rpm", "update", swRepo); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	idx = loadIndex(swRepo)
+	if _, ok = idx.Packages["update/a-1.0.0-1.x86_64.rpm"]; ok || len(idx.Packages) != 1 {
+		t.Errorf("Remove() index = %+v, want only the other package", idx.Packages)
+	}
+	if _, err = os.Stat(added); !os.IsNotExist(err) {
+		t.Errorf("Remove() left %s", added)
+	}
+
+	if err = Remove("", "update", swRepo); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if idx = loadIndex(swRepo); len(idx.Packages) != 0 {
+		t.Errorf("Remove() index = %+v, want none", idx.Packages)
+	}
+}
+
+func TestIndex_saveQueried(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "repo-index")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	defer func(f func(string) ([]byte, error)) { getRPMPackageInfo = f }(getRPMPackageInfo)
+	queries := 0
+	getRPMPackageInfo = fakeRPMPackageInfo(&queries)
+	lockFile := filepath.Join(tmpDir, "sum.lock")
+	lock.SetLockFile(lockFile)
+	defer lock.SetLockFile(lock.DefaultLockFile)
+
+	swRepo := filepath.Join(tmpDir, "repository")
+	staged := filepath.Join(tmpDir, "a-1.0.0-1.x86_64.rpm")
+	ioutil.WriteFile(staged, []byte("a"), 0644)
+	if err = Add(staged, map[string]string{"softwareRepo": swRepo}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	other := filepath.Join(swRepo, "update", "b-1.0.0-1.x86_64.rpm")
+	ioutil.WriteFile(other, []byte("b"), 0644)
+
+	// The index isn't written while another operation holds the lock.
+	f, err := os.OpenFile(lockFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatalf("os.OpenFile(%s) error = %v", lockFile, err)
+	}
+	syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	if _, err = List(map[string]string{"softwareRepo": swRepo}); err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	f.Close()
+	if _, ok := loadIndex(swRepo).Packages["update/b-1.0.0-1.x86_64.rpm"]; ok {
+		t.Errorf("List() indexed the queried package while the lock is held")
+	}
+
+	// The removal after the index was loaded by list isn't undone.
+	idx := loadIndex(swRepo)
+	metaData, _ := readMetaData(other)
+	if err = Remove("a-1.0.0-1.x86_64.rpm", "update", swRepo); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	idx.saveQueried(map[string]map[string]string{other: metaData})
+	idx = loadIndex(swRepo)
+	if _, ok := idx.Packages["update/a-1.0.0-1.x86_64.rpm"]; ok {
+		t.Errorf("saveQueried() index = %+v, want the removed package not indexed", idx.Packages)
+	}
+	if _, ok := idx.Packages["update/b-1.0.0-1.x86_64.rpm"]; !ok {
+		t.Errorf("saveQueried() index = %+v, want the queried package indexed", idx.Packages)
+	}
+}
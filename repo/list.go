@@ -15,12 +15,16 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
+// getRPMPackageInfo queries the metadata of the RPM file.
+var getRPMPackageInfo = rpm.GetRPMPackageInfo
+
 // FormatVersionName is the RPM format version string that's embedded
 // 	into RPM used for identifying the JSON format version.
 const FormatVersionName = "RPM Format Version"
@@ -28,12 +32,49 @@ const FormatVersionName = "RPM Format Version"
 // RPMInfo is the list of RPM package info
 type RPMInfo interface {
 	GetMatchedVersion() string
+	GetOperationInfo(operation string) OperationInfo
+	GetPreflightChecks() PreflightChecks
 	GetRPMName() string
 	GetRPMRelease() string
 	GetRPMType() string
 	GetRPMVersion() string
 }
 
+// OperationInfo is the details of an operation (i.e., install, rollback or
+// 	commit) of the software for the matched product-version.
+type OperationInfo struct {
+	ConfirmationMessage []string `yaml:"confirmation-message,omitempty"`
+	EstimatedMinutes    uint     `yaml:"estimated-minutes,omitempty"`
+	RequiresRestart     bool     `yaml:"requires-restart,omitempty"`
+	SupportsRollback    bool     `yaml:"supports-rollback,omitempty"`
+}
+
+// PreflightChecks are the checks of the system that must pass before the
+// 	software is installed.
+type PreflightChecks struct {
+	// FreeSpace is the minimum free space required on the mount points.
+	FreeSpace []FreeSpaceCheck `yaml:"free-space,omitempty"`
+	// MinimumMemoryMB is the minimum RAM of the node.
+	MinimumMemoryMB uint64 `yaml:"minimum-memory-mb,omitempty"`
+	// KernelRelease & OSRelease are the supported releases (with '*'
+	// 	patterns) of the kernel and the OS, any of which must match.
+	KernelRelease []string `yaml:"kernel-release,omitempty"`
+	OSRelease     []string `yaml:"os-release,omitempty"`
+	// RunningServices & StoppedServices are the systemd services that must
+	// 	be running and stopped respectively.
+	RunningServices []string `yaml:"running-services,omitempty"`
+	StoppedServices []string `yaml:"stopped-services,omitempty"`
+	// NoPendingUpdate requires the earlier update to be committed or
+	// 	rolled back.
+	NoPendingUpdate bool `yaml:"no-pending-update,omitempty"`
+}
+
+// FreeSpaceCheck is the minimum free space required on a mount point.
+type FreeSpaceCheck struct {
+	MountPoint string `yaml:"mount-point"`
+	MinimumMB  uint64 `yaml:"minimum-mb"`
+}
+
 // Version 2 RPM Information related fields & helper functions below:
 
 // v2productVersion is the details for a given product-version from the
@@ -72,6 +113,7 @@ type v2RPMInfo struct {
 	// 	so commenting for now.
 	// BuildDate   time.Time
 
+	Preflight        PreflightChecks `yaml:",omitempty"`
 	matchedVersion   string
 	v2productVersion `yaml:",inline"`
 }
@@ -102,6 +144,33 @@ func (v2 v2RPMInfo) GetMatchedVersion() string {
 	return v2.matchedVersion
 }
 
+// GetOperationInfo returns the details of the specified operation for the
+// 	matched product-version.
+func (v2 v2RPMInfo) GetOperationInfo(operation string) OperationInfo {
+	info := OperationInfo{}
+	switch operation {
+	case "install":
+		info.ConfirmationMessage = v2.Install.ConfirmationMessage
+		info.EstimatedMinutes = v2.Install.EstimatedMinutes
+		info.RequiresRestart = v2.Install.RequiresRestart
+		info.SupportsRollback = v2.Install.SupportsRollback
+	case "rollback":
+		info.ConfirmationMessage = v2.Rollback.ConfirmationMessage
+		info.EstimatedMinutes = v2.Rollback.EstimatedMinutes
+		info.RequiresRestart = v2.Rollback.RequiresRestart
+	case "commit":
+		info.ConfirmationMessage = v2.Commit.ConfirmationMessage
+		info.EstimatedMinutes = v2.Commit.EstimatedMinutes
+	}
+	return info
+}
+
+// GetPreflightChecks returns the checks to be run before installing the
+// 	software.
+func (v2 v2RPMInfo) GetPreflightChecks() PreflightChecks {
+	return v2.Preflight
+}
+
 // Version 1 RPM Information related fields & helper functions below:
 
 // v1RPMInfo is the list of RPM package info
@@ -150,6 +219,32 @@ func (v1 v1RPMInfo) GetMatchedVersion() string {
 	return v1.matchedVersion
 }
 
+// GetOperationInfo returns the details of the specified operation for the
+// 	matched product-version.
+// NOTE: v1 has the reboot & estimate details only for install.
+func (v1 v1RPMInfo) GetOperationInfo(operation string) OperationInfo {
+	info := OperationInfo{}
+	if "install" != operation {
+		return info
+	}
+	info.RequiresRestart = strings.EqualFold(v1.Reboot, "yes")
+	hours, _ := strconv.Atoi(v1.Estimate.Hours)
+	minutes, _ := strconv.Atoi(v1.Estimate.Minutes)
+	seconds, _ := strconv.Atoi(v1.Estimate.Seconds)
+	// Round up the seconds to the next minute.
+	if total := hours*60*60 + minutes*60 + seconds; total > 0 {
+		info.EstimatedMinutes = uint((total + 59) / 60)
+	}
+	return info
+}
+
+// GetPreflightChecks returns the checks to be run before installing the
+// 	software.
+// NOTE: v1 doesn't support the preflight checks.
+func (v1 v1RPMInfo) GetPreflightChecks() PreflightChecks {
+	return PreflightChecks{}
+}
+
 func parseDate(rawDate string) (time.Time, error) {
 	const dateLayout = "Mon 02 Jan 2006 03:04:05 PM MST"
 	t, err := time.Parse(dateLayout, rawDate)
@@ -178,7 +273,8 @@ func List(params map[string]string) ([]RPMInfo, error) {
 		return info, err
 	}
 
-	info, err = ListRPMFilesInfo(files, productVersion)
+	info, err = listRPMFilesInfo(files, productVersion,
+		loadIndex(params["softwareRepo"]))
 	if err != nil {
 		return info, err
 	}
@@ -266,105 +362,133 @@ func listRepo(params map[string]string) ([]string, error) {
 
 // ListRPMFilesInfo lists the info of the RPM files.
 func ListRPMFilesInfo(files []string, productVersion string) ([]RPMInfo, error) {
-	log.Printf("Entering repo::ListRPMFilesInfo(%v, %v)", files, productVersion)
-	defer log.Println("Exiting repo::ListRPMFilesInfo")
+	return listRPMFilesInfo(files, productVersion, nil)
+}
+
+// listRPMFilesInfo lists the info of the RPM files, using the metadata in
+// 	the repository index for the files that haven't changed since they were
+// 	indexed.
+func listRPMFilesInfo(files []string, productVersion string, idx *repoIndex) ([]RPMInfo, error) {
+	log.Printf("Entering repo::listRPMFilesInfo(%v, %v)", files, productVersion)
+	defer log.Println("Exiting repo::listRPMFilesInfo")
 
 	var info []RPMInfo
+	queried := map[string]map[string]string{}
 	for _, file := range files {
-		metaData, err := rpm.GetRPMPackageInfo(filepath.FromSlash(file))
-		if err != nil {
-			return info, logutil.PrintNLogError("Failed to get software details.")
-		}
-		parsedData := rpm.ParseMetaData(string(metaData))
-
-		if _, ok := parsedData[FormatVersionName]; !ok {
-			listData := v1RPMInfo{
-				Description: parsedData["Description"],
-				FileName:    filepath.Base(file),
-				Name:        filepath.Base(file),
-				Summary:     parsedData["Summary"],
-				Type:        parsedData["Type"],
-				URL:         parsedData["URL"],
-				Version:     parsedData["Version"],
-				Reboot:      "n/a",
-			}
-			listData.Estimate.Hours = "0"
-			listData.Estimate.Minutes = "0"
-			listData.Estimate.Seconds = "0"
-			if "" != productVersion {
-				versionInfo, err := version.GetCompatibileVersionInfo(productVersion, parsedData["VersionInfo"])
-				//In case of error, i.e the version of rpm and product version is not compatible we ignore error and contiune execution
-				//This error is expected when the rpm is already applied. List API should still return rpm details
-				if err != nil {
-					log.Printf("Error in GetCompatibileVersionInfo::(%s)...",
-						err)
-				}
-				listData.matchedVersion = versionInfo.Version
-				listData.Reboot = versionInfo.Reboot
-				listData.Estimate.Hours = versionInfo.Estimate.Hours
-				listData.Estimate.Minutes = versionInfo.Estimate.Minutes
-				listData.Estimate.Seconds = versionInfo.Estimate.Seconds
+		parsedData, ok := idx.lookup(file)
+		if !ok {
+			var err error
+			if parsedData, err = readMetaData(file); err != nil {
+				return info, err
 			}
+			queried[file] = parsedData
+		}
+		info = append(info, newRPMInfo(file, parsedData, productVersion))
+	}
+	if idx != nil && len(queried) != 0 {
+		idx.saveQueried(queried)
+	}
 
-			info = append(info, listData)
-		} else {
-			log.Printf("%s: %v", FormatVersionName, parsedData[FormatVersionName])
+	return info, nil
+}
 
-			listData := v2RPMInfo{
-				FileName: filepath.Base(file),
-				Name:     parsedData["Name"],
-				Version:  parsedData["Version"],
-				Release:  parsedData["Release"],
-				URL:      parsedData["URL"],
-			}
-			rpmInfo := parsedData["RPM Info"]
-			err := yaml.Unmarshal([]byte(rpmInfo), &listData)
+// readMetaData queries and parses the metadata of the RPM file.
+func readMetaData(file string) (map[string]string, error) {
+	metaData, err := getRPMPackageInfo(filepath.FromSlash(file))
+	if err != nil {
+		return nil, logutil.PrintNLogError("Failed to get software details.")
+	}
+	return rpm.ParseMetaData(string(metaData)), nil
+}
+
+// newRPMInfo returns the info of the RPM file from its metadata, with the
+// 	details of the operations for the specified product version.
+func newRPMInfo(file string, parsedData map[string]string, productVersion string) RPMInfo {
+	if _, ok := parsedData[FormatVersionName]; !ok {
+		listData := v1RPMInfo{
+			Description: parsedData["Description"],
+			FileName:    filepath.Base(file),
+			Name:        filepath.Base(file),
+			Summary:     parsedData["Summary"],
+			Type:        parsedData["Type"],
+			URL:         parsedData["URL"],
+			Version:     parsedData["Version"],
+			Reboot:      "n/a",
+		}
+		listData.Estimate.Hours = "0"
+		listData.Estimate.Minutes = "0"
+		listData.Estimate.Seconds = "0"
+		if "" != productVersion {
+			versionInfo, err := version.GetCompatibileVersionInfo(productVersion, parsedData["VersionInfo"])
+			//In case of error, i.e the version of rpm and product version is not compatible we ignore error and contiune execution
+			//This error is expected when the rpm is already applied. List API should still return rpm details
 			if err != nil {
-				log.Printf("yaml.Unmarshal(%s, %+v); Error: %s",
-					rpmInfo, &listData, err.Error())
+				log.Printf("Error in GetCompatibileVersionInfo::(%s)...",
+					err)
 			}
-			t, err := parseDate(parsedData["Build Date"])
+			listData.matchedVersion = versionInfo.Version
+			listData.Reboot = versionInfo.Reboot
+			listData.Estimate.Hours = versionInfo.Estimate.Hours
+			listData.Estimate.Minutes = versionInfo.Estimate.Minutes
+			listData.Estimate.Seconds = versionInfo.Estimate.Seconds
+		}
+
+		return listData
+	} else {
+		log.Printf("%s: %v", FormatVersionName, parsedData[FormatVersionName])
+
+		listData := v2RPMInfo{
+			FileName: filepath.Base(file),
+			Name:     parsedData["Name"],
+			Version:  parsedData["Version"],
+			Release:  parsedData["Release"],
+			URL:      parsedData["URL"],
+		}
+		rpmInfo := parsedData["RPM Info"]
+		err := yaml.Unmarshal([]byte(rpmInfo), &listData)
+		if err != nil {
+			log.Printf("yaml.Unmarshal(%s, %+v); Error: %s",
+				rpmInfo, &listData, err.Error())
+		}
+		t, err := parseDate(parsedData["Build Date"])
+		if err != nil {
+			log.Printf("Build date: %+v\n", t)
+			// listData.BuildDate = t
+		}
+		if "" != productVersion {
+			allVersionsInfo := struct {
+				VersionInfo []struct {
+					Version          string `yaml:"product-version"`
+					v2productVersion `yaml:",inline"`
+				} `yaml:"compatibility-info"`
+			}{}
+
+			err := yaml.Unmarshal([]byte(rpmInfo), &allVersionsInfo)
 			if err != nil {
-				log.Printf("Build date: %+v\n", t)
-				// listData.BuildDate = t
+				log.Printf("yaml.Unmarshal(%s, %+v); Error: %s",
+					rpmInfo, &allVersionsInfo, err.Error())
 			}
-			if "" != productVersion {
-				allVersionsInfo := struct {
-					VersionInfo []struct {
-						Version          string `yaml:"product-version"`
-						v2productVersion `yaml:",inline"`
-					} `yaml:"compatibility-info"`
-				}{}
-
-				err := yaml.Unmarshal([]byte(rpmInfo), &allVersionsInfo)
-				if err != nil {
-					log.Printf("yaml.Unmarshal(%s, %+v); Error: %s",
-						rpmInfo, &allVersionsInfo, err.Error())
-				}
 
-				// INFO: First check Version as-is,
-				// 	if there is no match, then do pattern comparison.
+			// INFO: First check Version as-is,
+			// 	if there is no match, then do pattern comparison.
+			for _, vInfo := range allVersionsInfo.VersionInfo {
+				if productVersion == vInfo.Version {
+					listData.v2productVersion = vInfo.v2productVersion
+					listData.matchedVersion = vInfo.Version
+				}
+			}
+			if listData.matchedVersion == "" {
 				for _, vInfo := range allVersionsInfo.VersionInfo {
-					if productVersion == vInfo.Version {
+					if version.Compare(productVersion, vInfo.Version) {
 						listData.v2productVersion = vInfo.v2productVersion
 						listData.matchedVersion = vInfo.Version
 					}
 				}
-				if listData.matchedVersion == "" {
-					for _, vInfo := range allVersionsInfo.VersionInfo {
-						if version.Compare(productVersion, vInfo.Version) {
-							listData.v2productVersion = vInfo.v2productVersion
-							listData.matchedVersion = vInfo.Version
-						}
-					}
-				}
 			}
-
-			info = append(info, listData)
 		}
-	}
 
-	return info, nil
+		return listData
+	}
 }
 
 //  registerCommandList registers the list command that enables one to
@@ -77,3 +77,61 @@ func Test_parseDate(t *testing.T) {
 		})
 	}
 }
+
+func TestRPMInfo_GetOperationInfo(t *testing.T) {
+	v1 := v1RPMInfo{Reboot: "Yes"}
+	v1.Estimate.Hours = "1"
+	v1.Estimate.Minutes = "20"
+	v1.Estimate.Seconds = "15"
+	v2 := v2RPMInfo{}
+	v2.Install.EstimatedMinutes = 35
+	v2.Install.RequiresRestart = true
+	v2.Rollback.EstimatedMinutes = 20
+	v2.Rollback.RequiresRestart = true
+	v2.Commit.EstimatedMinutes = 5
+
+	tests := []struct {
+		name      string
+		info      RPMInfo
+		operation string
+		want      OperationInfo
+	}{
+		{
+			name:      "V1 install",
+			info:      v1,
+			operation: "install",
+			want:      OperationInfo{EstimatedMinutes: 81, RequiresRestart: true},
+		},
+		{
+			name:      "V1 rollback",
+			info:      v1,
+			operation: "rollback",
+			want:      OperationInfo{},
+		},
+		{
+			name:      "V2 install",
+			info:      v2,
+			operation: "install",
+			want:      OperationInfo{EstimatedMinutes: 35, RequiresRestart: true},
+		},
+		{
+			name:      "V2 rollback",
+			info:      v2,
+			operation: "rollback",
+			want:      OperationInfo{EstimatedMinutes: 20, RequiresRestart: true},
+		},
+		{
+			name:      "V2 commit",
+			info:      v2,
+			operation: "commit",
+			want:      OperationInfo{EstimatedMinutes: 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.GetOperationInfo(tt.operation); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetOperationInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+// Package repo defines software repository functions like listing, removing
+// 	packages from software repository.
+package repo
+
+import (
+	"flag"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/plugin-manager/utils/output"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy is the policy of the software type that decides which of
+// 	its software are kept in the repository. The software that is either
+// 	among the newest KeepNewest software of its name, or that was added in
+// 	the last KeepDays days is kept. When neither is specified, all the
+// 	software are kept.
+type RetentionPolicy struct {
+	KeepNewest uint `yaml:"keep-newest,omitempty"`
+	KeepDays   uint `yaml:"keep-days,omitempty"`
+}
+
+// RetentionSource returns the retention policies of the software types, and
+// 	the software that must never be pruned (Ex: update/a-1.0.0-1.x86_64.rpm)
+// 	i.e., the currently installed software and the rollback target.
+type RetentionSource func() (map[string]RetentionPolicy, []string, error)
+
+// retentionSource is the source of the retention policies used by prune.
+var retentionSource RetentionSource = func() (map[string]RetentionPolicy, []string, error) {
+	return nil, nil, nil
+}
+
+// SetRetentionSource sets the source of the retention policies used by the
+// 	prune command.
+// INFO: The policies are part of the SUM configuration, and the software to
+// 	keep is known from the state of the update, both of which are managed
+// 	by the update package.
+func SetRetentionSource(source RetentionSource) {
+	retentionSource = source
+}
+
+// PrunedSoftware is a software removed by the prune.
+type PrunedSoftware struct {
+	Type     string
+	FileName string
+	Version  string
+	Release  string
+	Size     int64
+	Added    time.Time
+
+	// inUse tells whether the software must not be removed, though it's
+	// 	counted among the newest software of its name.
+	inUse bool
+}
+
+// PruneResult is the result of pruning the software repository.
+type PruneResult struct {
+	DryRun     bool
+	Removed    []PrunedSoftware
+	FreedBytes int64
+}
+
+// Prune removes the software that's not retained by the retention policy of
+// 	its type from the software repository, except for the software to keep.
+// 	When dryRun is set, the software that would be removed is only listed.
+func Prune(swRepo string, policies map[string]RetentionPolicy, keep []string,
+	dryRun bool, now time.Time) (PruneResult, error) {
+	log.Printf("Entering repo::Prune(%s, %+v, %v, %v)", swRepo, policies, keep, dryRun)
+	defer log.Println("Exiting repo::Prune")
+
+	result := PruneResult{DryRun: dryRun, Removed: []PrunedSoftware{}}
+	if swRepo == "" {
+		return result, logutil.PrintNLogError("Unable to prune. " +
+			"Failed to determine software repository.")
+	}
+	keepSet := map[string]bool{}
+	for _, k := range keep {
+		keepSet[strings.ToLower(filepath.ToSlash(k))] = true
+	}
+
+	files, err := listRepo(map[string]string{"softwareRepo": swRepo})
+	if err != nil {
+		return result, err
+	}
+	// The software of each type is grouped by its name, so that the newest
+	// 	software is decided among the versions of the same software.
+	idx := loadIndex(swRepo)
+	groups := map[string][]PrunedSoftware{}
+	for _, file := range files {
+		swType := filepath.Base(filepath.Dir(file))
+		policy, ok := policies[swType]
+		if !ok || (policy.KeepNewest == 0 && policy.KeepDays == 0) {
+			continue
+		}
+		fi, err := os.Stat(file)
+		if err != nil {
+			log.Printf("os.Stat(%s); Error: %s", file, err.Error())
+			continue
+		}
+		metaData, err := loadMetaData(idx, file)
+		if err != nil {
+			log.Printf("Skipping %s as its details couldn't be read.", file)
+			continue
+		}
+		key := swType + "/" + metaData["Name"]
+		groups[key] = append(groups[key], PrunedSoftware{
+			Type:     swType,
+			FileName: filepath.Base(file),
+			Version:  metaData["Version"],
+			Release:  metaData["Release"],
+			Size:     fi.Size(),
+			Added:    fi.ModTime(),
+			inUse:    keepSet[strings.ToLower(swType+"/"+filepath.Base(file))],
+		})
+	}
+
+	keys := []string{}
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		group := groups[key]
+		policy := policies[group[0].Type]
+		// Newest first.
+		sort.SliceStable(group, func(i, j int) bool {
+			cmp := compareVersions(group[i].Version, group[j].Version)
+			if cmp == 0 {
+				cmp = compareVersions(group[i].Release, group[j].Release)
+			}
+			if cmp == 0 {
+				return group[i].Added.After(group[j].Added)
+			}
+			return cmp > 0
+		})
+		for i, sw := range group {
+			if policy.KeepNewest != 0 && uint(i) < policy.KeepNewest {
+				continue
+			}
+			// INFO: The software in use counts among the newest software of
+			// 	its name, but is never removed.
+			if sw.inUse {
+				log.Printf("Keeping %s software %s as it's in use.", sw.Type, sw.FileName)
+				continue
+			}
+			if policy.KeepDays != 0 &&
+				now.Sub(sw.Added) < time.Duration(policy.KeepDays)*24*time.Hour {
+				continue
+			}
+			if !dryRun {
+				path := filepath.Join(filepath.FromSlash(swRepo), sw.Type, sw.FileName)
+				if removeSoftware(swRepo, path) != nil {
+					continue
+				}
+				logutil.PrintNLog("Removed %s software %s from repository.\n",
+					sw.Type, sw.FileName)
+			}
+			result.Removed = append(result.Removed, sw)
+			result.FreedBytes += sw.Size
+		}
+	}
+	return result, nil
+}
+
+// runPruneCommand prunes the software repository using the policies of the
+// 	retention source, and writes the result.
+func runPruneCommand(swRepo string, dryRun bool) error {
+	log.Printf("Entering repo::runPruneCommand(%s, %v)", swRepo, dryRun)
+	defer log.Println("Exiting repo::runPruneCommand")
+
+	policies, keep, err := retentionSource()
+	if err != nil {
+		return err
+	}
+	result, err := Prune(swRepo, policies, keep, dryRun, time.Now())
+	if err != nil {
+		return err
+	}
+	output.Write(result)
+	action := "Removed"
+	if dryRun {
+		action = "Would remove"
+	}
+	logutil.PrintNLog("%s %d software from repository, freeing %.1f MiB.\n",
+		action, len(result.Removed), float64(result.FreedBytes)/(1<<20))
+	return nil
+}
+
+// registerCommandPrune registers the prune command that enables one to
+// 	remove the software that's not retained by the retention policies from
+// 	the software update repository.
+func registerCommandPrune(progname string) {
+	log.Printf("Entering repo::registerCommandPrune(%s)", progname)
+	defer log.Println("Exiting repo::registerCommandPrune")
+
+	cmdOptions.pruneCmd = flag.NewFlagSet(progname+" prune", flag.PanicOnError)
+	cmdOptions.pruneCmd.StringVar(
+		&cmdOptions.softwareRepo,
+		"repo",
+		SoftwareRepoPath,
+		"Path of the software repository.",
+	)
+	cmdOptions.pruneCmd.BoolVar(
+		&cmdOptions.dryRun,
+		"dry-run",
+		false,
+		"List the software that would be removed, without removing it.",
+	)
+	output.RegisterCommandOptions(cmdOptions.pruneCmd,
+		map[string]string{"output-format": "yaml"})
+	registerWaitOption(cmdOptions.pruneCmd)
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+// Package repo defines software repository functions like listing, removing
+// 	packages from software repository.
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "repo-prune")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	// The metadata of the software is its contents.
+	defer func(f func(string) ([]byte, error)) { getRPMPackageInfo = f }(getRPMPackageInfo)
+	getRPMPackageInfo = ioutil.ReadFile
+
+	now := time.Now()
+	swRepo := filepath.Join(tmpDir, "repository")
+	// put adds the software to the repository, as if it were added the
+	// 	specified days ago.
+	put := func(swType, name, version string, days int) {
+		path := filepath.Join(swRepo, swType, name+"-"+version+"-1.x86_64.rpm")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte("Name        : "+name+"\n"+
+			"Version     : "+version+"\n"+
+			"Release     : 1\n"), 0644)
+		writeChecksumFile(path, checksumA)
+		added := now.Add(-time.Duration(days) * 24 * time.Hour)
+		os.Chtimes(path, added, added)
+	}
+	put("update", "a", "1.0.0", 40)
+	put("update", "a", "1.1.0", 30)
+	put("update", "a", "1.2.0", 20)
+	put("update", "a", "1.10.0", 1)
+	put("update", "b", "1.0.0", 40)
+	put("hotfix", "c", "1.0.0", 40)
+	put("hotfix", "c", "2.0.0", 40)
+	repoFiles := func() []string {
+		files, _ := filepath.Glob(filepath.Join(swRepo, "*", "*"))
+		for i := range files {
+			files[i], _ = filepath.Rel(swRepo, files[i])
+		}
+		sort.Strings(files)
+		return files
+	}
+	before := repoFiles()
+
+	policies := map[string]RetentionPolicy{
+		// Keep the newest two software of each name, and the software added
+		// 	in the last 25 days.
+		"update": {KeepNewest: 2, KeepDays: 25},
+		"hotfix": {KeepNewest: 1},
+	}
+	// The installed software and the rollback target are never pruned, but
+	// 	count among the newest software of their name.
+	keep := []string{"update/a-1.10.0-1.x86_64.rpm", "update/a-1.0.0-1.x86_64.rpm"}
+	want := []string{"update/a-1.1.0-1.x86_64.rpm", "hotfix/c-1.0.0-1.x86_64.rpm"}
+
+	result, err := Prune(swRepo, policies, keep, true, now)
+	if err != nil || !result.DryRun || len(result.Removed) != len(want) {
+		t.Fatalf("Prune(dry run) = %+v, %v, want %v removed", result, err, want)
+	}
+	wantFreed := int64(0)
+	for _, w := range want {
+		fi, _ := os.Stat(filepath.Join(swRepo, w))
+		wantFreed += fi.Size()
+	}
+	if result.FreedBytes != wantFreed {
+		t.Errorf("Prune(dry run) freed %d bytes, want %d", result.FreedBytes, wantFreed)
+	}
+	if files := repoFiles(); len(files) != len(before) {
+		t.Errorf("Prune(dry run) removed software. Got %v, want %v", files, before)
+	}
+
+	result, err = Prune(swRepo, policies, keep, false, now)
+	if err != nil || len(result.Removed) != len(want) {
+		t.Fatalf("Prune() = %+v, %v, want %v removed", result, err, want)
+	}
+	removed := map[string]bool{}
+	for _, sw := range result.Removed {
+		removed[sw.Type+"/"+sw.FileName] = true
+	}
+	for _, w := range want {
+		if !removed[w] {
+			t.Errorf("Prune() removed = %+v, want %v", result.Removed, want)
+		}
+		if _, err = os.Stat(filepath.Join(swRepo, w)); !os.IsNotExist(err) {
+			t.Errorf("Prune() left %s", w)
+		}
+		if _, err = os.Stat(filepath.Join(swRepo, w) + checksumFileSuffix); !os.IsNotExist(err) {
+			t.Errorf("Prune() left the checksum file of %s", w)
+		}
+	}
+	if result.FreedBytes != wantFreed {
+		t.Errorf("Prune() freed %d bytes, want %d", result.FreedBytes, wantFreed)
+	}
+
+	// The types without a policy are not pruned.
+	if result, err = Prune(swRepo, nil, nil, false, now); err != nil || len(result.Removed) != 0 {
+		t.Errorf("Prune(no policy) = %+v, %v, want none removed", result, err)
+	}
+}
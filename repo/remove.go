@@ -8,6 +8,7 @@ import (
 	"flag"
 	logutil "github.com/VeritasOS/plugin-manager/utils/log"
 	osutils "github.com/VeritasOS/plugin-manager/utils/os"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
 	"log"
 	"os"
 	"path/filepath"
@@ -39,6 +40,7 @@ func registerCommandRemove(progname string) {
 		"",
 		"File name of the software.",
 	)
+	registerWaitOption(cmdOptions.removeCmd)
 }
 
 // Remove the specified software package from the software repo.
@@ -52,7 +54,7 @@ func Remove(swName, swType, swRepo string) error {
 			swType, swName)
 	}
 	if swName != "" && swType == "" {
-		return logutil.PrintNLogError("Invalid usage. Software type must be specified when software name is specified.")
+		return errcode.New(errcode.InvalidUsage, "Invalid usage. Software type must be specified when software name is specified.")
 	}
 
 	absSwPath := filepath.Clean(filepath.FromSlash(swRepo +
@@ -63,9 +65,7 @@ func Remove(swName, swType, swRepo string) error {
 	if err != nil {
 		log.Printf("Unable to stat on %s: %+v. Error: %s\n",
 			absSwPath, fi, err.Error())
-		return logutil.PrintNLogError("Unable to remove %s software %s. "+
-			"Specified software not found.",
-			swType, swName)
+		return NewNotFoundError("remove", swName, swType)
 	}
 
 	err = osutils.OsRemoveAll(absSwPath)
@@ -76,6 +76,11 @@ func Remove(swName, swType, swRepo string) error {
 			swType, swName)
 	}
 
+	if !fi.IsDir() {
+		os.Remove(absSwPath + checksumFileSuffix)
+	}
+	pruneIndex(swRepo, absSwPath)
+
 	log.Printf("Successfully removed %s software", absSwPath)
 	logutil.PrintNLog("Successfully removed %s software %s from repository.\n",
 		swType, swName)
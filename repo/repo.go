@@ -8,10 +8,14 @@ import (
 	"flag"
 	"fmt"
 	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"github.com/VeritasOS/software-update-manager/utils/lock"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // SoftwareRepoPath is the Software Update Repository path.
@@ -26,10 +30,28 @@ const (
 var cmdOptions struct {
 	addCmd     *flag.FlagSet
 	listCmd    *flag.FlagSet
+	pruneCmd   *flag.FlagSet
+	reindexCmd *flag.FlagSet
 	removeCmd  *flag.FlagSet
+	verifyCmd  *flag.FlagSet
 	versionCmd *flag.FlagSet
 	versionPtr *bool
 
+	// checksum indicates the expected SHA-256 checksum of the software.
+	checksum string
+
+	// onConflict indicates the action to take when the software being added
+	// 	conflicts with a software in the repository.
+	onConflict string
+
+	// dryRun indicates whether to only list the software that would be
+	// 	pruned.
+	dryRun bool
+
+	// copy indicates whether to copy the software to the repository,
+	// 	instead of moving it.
+	copy bool
+
 	// productVersion indicates the version (i.e., product version) that a
 	//  software should be applicable for.
 	productVersion string
@@ -48,6 +70,9 @@ var cmdOptions struct {
 	// softwareType indicates the type of the software.
 	softwareType string
 
+	// wait indicates how long to wait for another operation to complete.
+	wait time.Duration
+
 	// outputFile indicates the file name to write plugins run results.
 	outputFile string
 
@@ -63,10 +88,32 @@ func RegisterCommandOptions(progname string) {
 
 	registerCommandAdd(progname)
 	registerCommandList(progname)
+	registerCommandPrune(progname)
+	registerCommandReindex(progname)
 	registerCommandRemove(progname)
+	registerCommandVerify(progname)
 	registerCommandVersion(progname)
 }
 
+func registerWaitOption(f *flag.FlagSet) {
+	f.DurationVar(
+		&cmdOptions.wait,
+		"wait",
+		0,
+		"Duration to wait for another operation in progress to complete (ex: 10m).",
+	)
+}
+
+// acquireLock takes the system-wide lock for the operation, so that no other
+// 	SUM operation modifies the repository at the same time.
+func acquireLock(cmd string) (*lock.Lock, error) {
+	l, err := lock.Acquire("repo "+cmd, cmdOptions.wait)
+	if err != nil && lock.IsBusy(err) {
+		logutil.PrintNLogError("Cannot %s the software as %s.", cmd, err.Error())
+	}
+	return l, err
+}
+
 func registerCommandVersion(progname string) {
 	log.Printf("Entering repo::registerCommandVersion(%s)", progname)
 	defer log.Println("Exiting repo::registerCommandVersion")
@@ -102,6 +149,10 @@ func ScanCommandOptions(options map[string]interface{}) error {
 	log.Println("progname:", progname, "cmd with arguments:", os.Args[cmdIndex:])
 
 	var err error
+	// opLock serializes the operations that modify the repository.
+	var opLock *lock.Lock
+	defer func() { opLock.Release() }()
+
 	switch cmd {
 	case "version":
 		logutil.PrintNLog("Software Repository Manager version %s\n", myVersion)
@@ -109,17 +160,23 @@ func ScanCommandOptions(options map[string]interface{}) error {
 	case "add":
 		err = cmdOptions.addCmd.Parse(os.Args[3:])
 		if err != nil {
-			return logutil.PrintNLogError(cmd, "command arguments parse error:", err.Error())
+			return errcode.New(errcode.InvalidUsage, "%s command arguments parse error: %s", cmd, err.Error())
+		}
+		if opLock, err = acquireLock(cmd); err != nil {
+			return err
 		}
 		err = Add(cmdOptions.softwarePath,
 			map[string]string{
+				"checksum":     cmdOptions.checksum,
+				"copy":         strconv.FormatBool(cmdOptions.copy),
+				"onConflict":   cmdOptions.onConflict,
 				"softwareRepo": cmdOptions.softwareRepo,
 			})
 
 	case "list":
 		err = cmdOptions.listCmd.Parse(os.Args[3:])
 		if err != nil {
-			return logutil.PrintNLogError(cmd, "command arguments parse error:", err.Error())
+			return errcode.New(errcode.InvalidUsage, "%s command arguments parse error: %s", cmd, err.Error())
 		}
 
 		params := map[string]string{
@@ -132,13 +189,49 @@ func ScanCommandOptions(options map[string]interface{}) error {
 		}
 		_, err = List(params)
 
+	case "prune":
+		err = cmdOptions.pruneCmd.Parse(os.Args[3:])
+		if err != nil {
+			return errcode.New(errcode.InvalidUsage, "%s command arguments parse error: %s", cmd, err.Error())
+		}
+		if opLock, err = acquireLock(cmd); err != nil {
+			return err
+		}
+		err = runPruneCommand(cmdOptions.softwareRepo, cmdOptions.dryRun)
+
+	case "reindex":
+		err = cmdOptions.reindexCmd.Parse(os.Args[3:])
+		if err != nil {
+			return errcode.New(errcode.InvalidUsage, "%s command arguments parse error: %s", cmd, err.Error())
+		}
+		if opLock, err = acquireLock(cmd); err != nil {
+			return err
+		}
+		err = Reindex(cmdOptions.softwareRepo)
+
 	case "remove":
 		err = cmdOptions.removeCmd.Parse(os.Args[3:])
 		if err != nil {
-			return logutil.PrintNLogError(cmd, "command arguments parse error:", err.Error())
+			return errcode.New(errcode.InvalidUsage, "%s command arguments parse error: %s", cmd, err.Error())
+		}
+		if opLock, err = acquireLock(cmd); err != nil {
+			return err
 		}
 		err = Remove(cmdOptions.softwareName, cmdOptions.softwareType, cmdOptions.softwareRepo)
 
+	case "verify":
+		err = cmdOptions.verifyCmd.Parse(os.Args[3:])
+		if err != nil {
+			return errcode.New(errcode.InvalidUsage, "%s command arguments parse error: %s", cmd, err.Error())
+		}
+
+		params := map[string]string{
+			"softwareName": cmdOptions.softwareName,
+			"softwareRepo": cmdOptions.softwareRepo,
+			"softwareType": cmdOptions.softwareType,
+		}
+		_, err = Verify(params)
+
 	case "help":
 		subcmd := ""
 		if len(os.Args) == cmdIndex+2 {
@@ -176,7 +269,10 @@ The commands are:
 
 	add 		add specified software to repository.
 	list 		lists contents of software repository.
+	prune 		remove software not retained by the retention policies from repository.
+	reindex		rebuild the index of software repository.
 	remove 		remove specified software from repository.
+	verify 		verify checksums of software in repository.
 	version		print Software Repository version.
 
 Use "PROGNAME help [command]" for more information about a command.
@@ -187,8 +283,14 @@ Use "PROGNAME help [command]" for more information about a command.
 		cmdOptions.addCmd.Usage()
 	case "list":
 		cmdOptions.listCmd.Usage()
+	case "prune":
+		cmdOptions.pruneCmd.Usage()
+	case "reindex":
+		cmdOptions.reindexCmd.Usage()
 	case "remove":
 		cmdOptions.removeCmd.Usage()
+	case "verify":
+		cmdOptions.verifyCmd.Usage()
 	case "version":
 		cmdOptions.versionCmd.Usage()
 	default:
@@ -197,3 +299,29 @@ Use "PROGNAME help [command]" for more information about a command.
 		os.Exit(2)
 	}
 }
+
+// NotFoundError is returned when the specified software is not found in the
+// 	software repository.
+type NotFoundError struct {
+	Action string
+	Name   string
+	Type   string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("Unable to %s %s software %s. Specified software not found.",
+		e.Action, e.Type, e.Name)
+}
+
+// ErrorCode returns the class of the failure.
+func (e *NotFoundError) ErrorCode() errcode.Code {
+	return errcode.SoftwareNotFound
+}
+
+// NewNotFoundError prints and logs that the specified software is not found
+// 	for the action, and returns the error.
+func NewNotFoundError(action, swName, swType string) error {
+	err := &NotFoundError{Action: action, Name: swName, Type: swType}
+	logutil.PrintNLogError("%s", err.Error())
+	return err
+}
@@ -0,0 +1,294 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+// Package repo defines software repository functions like listing, removing
+// 	packages from software repository.
+package repo
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/plugin-manager/utils/output"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"github.com/VeritasOS/software-update-manager/utils/fsutil"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checksumFileSuffix is the suffix of the file that holds the SHA-256
+// 	checksum of the software, in the format of `sha256sum`.
+// INFO: The checksum is recorded next to the software in the repository,
+// 	and not only in the index, so that rebuilding the index doesn't
+// 	accept a corrupted software.
+const checksumFileSuffix = ".sha256"
+
+// Statuses of the verification of the software.
+const (
+	VerifyOk         = "ok"
+	VerifyCorrupted  = "corrupted"
+	VerifyMissing    = "missing"
+	VerifyNoChecksum = "no-checksum"
+)
+
+// VerifyResult is the result of the verification of a software in the
+// 	software repository.
+type VerifyResult struct {
+	Type     string
+	FileName string
+	Status   string
+	Expected string `yaml:",omitempty" json:",omitempty"`
+	Actual   string `yaml:",omitempty" json:",omitempty"`
+}
+
+// ChecksumError is returned when the checksum of the software doesn't match
+// 	the expected checksum.
+type ChecksumError struct {
+	FileName string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("The SHA-256 checksum %s of %s software doesn't match "+
+		"the expected checksum %s. The software may be corrupted.",
+		e.Actual, e.FileName, e.Expected)
+}
+
+// ErrorCode returns the class of the failure.
+func (e *ChecksumError) ErrorCode() errcode.Code {
+	return errcode.ChecksumMismatch
+}
+
+// newChecksumError prints and logs the checksum mismatch of the software,
+// 	and returns the error.
+func newChecksumError(file, expected, actual string) error {
+	err := &ChecksumError{FileName: filepath.Base(file), Expected: expected, Actual: actual}
+	logutil.PrintNLogError("%s", err.Error())
+	return err
+}
+
+// parseChecksum parses the SHA-256 checksum, which may be followed by the
+// 	file name as in the output of `sha256sum`.
+func parseChecksum(checksum string) (string, error) {
+	fields := strings.Fields(checksum)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty checksum")
+	}
+	sum := strings.ToLower(fields[0])
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != 32 {
+		return "", fmt.Errorf("invalid SHA-256 checksum %q", fields[0])
+	}
+	return sum, nil
+}
+
+// readChecksumFile returns the checksum recorded in the checksum file of the
+// 	software, if any.
+func readChecksumFile(file string) (string, error) {
+	path := file + checksumFileSuffix
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		log.Printf("ioutil.ReadFile(%s); Error: %s", path, err.Error())
+		return "", err
+	}
+	sum, err := parseChecksum(string(data))
+	if err != nil {
+		log.Printf("Failed to parse %s. Error: %s", path, err.Error())
+		return "", err
+	}
+	return sum, nil
+}
+
+// writeChecksumFile records the checksum of the software in its checksum
+// 	file.
+func writeChecksumFile(file, checksum string) error {
+	data := fmt.Sprintf("%s  %s\n", checksum, filepath.Base(file))
+	return fsutil.WriteFileAtomic(file+checksumFileSuffix, []byte(data), 0644)
+}
+
+// expectedChecksum returns the checksum recorded when the software was added,
+// 	either in its checksum file, or in the index of the repository.
+func (idx *repoIndex) expectedChecksum(file string) (string, error) {
+	sum, err := readChecksumFile(file)
+	if err != nil || sum != "" {
+		return sum, err
+	}
+	return idx.checksum(file), nil
+}
+
+// VerifyChecksum verifies that the checksum of the software in the software
+// 	repository matches the checksum recorded when it was added, either in
+// 	its checksum file, or in the index of the repository. The software
+// 	without a recorded checksum (Ex: added before the checksums were
+// 	recorded) fails the verification, unless allowUnverified is set.
+func VerifyChecksum(file string, allowUnverified bool) error {
+	log.Printf("Entering repo::VerifyChecksum(%s, %v)", file, allowUnverified)
+	defer log.Println("Exiting repo::VerifyChecksum")
+
+	// INFO: The software is in the type directory of the repository.
+	idx := loadIndex(filepath.Dir(filepath.Dir(file)))
+	expected, err := idx.expectedChecksum(file)
+	if err != nil {
+		return logutil.PrintNLogError("Failed to read the checksum of %s software.",
+			filepath.Base(file))
+	}
+	if expected == "" {
+		if allowUnverified {
+			logutil.PrintNLogWarning("No checksum is recorded for %s software. "+
+				"Skipping its verification.", filepath.Base(file))
+			return nil
+		}
+		return errcode.New(errcode.ChecksumMismatch, "No checksum is recorded for "+
+			"%s software, so it can't be verified. Add it to the repository again "+
+			"with its checksum, or allow installing it unverified.", filepath.Base(file))
+	}
+	actual, err := fileChecksum(file)
+	if err != nil {
+		return logutil.PrintNLogError("Failed to compute the checksum of %s software.",
+			filepath.Base(file))
+	}
+	if actual != expected {
+		return newChecksumError(file, expected, actual)
+	}
+	log.Printf("Verified the checksum %s of %s.", actual, file)
+	return nil
+}
+
+// Verify re-computes the checksums of the software present in the software
+// 	repository, and reports the software that is corrupted, or that is
+// 	missing i.e., whose checksum is recorded or which is indexed but is not
+// 	present in the repository.
+func Verify(params map[string]string) ([]VerifyResult, error) {
+	log.Printf("Entering repo::Verify(%v)", params)
+	defer log.Println("Exiting repo::Verify")
+
+	swName := params["softwareName"]
+	swRepo := params["softwareRepo"]
+	swType := strings.ToLower(params["softwareType"])
+
+	results := []VerifyResult{}
+	if swName != "" && swType == "" {
+		return results, errcode.New(errcode.InvalidUsage, "Invalid usage. Software type must be specified when software name is specified.")
+	}
+	files, err := listRepo(params)
+	if err != nil {
+		return results, err
+	}
+
+	idx := loadIndex(swRepo)
+	present := map[string]bool{}
+	for _, file := range files {
+		present[file] = true
+		result := VerifyResult{
+			Type:     filepath.Base(filepath.Dir(file)),
+			FileName: filepath.Base(file),
+		}
+		result.Expected, err = idx.expectedChecksum(file)
+		if err == nil {
+			result.Actual, err = fileChecksum(file)
+		}
+		switch {
+		case err != nil:
+			result.Status = VerifyCorrupted
+		case result.Expected == "":
+			result.Status = VerifyNoChecksum
+		case result.Actual != result.Expected:
+			result.Status = VerifyCorrupted
+		default:
+			result.Status = VerifyOk
+		}
+		results = append(results, result)
+	}
+
+	// The software whose checksum is recorded, or which is indexed, but is
+	// 	no longer present is missing.
+	missing := map[string]bool{}
+	typeGlob, nameGlob := swType, swName
+	if typeGlob == "" {
+		typeGlob = "*"
+	}
+	if nameGlob == "" {
+		nameGlob = "*.rpm"
+	}
+	checksumFiles, _ := filepath.Glob(filepath.Join(filepath.FromSlash(swRepo),
+		typeGlob, nameGlob+checksumFileSuffix))
+	for _, checksumFile := range checksumFiles {
+		missing[strings.TrimSuffix(checksumFile, checksumFileSuffix)] = true
+	}
+	for key := range idx.Packages {
+		parts := strings.SplitN(key, "/", 2)
+		if len(parts) == 2 && (swType == "" || parts[0] == swType) &&
+			(swName == "" || parts[1] == swName) {
+			missing[filepath.Join(filepath.FromSlash(swRepo), filepath.FromSlash(key))] = true
+		}
+	}
+	missingFiles := []string{}
+	for file := range missing {
+		if !present[filepath.Clean(file)] {
+			missingFiles = append(missingFiles, file)
+		}
+	}
+	sort.Strings(missingFiles)
+	for _, file := range missingFiles {
+		expected, _ := idx.expectedChecksum(file)
+		results = append(results, VerifyResult{
+			Type:     filepath.Base(filepath.Dir(file)),
+			FileName: filepath.Base(file),
+			Status:   VerifyMissing,
+			Expected: expected,
+		})
+	}
+
+	output.Write(results)
+
+	failed := 0
+	for _, result := range results {
+		if result.Status == VerifyCorrupted || result.Status == VerifyMissing {
+			logutil.PrintNLogError("%s software %s is %s.",
+				result.Type, result.FileName, result.Status)
+			failed++
+		}
+	}
+	if failed != 0 {
+		return results, errcode.New(errcode.ChecksumMismatch,
+			"Verification of %d software in repository failed.", failed)
+	}
+	logutil.PrintNLog("Verified %d software in repository.\n", len(results))
+	return results, nil
+}
+
+// registerCommandVerify registers the verify command that enables one to
+// 	verify the checksums of the software in the software update repository.
+func registerCommandVerify(progname string) {
+	log.Printf("Entering repo::registerCommandVerify(%s)", progname)
+	defer log.Println("Exiting repo::registerCommandVerify")
+
+	cmdOptions.verifyCmd = flag.NewFlagSet(progname+" verify", flag.PanicOnError)
+	cmdOptions.verifyCmd.StringVar(
+		&cmdOptions.softwareName,
+		"filename",
+		"",
+		"File name of the software.",
+	)
+	cmdOptions.verifyCmd.StringVar(
+		&cmdOptions.softwareRepo,
+		"repo",
+		SoftwareRepoPath,
+		"Path of the software repository.",
+	)
+	cmdOptions.verifyCmd.StringVar(
+		&cmdOptions.softwareType,
+		"type",
+		"",
+		"Type of the software.",
+	)
+	output.RegisterCommandOptions(cmdOptions.verifyCmd,
+		map[string]string{"output-format": "yaml"})
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+// Package repo defines software repository functions like listing, removing
+// 	packages from software repository.
+package repo
+
+import (
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"github.com/VeritasOS/software-update-manager/utils/lock"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sha256 of "a".
+const checksumA = "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"
+
+func TestVerify(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "repo-verify")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	defer func(f func(string) ([]byte, error)) { getRPMPackageInfo = f }(getRPMPackageInfo)
+	queries := 0
+	getRPMPackageInfo = fakeRPMPackageInfo(&queries)
+	swRepo := filepath.Join(tmpDir, "repository")
+	stage := func(name string) string {
+		path := filepath.Join(tmpDir, name)
+		ioutil.WriteFile(path, []byte("a"), 0644)
+		return path
+	}
+
+	staged := stage("a-1.0.0-1.x86_64.rpm")
+	err = Add(staged, map[string]string{"softwareRepo": swRepo, "checksum": checksumA[1:] + "0"})
+	if code := errcode.Of(err); code != errcode.ChecksumMismatch {
+		t.Fatalf("Add(wrong checksum) code = %s, want %s", code, errcode.ChecksumMismatch)
+	}
+	err = Add(staged, map[string]string{"softwareRepo": swRepo, "checksum": "abc"})
+	if code := errcode.Of(err); code != errcode.InvalidUsage {
+		t.Fatalf("Add(invalid checksum) code = %s, want %s", code, errcode.InvalidUsage)
+	}
+	ioutil.WriteFile(staged+checksumFileSuffix, []byte(checksumA+"  a-1.0.0-1.x86_64.rpm\n"), 0644)
+	if err = Add(staged, map[string]string{"softwareRepo": swRepo}); err != nil {
+		t.Fatalf("Add(checksum file) error = %v", err)
+	}
+	if _, err = os.Stat(staged + checksumFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("Add() left the checksum file of %s", staged)
+	}
+	if err = Add(stage("b-1.0.0-1.x86_64.rpm"), map[string]string{"softwareRepo": swRepo}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err = Add(stage("c-1.0.0-1.x86_64.rpm"), map[string]string{"softwareRepo": swRepo}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	added := func(name string) string {
+		return filepath.Join(swRepo, "update", name)
+	}
+	if sum, _ := readChecksumFile(added("b-1.0.0-1.x86_64.rpm")); sum != checksumA {
+		t.Errorf("Add() recorded checksum %s, want %s", sum, checksumA)
+	}
+
+	results, err := Verify(map[string]string{"softwareRepo": swRepo})
+	if err != nil || len(results) != 3 {
+		t.Fatalf("Verify() = %+v, %v, want 3 verified software", results, err)
+	}
+	if err = VerifyChecksum(added("a-1.0.0-1.x86_64.rpm"), false); err != nil {
+		t.Errorf("VerifyChecksum() error = %v", err)
+	}
+
+	// The checksum of the software without its checksum file is looked up
+	// 	in the index.
+	os.Remove(added("c-1.0.0-1.x86_64.rpm") + checksumFileSuffix)
+	results, err = Verify(map[string]string{"softwareRepo": swRepo,
+		"softwareType": "update", "softwareName": "c-1.0.0-1.x86_64.rpm"})
+	if err != nil || len(results) != 1 || results[0].Status != VerifyOk ||
+		results[0].Expected != checksumA {
+		t.Errorf("Verify(c without checksum file) = %+v, %v, want c verified", results, err)
+	}
+	if err = VerifyChecksum(added("c-1.0.0-1.x86_64.rpm"), false); err != nil {
+		t.Errorf("VerifyChecksum(c without checksum file) error = %v", err)
+	}
+	writeChecksumFile(added("c-1.0.0-1.x86_64.rpm"), checksumA)
+
+	// A truncated software is corrupted, and a software removed without
+	// 	`remove` is missing.
+	ioutil.WriteFile(added("a-1.0.0-1.x86_64.rpm"), []byte{}, 0644)
+	os.Remove(added("b-1.0.0-1.x86_64.rpm"))
+	results, err = Verify(map[string]string{"softwareRepo": swRepo})
+	if code := errcode.Of(err); code != errcode.ChecksumMismatch {
+		t.Errorf("Verify() code = %s, want %s", code, errcode.ChecksumMismatch)
+	}
+	want := map[string]string{
+		"a-1.0.0-1.x86_64.rpm": VerifyCorrupted,
+		"b-1.0.0-1.x86_64.rpm": VerifyMissing,
+		"c-1.0.0-1.x86_64.rpm": VerifyOk,
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Verify() = %+v, want %v", results, want)
+	}
+	for _, result := range results {
+		if result.Type != "update" || want[result.FileName] != result.Status {
+			t.Errorf("Verify() result = %+v, want %s", result, want[result.FileName])
+		}
+	}
+	if code := errcode.Of(VerifyChecksum(added("a-1.0.0-1.x86_64.rpm"), false)); code != errcode.ChecksumMismatch {
+		t.Errorf("VerifyChecksum() code = %s, want %s", code, errcode.ChecksumMismatch)
+	}
+
+	results, err = Verify(map[string]string{"softwareRepo": swRepo,
+		"softwareType": "update", "softwareName": "c-1.0.0-1.x86_64.rpm"})
+	if err != nil || len(results) != 1 || results[0].Status != VerifyOk {
+		t.Errorf("Verify(c) = %+v, %v, want c verified", results, err)
+	}
+	if err = Remove("c-1.0.0-1.x86_64.rpm", "update", swRepo); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err = os.Stat(added("c-1.0.0-1.x86_64.rpm") + checksumFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("Remove() left the checksum file of c")
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "repo-verify")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	defer func(f func(string) ([]byte, error)) { getRPMPackageInfo = f }(getRPMPackageInfo)
+	queries := 0
+	getRPMPackageInfo = fakeRPMPackageInfo(&queries)
+	lock.SetLockFile(filepath.Join(tmpDir, "sum.lock"))
+	defer lock.SetLockFile(lock.DefaultLockFile)
+	swRepo := filepath.Join(tmpDir, "repository")
+	added := func(name string) string {
+		return filepath.Join(swRepo, "update", name)
+	}
+
+	staged := filepath.Join(tmpDir, "a-1.0.0-1.x86_64.rpm")
+	ioutil.WriteFile(staged, []byte("a"), 0644)
+	if err = Add(staged, map[string]string{"softwareRepo": swRepo}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	// Without the checksum file, the checksum in the index is used.
+	os.Remove(added("a-1.0.0-1.x86_64.rpm") + checksumFileSuffix)
+	if err = VerifyChecksum(added("a-1.0.0-1.x86_64.rpm"), false); err != nil {
+		t.Errorf("VerifyChecksum(indexed) error = %v", err)
+	}
+	ioutil.WriteFile(added("a-1.0.0-1.x86_64.rpm"), []byte("b"), 0644)
+	err = VerifyChecksum(added("a-1.0.0-1.x86_64.rpm"), false)
+	if code := errcode.Of(err); code != errcode.ChecksumMismatch {
+		t.Errorf("VerifyChecksum(corrupted) code = %s, want %s", code, errcode.ChecksumMismatch)
+	}
+
+	// The software copied into the repository is indexed by list without a
+	// 	checksum, and is installed only if allowed to be unverified.
+	ioutil.WriteFile(added("b-1.0.0-1.x86_64.rpm"), []byte("b"), 0644)
+	if _, err = List(map[string]string{"softwareRepo": swRepo}); err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	err = VerifyChecksum(added("b-1.0.0-1.x86_64.rpm"), false)
+	if code := errcode.Of(err); code != errcode.ChecksumMismatch {
+		t.Errorf("VerifyChecksum(no checksum) code = %s, want %s", code, errcode.ChecksumMismatch)
+	}
+	if err = VerifyChecksum(added("b-1.0.0-1.x86_64.rpm"), true); err != nil {
+		t.Errorf("VerifyChecksum(no checksum, allowUnverified) error = %v", err)
+	}
+}
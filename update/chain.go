@@ -0,0 +1,262 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"flag"
+	"fmt"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/plugin-manager/utils/output"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// soakTimerUnit is the transient systemd timer that commits the update once
+// 	the soak period ends.
+const soakTimerUnit = "sum-soak"
+
+// soakRelockWait is how long the commit after the soak period waits for the
+// 	lock, for the operation started during the soak period (Ex: a rollback)
+// 	to complete.
+const soakRelockWait = time.Hour
+
+// isChained tells whether the operations of the update are run one after the
+// 	other by `sum install`, in which case the results of all the operations
+// 	are reported together in one status.
+func (j *Journal) isChained() bool {
+	return j.AutoReboot || j.AutoCommit
+}
+
+// setChain records the operations to be run after the install along with
+// 	the output options of the install, so that the combined results could
+// 	be written to the same output after the node is restarted.
+func (j *Journal) setChain(autoReboot, autoCommit bool, soakPeriod time.Duration) error {
+	j.AutoReboot = autoReboot
+	j.AutoCommit = autoCommit
+	j.SoakPeriod = soakPeriod
+	j.OutputFormat = output.GetFormat()
+	j.OutputFile = output.GetFile()
+	if j.OutputFile != "" {
+		// INFO: The post-reboot actions are run from a different working
+		// 	directory at boot time.
+		if absPath, err := filepath.Abs(j.OutputFile); err == nil {
+			j.OutputFile = absPath
+		}
+	}
+	j.Updated = time.Now()
+	return j.save()
+}
+
+// runOperation runs the specified operation of the update as part of the
+// 	chain, either from the software in the repository or from the plugins
+// 	library, and records its results.
+func runOperation(journal *Journal, operation, library string) error {
+	log.Printf("Entering update::runOperation(%s, %s)", operation, library)
+	defer log.Println("Exiting update::runOperation")
+
+	if err := journal.begin(operation, "", ""); err != nil {
+		return err
+	}
+
+	var err error
+	status := journal.newStatus()
+	if journal.SoftwareName != "" {
+		params := map[string]string{
+			"softwareRepo":   journal.SoftwareRepo,
+			"productVersion": journal.ProductVersion,
+		}
+		err = runCmdFromRPM(journal, operation, journal.SoftwareName,
+			journal.SoftwareType, params)
+		status.Status = dStatusOk
+		if err != nil {
+			status = failedStatus(err)
+		}
+	} else {
+		var ret bool
+		switch operation {
+		case "commit":
+			status.checkpoint = newCheckpoint(operation, false)
+			ret = Commit(&status, library)
+		case "reboot":
+			if err = journal.setLibrary(library); err != nil {
+				return err
+			}
+			ret = Reboot(&status, library)
+		}
+		status.Status = dStatusOk
+		if !ret {
+			err = status.fail("Failed to %s the update.", operation)
+		}
+	}
+	status.save()
+	status.progress.finish(status.Status)
+
+	if jerr := journal.end(operation, err == nil); jerr != nil && err == nil {
+		err = jerr
+	}
+	return err
+}
+
+// autoReboot reboots the node after the update is installed, when the
+// 	install was asked to continue onto the reboot.
+func autoReboot(journal *Journal, library string) error {
+	log.Printf("Entering update::autoReboot(%s)", library)
+	defer log.Println("Exiting update::autoReboot")
+
+	if journal.State != StateInstalled {
+		// INFO: The install plugins could have rebooted the node already.
+		log.Printf("Skipping auto reboot as the update is %s.", journal.State)
+		return nil
+	}
+	logutil.PrintNLog("Rebooting the node to complete the update...\n")
+	return runOperation(journal, "reboot", library)
+}
+
+// autoCommit commits the update after the post-reboot actions succeed, when
+// 	the install was asked to continue onto the commit. With a soak period,
+// 	the end of the soak period is recorded, and the update is committed by
+// 	the soak timer, so that the post-reboot unit doesn't wait through it.
+func autoCommit(journal *Journal, library string) error {
+	log.Printf("Entering update::autoCommit(%s)", library)
+	defer log.Println("Exiting update::autoCommit")
+
+	if journal.SoakPeriod > 0 {
+		journal.SoakEnds = time.Now().Add(journal.SoakPeriod)
+		journal.Updated = time.Now()
+		if err := journal.save(); err != nil {
+			return err
+		}
+		if err := startSoakTimer(journal.SoakPeriod); err != nil {
+			return err
+		}
+		logutil.PrintNLog("The update will be committed after the soak period, "+
+			"at %s.\n", journal.SoakEnds.Format(time.RFC3339))
+		return nil
+	}
+	logutil.PrintNLog("Committing the update...\n")
+	return runOperation(journal, "commit", library)
+}
+
+// startSoakTimer starts the transient timer that runs `sum postreboot
+// 	-soak-ended` once the soak period elapses.
+// INFO: The lock isn't held during the soak period, so the update can be
+// 	rolled back, and the software repository can be managed in the
+// 	meantime.
+func startSoakTimer(soakPeriod time.Duration) error {
+	log.Printf("Entering update::startSoakTimer(%s)", soakPeriod)
+	defer log.Println("Exiting update::startSoakTimer")
+
+	if isRebootSimulated() {
+		// INFO: The update is committed through `sum postreboot -soak-ended`
+		// 	when the node restarts are simulated.
+		log.Println("Skipping the soak timer as reboot is simulated.")
+		return nil
+	}
+
+	sumPath, err := os.Executable()
+	if err != nil {
+		log.Printf("os.Executable(); Error: %s", err.Error())
+		return logutil.PrintNLogError("Failed to determine the %s path.", os.Args[0])
+	}
+
+	// INFO: Stop the timer of an earlier update that was rolled back during
+	// 	its soak period, if it's still pending.
+	cmd := execCommand("systemctl", "stop", soakTimerUnit+".timer")
+	stdOutErr, err := cmd.CombinedOutput()
+	log.Println("Stdout & Stderr:", string(stdOutErr))
+
+	cmdParams := []string{
+		"--unit=" + soakTimerUnit,
+		fmt.Sprintf("--on-active=%ds", int64(soakPeriod/time.Second)),
+		sumPath, "postreboot", "-soak-ended", "-wait=" + soakRelockWait.String(),
+	}
+	cmd = execCommand("systemd-run", cmdParams...)
+	stdOutErr, err = cmd.CombinedOutput()
+	log.Println("Stdout & Stderr:", string(stdOutErr))
+	if err != nil {
+		log.Printf("Failed to run systemd-run %v. Error: %s", cmdParams, err.Error())
+		return logutil.PrintNLogError("Failed to start the soak timer.")
+	}
+	return nil
+}
+
+// commitAfterSoak commits the update once its soak period ends. The update
+// 	isn't committed if it was rolled back, or committed in the meantime.
+func commitAfterSoak(journal *Journal, library string) error {
+	log.Printf("Entering update::commitAfterSoak(%s)", library)
+	defer log.Println("Exiting update::commitAfterSoak")
+
+	if journal.State != StateAwaitingCommit || !journal.AutoCommit ||
+		journal.SoakEnds.IsZero() {
+		logutil.PrintNLog("Skipping the auto commit as the update is %s.\n",
+			journal.State)
+		return nil
+	}
+	if time.Now().Before(journal.SoakEnds) {
+		err := errcode.New(errcode.InvalidState, "Cannot commit the update "+
+			"before its soak period ends at %s.",
+			journal.SoakEnds.Format(time.RFC3339))
+		output.Write(failedStatus(err))
+		return err
+	}
+
+	if journal.Library != "" {
+		library = journal.Library
+	}
+	logutil.PrintNLog("Committing the update...\n")
+	err := runOperation(journal, "commit", library)
+	writeChainStatus(journal)
+	return err
+}
+
+// writeChainStatus writes the combined results of all the operations of the
+// 	update to the output of the install.
+func writeChainStatus(journal *Journal) error {
+	log.Println("Entering update::writeChainStatus")
+	defer log.Println("Exiting update::writeChainStatus")
+
+	if journal.OutputFormat != "" {
+		setOutput(journal.OutputFile, journal.OutputFormat)
+	}
+	status, err := GetStatus("")
+	if err != nil {
+		return err
+	}
+	return output.Write(status)
+}
+
+// setOutput sets the output options, which are otherwise set only through
+// 	the command line.
+func setOutput(file, format string) {
+	f := flag.NewFlagSet("output", flag.ContinueOnError)
+	output.RegisterCommandOptions(f, map[string]string{
+		"output-file":   file,
+		"output-format": format,
+	})
+}
+
+// registerChainOptions registers the options to continue the install onto
+// 	the reboot and commit of the update.
+func registerChainOptions(f *flag.FlagSet) {
+	f.BoolVar(
+		&cmdOptions.autoReboot,
+		"auto-reboot",
+		false,
+		"Reboot the node after the update is installed successfully.",
+	)
+	f.BoolVar(
+		&cmdOptions.autoCommit,
+		"auto-commit",
+		false,
+		"Commit the update after the post-reboot actions succeed.",
+	)
+	f.DurationVar(
+		&cmdOptions.soakPeriod,
+		"soak-period",
+		0,
+		"Duration to wait after the post-reboot actions before the auto commit (ex: 30m).",
+	)
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"github.com/VeritasOS/software-update-manager/utils/lock"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func Test_chain(t *testing.T) {
+	plugins := map[string]string{
+		"A/a.preinstall":      "Description=Pre install\nExecStart=/bin/true\n",
+		"A/a.install":         "Description=Install\nExecStart=/bin/true\n",
+		"A/a.prereboot":       "Description=Pre reboot\nExecStart=/bin/true\n",
+		"A/a.postreboot":      "Description=Post reboot\nExecStart=/bin/true\n",
+		"A/a.commit-precheck": "Description=Commit precheck\nExecStart=/bin/true\n",
+		"A/a.commit":          "Description=Commit\nExecStart=/bin/true\n",
+	}
+	tests := []struct {
+		name       string
+		autoCommit bool
+		soakPeriod time.Duration
+		wantState  State
+		wantCommit []string
+	}{
+		{
+			name:      "Auto reboot",
+			wantState: StateAwaitingCommit,
+		},
+		{
+			name:       "Auto reboot and commit",
+			autoCommit: true,
+			wantState:  StateCommitted,
+			wantCommit: []string{"commit-precheck", "commit"},
+		},
+		{
+			name:       "Auto commit after soak period",
+			autoCommit: true,
+			soakPeriod: 10 * time.Minute,
+			wantState:  StateCommitted,
+			wantCommit: []string{"commit-precheck", "commit"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			library, cleanup := setupTestEnv(t, plugins)
+			defer cleanup()
+			outFile := filepath.Join(filepath.Dir(library), "status.yaml")
+			setOutput(outFile, "yaml")
+			defer setOutput("", "")
+
+			j, _ := LoadJournal()
+			if err := j.begin("install", "", ""); err != nil {
+				t.Fatalf("begin(install) error = %v", err)
+			}
+			if err := j.setChain(true, tt.autoCommit, tt.soakPeriod); err != nil {
+				t.Fatalf("setChain() error = %v", err)
+			}
+			status := Status{}
+			ret := Install(&status, library)
+			status.save()
+			if err := j.end("install", ret); err != nil {
+				t.Fatalf("end(install) error = %v", err)
+			}
+			if err := autoReboot(j, library); err != nil {
+				t.Fatalf("autoReboot() error = %v", err)
+			}
+			if j.State != StateRebooting {
+				t.Fatalf("autoReboot() state = %v, want %v", j.State, StateRebooting)
+			}
+
+			// Continue the chain after the restart.
+			setOutput("", "")
+			j.BootID = "stale-boot-id"
+			j.save()
+			if err := runPostReboot(j, library, true, false); err != nil {
+				t.Fatalf("runPostReboot() error = %v", err)
+			}
+			if tt.soakPeriod > 0 {
+				// The update is committed by the soak timer once the soak
+				// 	period ends.
+				if j.State != StateAwaitingCommit || j.SoakEnds.IsZero() {
+					t.Fatalf("runPostReboot() state = %v, soak ends = %v", j.State, j.SoakEnds)
+				}
+				timer := "systemd-run --unit=sum-soak --on-active=600s "
+				started := false
+				for _, cmd := range mockedCommands {
+					started = started || (strings.HasPrefix(cmd, timer) &&
+						strings.HasSuffix(cmd, " postreboot -soak-ended -wait=1h0m0s"))
+				}
+				if !started {
+					t.Fatalf("runPostReboot() commands = %v, want %s...", mockedCommands, timer)
+				}
+				j.SoakEnds = time.Now().Add(-time.Second)
+				j.save()
+				if err := commitAfterSoak(j, library); err != nil {
+					t.Fatalf("commitAfterSoak() error = %v", err)
+				}
+			}
+			if j.State != tt.wantState {
+				t.Errorf("runPostReboot() state = %v, want %v", j.State, tt.wantState)
+			}
+
+			// The combined status must be written to the output of install.
+			data, err := ioutil.ReadFile(outFile)
+			if err != nil {
+				t.Fatalf("Failed to read %s. Error: %s", outFile, err.Error())
+			}
+			var got Status
+			if err = yaml.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Failed to parse %s. Error: %s", outFile, err.Error())
+			}
+			if got.Phase != tt.wantState || len(got.Install) != 2 ||
+				len(got.Reboot) != 2 || got.Status != dStatusOk {
+				t.Errorf("Combined status = %+v", got)
+			}
+			gotCommit := []string{}
+			for _, rs := range got.Commit {
+				gotCommit = append(gotCommit, rs.Type)
+			}
+			if len(tt.wantCommit) != 0 && !reflect.DeepEqual(gotCommit, tt.wantCommit) {
+				t.Errorf("Combined status commit = %v, want %v", gotCommit, tt.wantCommit)
+			}
+		})
+	}
+}
+
+func Test_commitAfterSoak(t *testing.T) {
+	tests := []struct {
+		name      string
+		soakEnds  time.Duration
+		rollback  bool
+		wantErr   bool
+		wantState State
+	}{
+		{
+			name:      "Soak period ended",
+			soakEnds:  -time.Second,
+			wantState: StateCommitted,
+		},
+		{
+			name:      "Soak period not ended",
+			soakEnds:  time.Minute,
+			wantErr:   true,
+			wantState: StateAwaitingCommit,
+		},
+		{
+			name:      "Rolled back during soak period",
+			soakEnds:  -time.Second,
+			rollback:  true,
+			wantState: StateRolledBack,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			library, cleanup := setupTestEnv(t, nil)
+			defer cleanup()
+
+			j, _ := LoadJournal()
+			j.State = StateAwaitingCommit
+			j.AutoCommit = true
+			j.SoakPeriod = 10 * time.Minute
+			j.SoakEnds = time.Now().Add(tt.soakEnds)
+			if err := j.save(); err != nil {
+				t.Fatalf("save() error = %v", err)
+			}
+			if tt.rollback {
+				// The lock isn't held during the soak period, so the
+				// 	update can be rolled back by another operation.
+				l, err := lock.Acquire("rollback", 0)
+				if err != nil {
+					t.Fatalf("lock.Acquire(rollback) error = %v", err)
+				}
+				if err = j.begin("rollback", "", ""); err != nil {
+					t.Fatalf("begin(rollback) error = %v", err)
+				}
+				if err = j.end("rollback", true); err != nil {
+					t.Fatalf("end(rollback) error = %v", err)
+				}
+				l.Release()
+			}
+
+			err := commitAfterSoak(j, library)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("commitAfterSoak() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if j.State != tt.wantState {
+				t.Errorf("commitAfterSoak() state = %v, want %v", j.State, tt.wantState)
+			}
+		})
+	}
+}
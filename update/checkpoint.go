@@ -0,0 +1,139 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	pm "github.com/VeritasOS/plugin-manager"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	osutils "github.com/VeritasOS/plugin-manager/utils/os"
+	"github.com/VeritasOS/software-update-manager/utils/fsutil"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// checkpointsDirName is the directory in the state dir that holds the
+// 	checkpoints of the operations run as part of the current update.
+const checkpointsDirName = "checkpoints"
+
+// checkpoint is the record of the plugin types completed by an operation, so
+// 	that the operation can be resumed from the first incomplete plugin type
+// 	when it gets interrupted.
+type checkpoint struct {
+	Operation string
+	Completed []pm.RunStatus `yaml:",omitempty"`
+
+	// resume indicates whether the completed results are to be reused.
+	resume bool
+	// next is the index of the completed result to be reused next.
+	next int
+}
+
+// resumableOperations are the operations that can be resumed when they get
+// 	interrupted.
+var resumableOperations = []string{"install", "commit", "rollback"}
+
+func isResumable(operation string) bool {
+	for _, op := range resumableOperations {
+		if op == operation {
+			return true
+		}
+	}
+	return false
+}
+
+func getCheckpointsDir() string {
+	return filepath.FromSlash(stateDir + checkpointsDirName + string(os.PathSeparator))
+}
+
+func getCheckpointPath(operation string) string {
+	return getCheckpointsDir() + operation + ".yaml"
+}
+
+// newCheckpoint returns the checkpoint of the specified operation. When
+// 	resuming, the results completed by the interrupted run are loaded.
+// 	Otherwise, the operation starts afresh, and so any earlier checkpoint of
+// 	the operation is discarded.
+func newCheckpoint(operation string, resume bool) *checkpoint {
+	log.Printf("Entering update::newCheckpoint(%s, %v)", operation, resume)
+	defer log.Println("Exiting update::newCheckpoint")
+
+	c := checkpoint{Operation: operation}
+	if !resume {
+		c.save()
+		return &c
+	}
+
+	path := getCheckpointPath(operation)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("ioutil.ReadFile(%s); Error: %s", path, err.Error())
+		}
+		logutil.PrintNLogWarning("No checkpoint found for %s. "+
+			"Running all the %s plugins.", operation, operation)
+		return &c
+	}
+	if err = yaml.Unmarshal(data, &c); err != nil {
+		log.Printf("yaml.Unmarshal(%s); Error: %s", path, err.Error())
+		logutil.PrintNLogWarning("Failed to parse the checkpoint of %s. "+
+			"Running all the %s plugins.", operation, operation)
+		return &checkpoint{Operation: operation}
+	}
+	c.resume = true
+	return &c
+}
+
+// reuse returns the result of the specified plugin type if it was completed
+// 	by the interrupted run. Once a plugin type is found to be incomplete,
+// 	that and all the following plugin types are run again.
+func (c *checkpoint) reuse(pluginType string) (pm.RunStatus, bool) {
+	if c == nil || !c.resume {
+		return pm.RunStatus{}, false
+	}
+	if c.next < len(c.Completed) && c.Completed[c.next].Type == pluginType {
+		c.next++
+		return c.Completed[c.next-1], true
+	}
+	c.resume = false
+	c.Completed = c.Completed[:c.next]
+	return pm.RunStatus{}, false
+}
+
+// add records the result of a completed plugin type.
+func (c *checkpoint) add(result pm.RunStatus) {
+	if c == nil {
+		return
+	}
+	c.Completed = append(c.Completed, result)
+	c.save()
+}
+
+// save writes the checkpoint atomically to the state dir.
+func (c *checkpoint) save() {
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		log.Printf("yaml.Marshal(%+v); Error: %s", c, err.Error())
+		return
+	}
+	// INFO: Failing to record the checkpoint should not fail the update, as
+	// 	it only means that the operation can't be resumed.
+	err = fsutil.WriteFileAtomic(getCheckpointPath(c.Operation), out, 0644)
+	if err != nil {
+		log.Printf("Failed to record the checkpoint. Error: %s", err.Error())
+	}
+}
+
+// clearCheckpoints removes the checkpoints of the operations run as part of
+// 	the previous update.
+func clearCheckpoints() error {
+	dir := getCheckpointsDir()
+	if err := osutils.OsRemoveAll(dir); err != nil {
+		log.Printf("Unable to remove %s. Error: %s", dir, err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	pm "github.com/VeritasOS/plugin-manager"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestInstall_resume(t *testing.T) {
+	plugins := map[string]string{
+		// INFO: preinstall fails when run, so the install succeeds only
+		// 	when the completed preinstall result is reused.
+		"A/a.preinstall": "Description=Pre install\nExecStart=/bin/false\n",
+		"A/a.install":    "Description=Install\nExecStart=/bin/true\n",
+	}
+	tests := []struct {
+		name      string
+		completed []pm.RunStatus
+		want      bool
+		wantTypes []string
+	}{
+		{
+			name:      "Resume after preinstall",
+			completed: []pm.RunStatus{{Type: "preinstall", Status: dStatusOk}},
+			want:      true,
+			wantTypes: []string{"preinstall", "install"},
+		},
+		{
+			name:      "Resume without checkpoint",
+			want:      false,
+			wantTypes: []string{"preinstall", "rollback"},
+		},
+		{
+			name:      "Resume with stale checkpoint",
+			completed: []pm.RunStatus{{Type: "commit-precheck", Status: dStatusOk}},
+			want:      false,
+			wantTypes: []string{"preinstall", "rollback"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			library, cleanup := setupTestEnv(t, plugins)
+			defer cleanup()
+
+			if tt.completed != nil {
+				c := checkpoint{Operation: "install", Completed: tt.completed}
+				c.save()
+			}
+			status := Status{checkpoint: newCheckpoint("install", true)}
+			got := Install(&status, library)
+			if got != tt.want {
+				t.Errorf("Install() = %v, want %v", got, tt.want)
+			}
+			gotTypes := []string{}
+			for _, rs := range status.Install {
+				gotTypes = append(gotTypes, rs.Type)
+			}
+			if !reflect.DeepEqual(gotTypes, tt.wantTypes) {
+				t.Errorf("Install() results %v, want %v", gotTypes, tt.wantTypes)
+			}
+		})
+	}
+}
+
+func TestJournal_resume(t *testing.T) {
+	_, cleanup := setupTestEnv(t, nil)
+	defer cleanup()
+
+	// Get the PID of a process that no longer exists.
+	cmd := exec.Command("/bin/true")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to run /bin/true. Error: %s", err.Error())
+	}
+	deadPID := cmd.Process.Pid
+
+	tests := []struct {
+		name      string
+		journal   Journal
+		operation string
+		wantErr   bool
+	}{
+		{
+			name:      "Interrupted install",
+			journal:   Journal{State: StateInstalling, Operation: "install", PID: deadPID},
+			operation: "install",
+		},
+		{
+			name:      "Running install",
+			journal:   Journal{State: StateInstalling, Operation: "install", PID: os.Getpid()},
+			operation: "install",
+			wantErr:   true,
+		},
+		{
+			name:      "Completed install",
+			journal:   Journal{State: StateInstalled, Operation: "install", PID: deadPID},
+			operation: "install",
+			wantErr:   true,
+		},
+		{
+			name:      "Different operation",
+			journal:   Journal{State: StateCommitting, Operation: "commit", PID: deadPID},
+			operation: "install",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := tt.journal
+			err := j.resume(tt.operation)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resume() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (j.PID != os.Getpid() || j.State != tt.journal.State) {
+				t.Errorf("resume() journal = %+v", j)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/software-update-manager/repo"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultConfigFile is the location of the SUM configuration.
+const DefaultConfigFile = "/etc/sum/sum.yaml"
+
+var configFile = DefaultConfigFile
+
+// SetConfigFile sets the location of the SUM configuration.
+func SetConfigFile(path string) {
+	configFile = filepath.Clean(path)
+}
+
+// Config is the node specific configuration of SUM.
+type Config struct {
+	Reboot   RebootConfig  `yaml:",omitempty"`
+	Timeouts TimeoutConfig `yaml:",omitempty"`
+	// FailurePolicies are the failure policies of the phases (Ex: install:
+	// 	halt), which override the ones in the workflow of the software.
+	FailurePolicies map[string]string `yaml:"failure-policies,omitempty"`
+	Events          EventsConfig      `yaml:",omitempty"`
+	// MaintenanceWindows are the periods in which the scheduled operations
+	// 	are allowed to run. When not specified, they can run at any time.
+	MaintenanceWindows []MaintenanceWindow `yaml:"maintenance-windows,omitempty"`
+	// RepoRetention are the retention policies of the software types (Ex:
+	// 	update: {keep-newest: 2}) used to prune the software repository.
+	RepoRetention map[string]repo.RetentionPolicy `yaml:"repo-retention,omitempty"`
+}
+
+// LoadConfig reads the SUM configuration. If there is no configuration, then
+// 	the defaults are used.
+func LoadConfig() (Config, error) {
+	log.Println("Entering update::LoadConfig")
+	defer log.Println("Exiting update::LoadConfig")
+
+	conf := Config{}
+	data, err := ioutil.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		return conf, nil
+	}
+	if err != nil {
+		log.Printf("ioutil.ReadFile(%s); Error: %s", configFile, err.Error())
+		return conf, logutil.PrintNLogError("Failed to read the configuration %s.", configFile)
+	}
+	if err = yaml.UnmarshalStrict(data, &conf); err != nil {
+		log.Printf("yaml.UnmarshalStrict(%s); Error: %s", configFile, err.Error())
+		return conf, logutil.PrintNLogError("Failed to parse the configuration %s.", configFile)
+	}
+	if err = conf.Events.validate(); err != nil {
+		return conf, logutil.PrintNLogError("Invalid configuration %s. %s.",
+			configFile, err.Error())
+	}
+	for _, w := range conf.MaintenanceWindows {
+		if err = w.validate(); err != nil {
+			return conf, logutil.PrintNLogError("Invalid configuration %s. %s.",
+				configFile, err.Error())
+		}
+	}
+	return conf, nil
+}
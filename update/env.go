@@ -0,0 +1,73 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Environment variables exported to the plugins, which tell them the update
+// 	they're run for.
+// INFO: The variables are part of the plugin contract, and are documented
+// 	in the README. They're never renamed or removed.
+const (
+	EnvOperation       = "SUM_OPERATION"
+	EnvPhase           = "SUM_PHASE"
+	EnvPluginType      = "SUM_PLUGIN_TYPE"
+	EnvSoftwareName    = "SUM_SOFTWARE_NAME"
+	EnvSoftwareType    = "SUM_SOFTWARE_TYPE"
+	EnvSoftwareVersion = "SUM_SOFTWARE_VERSION"
+	EnvSoftwareRelease = "SUM_SOFTWARE_RELEASE"
+	EnvFromVersion     = "SUM_FROM_VERSION"
+	EnvToVersion       = "SUM_TO_VERSION"
+	EnvRunID           = runIDEnv
+	EnvStateDir        = "SUM_STATE_DIR"
+	EnvUpgradeRoot     = "VXAPP_UPGRADE_ROOT"
+)
+
+// upgradeRoot is the path of the alternate root i.e., upgrade volume, for
+// 	doing offline updates.
+const upgradeRoot = "/system/upgrade/volume/"
+
+// pluginEnv returns the environment variables of the plugins run in the
+// 	specified phase of the operation of the journal.
+func (j *Journal) pluginEnv(phase string) map[string]string {
+	return map[string]string{
+		EnvOperation:       j.Operation,
+		EnvPhase:           phase,
+		EnvSoftwareName:    j.SoftwareName,
+		EnvSoftwareType:    j.SoftwareType,
+		EnvSoftwareVersion: j.SoftwareVersion,
+		EnvSoftwareRelease: j.SoftwareRelease,
+		EnvFromVersion:     j.ProductVersion,
+		EnvToVersion:       j.SoftwareVersion,
+		EnvRunID:           j.RunID,
+		EnvStateDir:        filepath.Clean(stateDir),
+		EnvUpgradeRoot:     upgradeRoot,
+	}
+}
+
+// setPluginEnv exports the environment variables of the specified phase of
+// 	the current operation, so that they're inherited by the plugins.
+// 	The variables that aren't known are unset, so that the values of the
+// 	outer `sum` operation aren't passed on to the plugins.
+func setPluginEnv(phase string) {
+	log.Printf("Entering update::setPluginEnv(%s)", phase)
+	defer log.Println("Exiting update::setPluginEnv")
+
+	j, err := LoadJournal()
+	if err != nil {
+		log.Printf("Unable to get the update details for the plugins. Error: %s",
+			err.Error())
+	}
+	for name, value := range j.pluginEnv(phase) {
+		if value == "" {
+			os.Unsetenv(name)
+			continue
+		}
+		os.Setenv(name, value)
+	}
+	os.Unsetenv(EnvPluginType)
+}
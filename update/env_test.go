@@ -0,0 +1,73 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstall_pluginEnv(t *testing.T) {
+	plugins := map[string]string{
+		"A/a.preinstall": "Description=Pre install\nExecStart=${PM_LIBRARY}/A/env.sh\n",
+		"A/a.install":    "Description=Install\nExecStart=/bin/true\n",
+	}
+	library, cleanup := setupTestEnv(t, plugins)
+	defer cleanup()
+	envFile := filepath.Join(filepath.Dir(library), "env.txt")
+	script := "#!/bin/sh\nenv | grep '^SUM_\\|^VXAPP_' > " + envFile + "\n"
+	if err := ioutil.WriteFile(filepath.Join(library, "A", "env.sh"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write the plugin script. Error: %s", err.Error())
+	}
+	// The values of an outer operation are not passed on to the plugins.
+	os.Setenv(EnvSoftwareRelease, "stale")
+	defer os.Unsetenv(EnvSoftwareRelease)
+
+	j, _ := LoadJournal()
+	if err := j.begin("install", "a-2.0.0-1.x86_64.rpm", "asum"); err != nil {
+		t.Fatalf("begin() error = %v", err)
+	}
+	j.SoftwareVersion = "2.0.0"
+	j.ProductVersion = "1.0.0"
+	j.MatchedVersion = "1.*"
+	j.save()
+	status := j.newStatus()
+	if !Install(&status, library) {
+		t.Fatalf("Install() failed. Status: %+v", status)
+	}
+
+	data, err := ioutil.ReadFile(envFile)
+	if err != nil {
+		t.Fatalf("Plugin did not record the environment. Error: %s", err.Error())
+	}
+	env := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		env[kv[0]] = kv[1]
+	}
+	want := map[string]string{
+		EnvOperation:       "install",
+		EnvPhase:           PhaseInstall,
+		EnvPluginType:      "preinstall",
+		EnvSoftwareName:    "a-2.0.0-1.x86_64.rpm",
+		EnvSoftwareType:    "asum",
+		EnvSoftwareVersion: "2.0.0",
+		EnvFromVersion:     "1.0.0",
+		EnvToVersion:       "2.0.0",
+		EnvRunID:           j.RunID,
+		EnvStateDir:        filepath.Join(filepath.Dir(library), "state"),
+		EnvUpgradeRoot:     upgradeRoot,
+	}
+	for name, value := range want {
+		if got, ok := env[name]; !ok || got != value {
+			t.Errorf("Plugin env %s = %q, want %q", name, got, value)
+		}
+	}
+	// The variables that aren't known are unset.
+	if got, ok := env[EnvSoftwareRelease]; ok {
+		t.Errorf("Plugin env %s = %q, want unset", EnvSoftwareRelease, got)
+	}
+}
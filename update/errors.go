@@ -0,0 +1,90 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"fmt"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+)
+
+// StateError is returned when the operation is not valid in the current
+// 	state of the update.
+type StateError struct {
+	Operation string
+	State     State
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("Cannot %s the update as the update is %s.",
+		e.Operation, e.State)
+}
+
+// ErrorCode returns the class of the failure.
+func (e *StateError) ErrorCode() errcode.Code {
+	return errcode.InvalidState
+}
+
+// PluginError is returned when the plugins of a plugin type fail, time out
+// 	or are interrupted.
+type PluginError struct {
+	PluginType string
+	// Code is one of errcode.PluginFailed, errcode.TimedOut or
+	// 	errcode.Interrupted.
+	Code    errcode.Code
+	Message string
+}
+
+func (e *PluginError) Error() string {
+	return e.Message
+}
+
+// ErrorCode returns the class of the failure.
+func (e *PluginError) ErrorCode() errcode.Code {
+	return e.Code
+}
+
+// newPluginError prints and logs the failure of the plugin type, and returns
+// 	the error.
+func newPluginError(pluginType string, code errcode.Code, format string, a ...interface{}) error {
+	err := logutil.PrintNLogError(format, a...)
+	return &PluginError{PluginType: pluginType, Code: code, Message: err.Error()}
+}
+
+// RebootError is returned when the node could not be restarted.
+type RebootError struct {
+	// Provider is the reboot provider used to restart the node.
+	Provider string
+}
+
+func (e *RebootError) Error() string {
+	return "Failed to reboot the system."
+}
+
+// ErrorCode returns the class of the failure.
+func (e *RebootError) ErrorCode() errcode.Code {
+	return errcode.RebootFailed
+}
+
+// failedStatus returns the status of the operation that failed with the
+// 	specified error.
+func failedStatus(err error) Status {
+	status := Status{Status: dStatusFail, StdOutErr: err.Error(),
+		ErrorCode: errcode.Of(err)}
+	if pe, ok := err.(*PreflightError); ok {
+		status.Preflight = pe.Results
+	}
+	return status
+}
+
+// fail records the failure of the operation in the status, and returns the
+// 	error of the class of failure recorded by the phases of the operation.
+func (s *Status) fail(format string, a ...interface{}) error {
+	if s.ErrorCode == "" {
+		s.ErrorCode = errcode.Unknown
+	}
+	err := errcode.New(s.ErrorCode, format, a...)
+	s.Status = dStatusFail
+	s.StdOutErr = err.Error()
+	return err
+}
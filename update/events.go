@@ -0,0 +1,332 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"github.com/VeritasOS/software-update-manager/utils/lock"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// EventVersion is the version of the event payload.
+// INFO: The version is incremented whenever a field is added. The fields once
+// 	published are never changed or removed, so that the consumers can rely
+// 	on them.
+const EventVersion = 1
+
+// Types of lifecycle events.
+const (
+	EventPhaseStarted    = "phase-started"
+	EventPhaseFinished   = "phase-finished"
+	EventPluginFailed    = "plugin-failed"
+	EventRebootRequested = "reboot-requested"
+	EventCommitted       = "committed"
+	EventRolledBack      = "rolled-back"
+)
+
+// eventQueueSize is the number of events that can be pending delivery,
+// 	beyond which the events are dropped.
+const eventQueueSize = 64
+
+// eventTimeout is the time allowed for delivering an event to a sink, and
+// 	eventFlushTimeout is the time allowed for delivering the pending events
+// 	before `sum` exits or the node is restarted.
+var (
+	eventTimeout      = 5 * time.Second
+	eventFlushTimeout = 10 * time.Second
+)
+
+// Event is a lifecycle event of the update, delivered as JSON to the sinks.
+type Event struct {
+	Version         int
+	Type            string
+	Operation       string `json:",omitempty"`
+	Phase           string `json:",omitempty"`
+	PluginType      string `json:",omitempty"`
+	SoftwareName    string `json:",omitempty"`
+	SoftwareType    string `json:",omitempty"`
+	SoftwareVersion string `json:",omitempty"`
+	SoftwareRelease string `json:",omitempty"`
+	// Status & ErrorCode are the result of the phase, or the failure of
+	// 	the plugin type, and Message gives its details.
+	Status    string       `json:",omitempty"`
+	ErrorCode errcode.Code `json:",omitempty"`
+	Message   string       `json:",omitempty"`
+	Time      time.Time
+}
+
+// EventsConfig is the configuration of the sinks where the lifecycle events
+// 	are delivered.
+type EventsConfig struct {
+	// HooksDir is the directory of the executables that are run with the
+	// 	event on their standard input.
+	HooksDir string `yaml:"hooks-dir,omitempty"`
+	// Webhook is the URL of the local service where the event is posted.
+	Webhook string `yaml:",omitempty"`
+	// Socket is the Unix socket where the event is written as a line.
+	Socket string `yaml:",omitempty"`
+}
+
+func (c EventsConfig) isEmpty() bool {
+	return c.HooksDir == "" && c.Webhook == "" && c.Socket == ""
+}
+
+// validate validates the configuration of the sinks.
+// INFO: The webhook must be a local service, so that the event data doesn't
+// 	leave the node. The services elsewhere are reached through a local
+// 	service, or the hooks.
+func (c EventsConfig) validate() error {
+	if c.Webhook == "" {
+		return nil
+	}
+	u, err := url.Parse(c.Webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook %q of the events, expected an http "+
+			"or https URL", c.Webhook)
+	}
+	if !isLoopbackHost(u.Hostname()) {
+		return fmt.Errorf("invalid webhook %q of the events, expected the URL "+
+			"of a local service (ex: localhost)", c.Webhook)
+	}
+	return nil
+}
+
+// isLoopbackHost tells whether the host is the local node.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// event returns the event of the specified type for the update of the
+// 	journal.
+func (j *Journal) event(eventType string) Event {
+	return Event{
+		Version:         EventVersion,
+		Type:            eventType,
+		Operation:       j.Operation,
+		SoftwareName:    j.SoftwareName,
+		SoftwareType:    j.SoftwareType,
+		SoftwareVersion: j.SoftwareVersion,
+		SoftwareRelease: j.SoftwareRelease,
+		Time:            time.Now(),
+	}
+}
+
+// newEvent returns the event of the specified type for the current update.
+func newEvent(eventType string) Event {
+	j, err := LoadJournal()
+	if err != nil {
+		log.Printf("Unable to get the update details for %s event. Error: %s",
+			eventType, err.Error())
+	}
+	return j.event(eventType)
+}
+
+// eventDispatcher delivers the events to the sinks in the background, so
+// 	that a slow or unavailable sink doesn't block the update.
+type eventDispatcher struct {
+	config  EventsConfig
+	queue   chan Event
+	pending sync.WaitGroup
+}
+
+var dispatcher struct {
+	sync.Mutex
+	loaded bool
+	d      *eventDispatcher
+}
+
+// getDispatcher returns the dispatcher of the events, or nil if there are no
+// 	sinks configured.
+func getDispatcher() *eventDispatcher {
+	dispatcher.Lock()
+	defer dispatcher.Unlock()
+	if dispatcher.loaded {
+		return dispatcher.d
+	}
+	dispatcher.loaded = true
+	conf, err := LoadConfig()
+	if err != nil || conf.Events.isEmpty() {
+		return nil
+	}
+	d := &eventDispatcher{config: conf.Events, queue: make(chan Event, eventQueueSize)}
+	go d.run()
+	dispatcher.d = d
+	return d
+}
+
+// emitEvent queues the event for delivery to the sinks.
+func emitEvent(e Event) {
+	d := getDispatcher()
+	if d == nil {
+		return
+	}
+	d.pending.Add(1)
+	select {
+	case d.queue <- e:
+	default:
+		d.pending.Done()
+		log.Printf("Dropping %s event as %d events are pending delivery.",
+			e.Type, eventQueueSize)
+	}
+}
+
+// flushEvents waits for the pending events to be delivered, but no longer
+// 	than eventFlushTimeout.
+func flushEvents() {
+	dispatcher.Lock()
+	d := dispatcher.d
+	dispatcher.Unlock()
+	if d == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(eventFlushTimeout):
+		log.Printf("Some events were not delivered in %s.", eventFlushTimeout)
+	}
+}
+
+func (d *eventDispatcher) run() {
+	for e := range d.queue {
+		d.deliver(e)
+		d.pending.Done()
+	}
+}
+
+// deliver sends the event to each of the sinks. Failing to deliver to a sink
+// 	doesn't fail the update, so the errors are just logged.
+func (d *eventDispatcher) deliver(e Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("json.Marshal(%+v); Error: %s", e, err.Error())
+		return
+	}
+	if d.config.HooksDir != "" {
+		runHooks(d.config.HooksDir, e.Type, data)
+	}
+	if d.config.Webhook != "" {
+		if err = postEvent(d.config.Webhook, data); err != nil {
+			log.Printf("Failed to post %s event to %s. Error: %s",
+				e.Type, d.config.Webhook, err.Error())
+		}
+	}
+	if d.config.Socket != "" {
+		if err = writeEvent(d.config.Socket, data); err != nil {
+			log.Printf("Failed to write %s event to %s. Error: %s",
+				e.Type, d.config.Socket, err.Error())
+		}
+	}
+}
+
+// hookEnv returns the environment of the hooks of the event type.
+// INFO: The hooks aren't run as part of the operation, so they don't get the
+// 	lock or the run of the operation, and a `sum` run by a hook is not
+// 	taken as part of the operation.
+func hookEnv(eventType string) []string {
+	env := []string{}
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, lock.HolderEnv+"=") || strings.HasPrefix(kv, runIDEnv+"=") {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return append(env, "SUM_EVENT="+eventType)
+}
+
+// runHook runs the hook in its own process group, and kills the group if the
+// 	hook doesn't complete in eventTimeout. The combined stdout and stderr
+// 	of the hook is returned.
+// INFO: The hooks aren't part of the operation, so they're neither signalled
+// 	nor killed along with its plugins.
+func runHook(cmd *exec.Cmd) ([]byte, error) {
+	var stdOutErr bytes.Buffer
+	cmd.Stdout = &stdOutErr
+	cmd.Stderr = &stdOutErr
+	done, err := startDetached(cmd)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	timer := time.AfterFunc(eventTimeout, func() {
+		log.Printf("Killing %v as it didn't complete in %s.", cmd.Args, eventTimeout)
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	})
+	defer timer.Stop()
+	err = cmd.Wait()
+	return stdOutErr.Bytes(), err
+}
+
+// runHooks runs the executables in the hooks directory in the lexical order,
+// 	with the event on their standard input and its type in SUM_EVENT. The
+// 	hooks that don't complete in eventTimeout are killed.
+func runHooks(dir, eventType string, data []byte) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Printf("ioutil.ReadDir(%s); Error: %s", dir, err.Error())
+		return
+	}
+	for _, f := range files {
+		if !f.Mode().IsRegular() || f.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		hook := filepath.Join(dir, f.Name())
+		cmd := exec.Command(hook)
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Env = hookEnv(eventType)
+		out, err := runHook(cmd)
+		if err != nil {
+			log.Printf("Failed to run %s hook for %s event. Error: %s, Output: %s",
+				hook, eventType, err.Error(), string(out))
+		}
+	}
+}
+
+// postEvent posts the event to the webhook.
+func postEvent(url string, data []byte) error {
+	client := http.Client{Timeout: eventTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s responded with %s", url, resp.Status)
+	}
+	return nil
+}
+
+// writeEvent writes the event as a line to the Unix socket.
+func writeEvent(socket string, data []byte) error {
+	conn, err := net.DialTimeout("unix", socket, eventTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(eventTimeout))
+	_, err = conn.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"github.com/VeritasOS/software-update-manager/utils/lock"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func resetEvents() {
+	dispatcher.Lock()
+	defer dispatcher.Unlock()
+	if dispatcher.d != nil {
+		close(dispatcher.d.queue)
+	}
+	dispatcher.loaded = false
+	dispatcher.d = nil
+}
+
+// eventRecorder records the events received by a sink.
+type eventRecorder struct {
+	sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) add(t *testing.T, data []byte) {
+	var e Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		t.Errorf("Failed to parse event %q. Error: %s", data, err.Error())
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *eventRecorder) types() []string {
+	r.Lock()
+	defer r.Unlock()
+	types := []string{}
+	for _, e := range r.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+// listenEvents records the events written to a Unix socket in dir.
+func listenEvents(t *testing.T, dir string) (string, *eventRecorder) {
+	socket := filepath.Join(dir, "events.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s. Error: %s", socket, err.Error())
+	}
+	rec := &eventRecorder{}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				rec.add(t, scanner.Bytes())
+			}
+			conn.Close()
+		}
+	}()
+	return socket, rec
+}
+
+func Test_emitEvent(t *testing.T) {
+	library, cleanup := setupTestEnv(t, nil)
+	defer cleanup()
+	defer resetEvents()
+	tmpDir := filepath.Dir(library)
+
+	hooksDir := filepath.Join(tmpDir, "hooks")
+	os.MkdirAll(hooksDir, 0755)
+	hook := "#!/bin/sh\ncat > " + tmpDir + "/hook-$SUM_EVENT.json\n"
+	ioutil.WriteFile(filepath.Join(hooksDir, "10-record"), []byte(hook), 0755)
+	// Files that aren't executable are not run.
+	ioutil.WriteFile(filepath.Join(hooksDir, "README"), []byte("exit 1\n"), 0644)
+
+	webhook := &eventRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		webhook.add(t, data)
+	}))
+	defer server.Close()
+	socket, rec := listenEvents(t, tmpDir)
+
+	writeTestConfig(t, library, "events:\n  hooks-dir: "+hooksDir+"\n  webhook: "+
+		server.URL+"\n  socket: "+socket+"\n")
+	resetEvents()
+	j, _ := LoadJournal()
+	j.SoftwareName = "a.rpm"
+	j.Operation = "commit"
+	emitEvent(j.event(EventCommitted))
+	flushEvents()
+
+	data, err := ioutil.ReadFile(filepath.Join(tmpDir, "hook-"+EventCommitted+".json"))
+	if err != nil {
+		t.Fatalf("Hook did not receive the event. Error: %s", err.Error())
+	}
+	var e Event
+	if err = json.Unmarshal(data, &e); err != nil {
+		t.Fatalf("Failed to parse event %q. Error: %s", data, err.Error())
+	}
+	if e.Version != EventVersion || e.Type != EventCommitted ||
+		e.Operation != "commit" || e.SoftwareName != "a.rpm" {
+		t.Errorf("Hook event = %+v", e)
+	}
+	if got := webhook.types(); len(got) != 1 || got[0] != EventCommitted {
+		t.Errorf("Webhook events = %v, want [%s]", got, EventCommitted)
+	}
+	// INFO: The socket listener might take a moment to read the event.
+	for i := 0; i < 100 && len(rec.types()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := rec.types(); len(got) != 1 || got[0] != EventCommitted {
+		t.Errorf("Socket events = %v, want [%s]", got, EventCommitted)
+	}
+}
+
+func Test_emitEvent_slowSink(t *testing.T) {
+	library, cleanup := setupTestEnv(t, nil)
+	defer cleanup()
+	defer resetEvents()
+	defer func(timeout time.Duration) { eventFlushTimeout = timeout }(eventFlushTimeout)
+	eventFlushTimeout = 100 * time.Millisecond
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	writeTestConfig(t, library, "events:\n  webhook: "+server.URL+"\n")
+	resetEvents()
+
+	start := time.Now()
+	for i := 0; i < eventQueueSize+10; i++ {
+		emitEvent(newEvent(EventPhaseStarted))
+	}
+	flushEvents()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Emitting events to a slow sink took %s", elapsed)
+	}
+}
+
+func Test_runHooks(t *testing.T) {
+	library, cleanup := setupTestEnv(t, nil)
+	defer cleanup()
+	tmpDir := filepath.Dir(library)
+	hooksDir := filepath.Join(tmpDir, "hooks")
+	os.MkdirAll(hooksDir, 0755)
+	hook := "#!/bin/sh\nenv > " + tmpDir + "/hook.env\nsleep 0.3\ntouch " + tmpDir + "/hook.done\n"
+	ioutil.WriteFile(filepath.Join(hooksDir, "10-slow"), []byte(hook), 0755)
+	os.Setenv(lock.HolderEnv, "1")
+	defer os.Unsetenv(lock.HolderEnv)
+	os.Setenv(runIDEnv, "run-1")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runHooks(hooksDir, EventCommitted, []byte("{}"))
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(filepath.Join(tmpDir, "hook.env")); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The hooks are not killed along with the plugins.
+	signalPlugins(syscall.SIGKILL)
+	<-done
+	if _, err := os.Stat(filepath.Join(tmpDir, "hook.done")); err != nil {
+		t.Errorf("Hook was killed along with the plugins. Error: %s", err.Error())
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(tmpDir, "hook.env"))
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, lock.HolderEnv+"=") || strings.HasPrefix(line, runIDEnv+"=") {
+			t.Errorf("Hook env has %s", line)
+		}
+	}
+	if !strings.Contains(string(data), "SUM_EVENT="+EventCommitted+"\n") {
+		t.Errorf("Hook env = %q, want SUM_EVENT=%s", data, EventCommitted)
+	}
+}
+
+func TestEventsConfig_validate(t *testing.T) {
+	for webhook, valid := range map[string]bool{
+		"":                              true,
+		"http://localhost:8080/events":  true,
+		"http://127.0.0.1:8080/events":  true,
+		"https://[::1]/events":          true,
+		"https://console.example/hooks": false,
+		"http://10.0.0.1:8080/events":   false,
+		"file:///etc/passwd":            false,
+		"ftp://localhost/events":        false,
+		"localhost:8080":                false,
+	} {
+		if err := (EventsConfig{Webhook: webhook}).validate(); (err == nil) != valid {
+			t.Errorf("validate(%q) error = %v, want valid %v", webhook, err, valid)
+		}
+	}
+}
+
+func TestInstall_events(t *testing.T) {
+	plugins := map[string]string{
+		"A/a.preinstall": "Description=Pre install\nExecStart=/bin/false\n",
+		"A/a.install":    "Description=Install\nExecStart=/bin/true\n",
+	}
+	library, cleanup := setupTestEnv(t, plugins)
+	defer cleanup()
+	defer resetEvents()
+	socket, rec := listenEvents(t, filepath.Dir(library))
+	writeTestConfig(t, library, "events:\n  socket: "+socket+"\n")
+	resetEvents()
+
+	j, _ := LoadJournal()
+	if err := j.begin("install", "", ""); err != nil {
+		t.Fatalf("begin() error = %v", err)
+	}
+	status := j.newStatus()
+	Install(&status, library)
+	flushEvents()
+
+	want := []string{EventPhaseStarted, EventPluginFailed, EventPhaseFinished}
+	for i := 0; i < 100 && len(rec.types()) < len(want); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	got := rec.types()
+	if len(got) != len(want) {
+		t.Fatalf("Install() events = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Install() events = %v, want %v", got, want)
+		}
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	if last := rec.events[2]; last.Phase != PhaseInstall || last.Status != dStatusFail ||
+		last.ErrorCode != errcode.PluginFailed {
+		t.Errorf("Install() %s event = %+v", EventPhaseFinished, last)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/VeritasOS/plugin-manager/config"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/plugin-manager/utils/output"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// historyFileName is the file in the state dir where the operations are
+// 	recorded, one JSON document per line.
+// INFO: The history is only ever appended to, so that it's not lost when
+// 	the journal is reset by a new install.
+const historyFileName = "history.json"
+
+// HistoryRecord is the record of an operation run on the node.
+type HistoryRecord struct {
+	Operation       string
+	SoftwareName    string `yaml:",omitempty" json:",omitempty"`
+	SoftwareType    string `yaml:",omitempty" json:",omitempty"`
+	SoftwareVersion string `yaml:",omitempty" json:",omitempty"`
+	SoftwareRelease string `yaml:",omitempty" json:",omitempty"`
+	// ProductVersion is the version of the product being updated, and
+	// 	MatchedVersion is the product-version entry of the software's
+	// 	compatibility info that matched it.
+	ProductVersion string `yaml:",omitempty" json:",omitempty"`
+	MatchedVersion string `yaml:",omitempty" json:",omitempty"`
+	RunID          string `yaml:",omitempty" json:",omitempty"`
+	Started        time.Time
+	Ended          time.Time
+	// Status is the outcome of the operation, and State is the state of
+	// 	the update after the operation.
+	Status string
+	State  State
+	// Logs are the log files of the operation, including those of the
+	// 	`sum` commands run by its scripts.
+	Logs []string `yaml:",omitempty" json:",omitempty"`
+}
+
+func getHistoryPath() string {
+	return filepath.FromSlash(stateDir + historyFileName)
+}
+
+// recordHistory appends the record of the operation of the journal, which
+// 	started at the specified time, to the history.
+func (j *Journal) recordHistory(operation string, started time.Time, succeeded bool) error {
+	log.Printf("Entering update::Journal::recordHistory(%s, %s, %v)", operation, started, succeeded)
+	defer log.Println("Exiting update::Journal::recordHistory")
+
+	now := time.Now()
+	rec := HistoryRecord{
+		Operation:       operation,
+		SoftwareName:    j.SoftwareName,
+		SoftwareType:    j.SoftwareType,
+		SoftwareVersion: j.SoftwareVersion,
+		SoftwareRelease: j.SoftwareRelease,
+		ProductVersion:  j.ProductVersion,
+		MatchedVersion:  j.MatchedVersion,
+		RunID:           j.RunID,
+		Started:         started,
+		Ended:           now,
+		Status:          dStatusOk,
+		State:           j.State,
+		Logs:            findLogs(operation, started),
+	}
+	if !succeeded {
+		rec.Status = dStatusFail
+		if getInterruption() != nil {
+			rec.Status = dStatusInterrupted
+		}
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("json.Marshal(%+v); Error: %s", rec, err.Error())
+		return err
+	}
+
+	path := getHistoryPath()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		log.Printf("os.OpenFile(%s); Error: %s", path, err.Error())
+		return logutil.PrintNLogError("Failed to record the %s in the update history.", operation)
+	}
+	defer f.Close()
+	if _, err = f.Write(append(data, '\n')); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		log.Printf("Failed to write to %s. Error: %s", path, err.Error())
+		return logutil.PrintNLogError("Failed to record the %s in the update history.", operation)
+	}
+	return nil
+}
+
+// findLogs returns the log files of the operation i.e., the log files of
+// 	the operation's command, and of the command of this process (Ex: the
+// 	`resume` of the operation), that were written since it started.
+func findLogs(operation string, since time.Time) []string {
+	logDir := config.GetLogDir()
+	files, err := ioutil.ReadDir(logDir)
+	if err != nil {
+		log.Printf("ioutil.ReadDir(%s); Error: %s", logDir, err.Error())
+		return nil
+	}
+	prefixes := []string{operation + "."}
+	if logFile := config.GetLogFile(); logFile != "" && logFile != operation {
+		prefixes = append(prefixes, logFile+".")
+	}
+	logs := []string{}
+	for _, f := range files {
+		if !f.Mode().IsRegular() || !strings.HasSuffix(f.Name(), ".log") ||
+			f.ModTime().Before(since) {
+			continue
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(f.Name(), prefix) {
+				logs = append(logs, filepath.Join(logDir, f.Name()))
+				break
+			}
+		}
+	}
+	return logs
+}
+
+// operationStarted returns the time when the operation last started.
+func (j *Journal) operationStarted(operation string) time.Time {
+	running := operationStates[operation].running
+	for i := len(j.Transitions) - 1; i >= 0; i-- {
+		if j.Transitions[i].To == running {
+			return j.Transitions[i].Time
+		}
+	}
+	return j.Started
+}
+
+// GetHistory returns the operations recorded in the history, oldest first,
+// 	of the specified software type (if any) that started since the
+// 	specified time.
+func GetHistory(swType string, since time.Time) ([]HistoryRecord, error) {
+	log.Printf("Entering update::GetHistory(%s, %s)", swType, since)
+	defer log.Println("Exiting update::GetHistory")
+
+	records := []HistoryRecord{}
+	path := getHistoryPath()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		log.Printf("os.Open(%s); Error: %s", path, err.Error())
+		return records, logutil.PrintNLogError("Failed to read the update history.")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec HistoryRecord
+		// INFO: A record left partially written by a crash is skipped.
+		if err = json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			log.Printf("Skipping the invalid record %q of %s. Error: %s",
+				scanner.Text(), path, err.Error())
+			continue
+		}
+		if swType != "" && !strings.EqualFold(swType, rec.SoftwareType) {
+			continue
+		}
+		if rec.Started.Before(since) {
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err = scanner.Err(); err != nil {
+		log.Printf("Failed to read %s. Error: %s", path, err.Error())
+		return records, logutil.PrintNLogError("Failed to read the update history.")
+	}
+	return records, nil
+}
+
+// parseSince parses the -since option, which is either a duration before
+// 	now (Ex: 720h), or a time in any of the scheduleTimeLayouts or a date.
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", since, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := parseScheduleTime(since); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid -since %q, expected a duration "+
+		"(Ex: 720h), a date (Ex: 2021-06-01) or a time (Ex: 2021-06-01T10:00)", since)
+}
+
+// runHistoryCommand writes the history of the operations.
+func runHistoryCommand(args []string) error {
+	log.Printf("Entering update::runHistoryCommand(%v)", args)
+	defer log.Println("Exiting update::runHistoryCommand")
+
+	if err := cmdOptions.historyCmd.Parse(args); err != nil {
+		return errcode.New(errcode.InvalidUsage, "history command arguments parse error: %s", err.Error())
+	}
+	since, err := parseSince(cmdOptions.since, time.Now())
+	if err != nil {
+		return errcode.New(errcode.InvalidUsage, "Invalid usage. %s.", err.Error())
+	}
+	records, err := GetHistory(cmdOptions.softwareType, since)
+	if err != nil {
+		return err
+	}
+	return output.Write(records)
+}
+
+// registerCommandHistory registers history command and its options
+func registerCommandHistory(progname string) {
+	log.Printf("Entering update::registerCommandHistory(%s)", progname)
+	defer log.Println("Exiting update::registerCommandHistory")
+
+	cmdOptions.historyCmd = flag.NewFlagSet(progname+" history", flag.PanicOnError)
+	cmdOptions.historyCmd.StringVar(
+		&cmdOptions.softwareType,
+		"type",
+		"",
+		"Type of the software.",
+	)
+	cmdOptions.historyCmd.StringVar(
+		&cmdOptions.since,
+		"since",
+		"",
+		"List the operations started since the time (ex: 2021-06-01) or "+
+			"the duration before now (ex: 720h).",
+	)
+	output.RegisterCommandOptions(cmdOptions.historyCmd, map[string]string{"output-format": "yaml"})
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"github.com/VeritasOS/plugin-manager/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournal_recordHistory(t *testing.T) {
+	_, cleanup := setupTestEnv(t, nil)
+	defer cleanup()
+	logDir := config.GetLogDir()
+	os.MkdirAll(logDir, 0755)
+	defer func(logFile string) { config.SetLogFile(logFile) }(config.GetLogFile())
+	config.SetLogFile("install")
+
+	j, _ := LoadJournal()
+	if err := j.begin("install", "a-2.0.0-1.x86_64.rpm", "asum"); err != nil {
+		t.Fatalf("begin() error = %v", err)
+	}
+	j.SoftwareVersion = "2.0.0"
+	j.ProductVersion = "1.0.0"
+	j.save()
+	installLog := filepath.Join(logDir, "install.2021-06-01T10:00:00Z.log")
+	ioutil.WriteFile(installLog, []byte("install\n"), 0644)
+	// Logs of the other commands, and of the earlier operations are not
+	// 	the logs of the install.
+	ioutil.WriteFile(filepath.Join(logDir, "status.2021-06-01T10:00:00Z.log"), []byte("status\n"), 0644)
+	oldLog := filepath.Join(logDir, "install.2021-05-01T10:00:00Z.log")
+	ioutil.WriteFile(oldLog, []byte("install\n"), 0644)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(oldLog, old, old)
+	if err := j.end("install", true); err != nil {
+		t.Fatalf("end() error = %v", err)
+	}
+
+	config.SetLogFile("rollback")
+	if err := j.begin("rollback", "", ""); err != nil {
+		t.Fatalf("begin() error = %v", err)
+	}
+	if err := j.end("rollback", false); err != nil {
+		t.Fatalf("end() error = %v", err)
+	}
+
+	records, err := GetHistory("", time.Time{})
+	if err != nil {
+		t.Fatalf("GetHistory() error = %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("GetHistory() = %+v, want 2 records", records)
+	}
+	install := records[0]
+	if install.Operation != "install" || install.Status != dStatusOk ||
+		install.State != StateInstalled || install.SoftwareName != "a-2.0.0-1.x86_64.rpm" ||
+		install.SoftwareVersion != "2.0.0" || install.ProductVersion != "1.0.0" ||
+		install.RunID == "" || install.Ended.Before(install.Started) {
+		t.Errorf("GetHistory() install = %+v", install)
+	}
+	if len(install.Logs) != 1 || install.Logs[0] != installLog {
+		t.Errorf("GetHistory() install logs = %v, want [%s]", install.Logs, installLog)
+	}
+	if rb := records[1]; rb.Operation != "rollback" || rb.Status != dStatusFail ||
+		rb.State != StateFailed || rb.SoftwareType != "asum" {
+		t.Errorf("GetHistory() rollback = %+v", rb)
+	}
+
+	if records, _ = GetHistory("other", time.Time{}); len(records) != 0 {
+		t.Errorf("GetHistory(other) = %+v, want none", records)
+	}
+	if records, _ = GetHistory("", time.Now()); len(records) != 0 {
+		t.Errorf("GetHistory(since now) = %+v, want none", records)
+	}
+}
+
+func TestGetHistory_partialRecord(t *testing.T) {
+	_, cleanup := setupTestEnv(t, nil)
+	defer cleanup()
+
+	os.MkdirAll(filepath.Dir(getHistoryPath()), 0755)
+	data := `{"Operation":"install","Status":"Succeeded"}` + "\n" + `{"Operation":"comm`
+	ioutil.WriteFile(getHistoryPath(), []byte(data), 0644)
+	records, err := GetHistory("", time.Time{})
+	if err != nil || len(records) != 1 || records[0].Operation != "install" {
+		t.Errorf("GetHistory() = %+v, %v, want the install record", records, err)
+	}
+}
+
+func Test_parseSince(t *testing.T) {
+	now := time.Date(2021, 6, 5, 10, 0, 0, 0, time.Local)
+	tests := []struct {
+		since   string
+		want    time.Time
+		wantErr bool
+	}{
+		{since: "", want: time.Time{}},
+		{since: "48h", want: now.Add(-48 * time.Hour)},
+		{since: "2021-06-01", want: time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local)},
+		{since: "2021-06-01T10:30", want: time.Date(2021, 6, 1, 10, 30, 0, 0, time.Local)},
+		{since: "last week", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSince(tt.since, now)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseSince(%q) = %v, %v, want %v", tt.since, got, err, tt.want)
+		}
+	}
+}
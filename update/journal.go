@@ -0,0 +1,471 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"fmt"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/software-update-manager/repo"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"github.com/VeritasOS/software-update-manager/utils/fsutil"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultStateDir is the location where SUM persists the update state.
+const DefaultStateDir = "/var/lib/sum/"
+
+// journalFileName is the name of the update state journal in the state dir.
+const journalFileName = "journal.yaml"
+
+// bootIDFile contains a random ID that is regenerated on every boot.
+const bootIDFile = "/proc/sys/kernel/random/boot_id"
+
+// runIDEnv is the environment variable that carries the ID of the operation
+// 	run to the child processes, so that a `sum` invoked by the operation's
+// 	scripts is recognized as part of the same run.
+const runIDEnv = "SUM_RUN_ID"
+
+var stateDir = DefaultStateDir
+
+// GetStateDir returns the location where the update state is persisted.
+func GetStateDir() string {
+	return stateDir
+}
+
+// SetStateDir sets the location where the update state is persisted.
+func SetStateDir(dir string) {
+	stateDir = filepath.Clean(dir) + string(os.PathSeparator)
+}
+
+// State is the phase of the update workflow that a node is in.
+type State string
+
+// States of the update workflow.
+const (
+	StateIdle           State = "idle"
+	StateInstalling     State = "installing"
+	StateInstalled      State = "installed"
+	StateRebooting      State = "rebooting"
+	StatePostReboot     State = "post-reboot"
+	StateAwaitingCommit State = "awaiting-commit"
+	StateCommitting     State = "committing"
+	StateCommitted      State = "committed"
+	StateRollingBack    State = "rolling-back"
+	// StateRollbackRebooting is when the node is restarting into the previous
+	// 	version as part of the rollback.
+	StateRollbackRebooting State = "rollback-rebooting"
+	StateRolledBack        State = "rolled-back"
+	StateFailed            State = "failed"
+	// StateInterrupted is when the operation was stopped by a signal, and
+	// 	could be resumed.
+	StateInterrupted State = "interrupted"
+)
+
+// transitions lists the states that can be moved into from a given state.
+// INFO: A reboot is allowed while installing, as the install plugins are
+// 	expected to call `sum reboot` as their last step when the update
+// 	requires a restart.
+var transitions = map[State][]State{
+	StateIdle:              {StateInstalling},
+	StateInstalling:        {StateInstalled, StateRebooting, StateFailed, StateInterrupted},
+	StateInstalled:         {StateRebooting, StateCommitting, StateRollingBack},
+	StateRebooting:         {StatePostReboot, StateFailed, StateInterrupted},
+	StatePostReboot:        {StateAwaitingCommit, StateFailed, StateInterrupted},
+	StateAwaitingCommit:    {StateCommitting, StateRollingBack},
+	StateCommitting:        {StateCommitted, StateFailed, StateInterrupted},
+	StateCommitted:         {StateInstalling},
+	StateRollingBack:       {StateRolledBack, StateRollbackRebooting, StateFailed, StateInterrupted},
+	StateRollbackRebooting: {StateRollingBack, StateFailed},
+	StateRolledBack:        {StateInstalling},
+	// INFO: From failed and interrupted, only the failed operation can be
+	// 	run again, or the update can be rolled back.
+	StateFailed:      {StateInstalling, StateRebooting, StateCommitting, StateRollingBack},
+	StateInterrupted: {StateInstalling, StateRebooting, StateCommitting, StateRollingBack},
+}
+
+// operationStates maps an operation to the state it runs in, and the state
+// 	it moves to on success.
+var operationStates = map[string]struct {
+	running State
+	done    State
+}{
+	"install": {StateInstalling, StateInstalled},
+	// INFO: On success, the node is restarting, and the reboot completes
+	// 	only when the node comes back up.
+	"reboot":     {StateRebooting, StateRebooting},
+	"postreboot": {StatePostReboot, StateAwaitingCommit},
+	"commit":     {StateCommitting, StateCommitted},
+	"rollback":   {StateRollingBack, StateRolledBack},
+}
+
+// Transition is a record of the state change in the journal.
+type Transition struct {
+	From State
+	To   State
+	Time time.Time
+}
+
+// Journal is the persistent record of the update workflow state.
+type Journal struct {
+	State     State
+	Operation string `yaml:",omitempty"`
+	RunID     string `yaml:"run-id,omitempty"`
+	// FailedOperation is the operation that failed or was interrupted, when
+	// 	the update is failed or interrupted.
+	FailedOperation string `yaml:"failed-operation,omitempty"`
+	// PID is the process running the operation, and is used to detect
+	// 	whether the operation got interrupted.
+	PID          int    `yaml:",omitempty"`
+	SoftwareName string `yaml:"software-name,omitempty"`
+	SoftwareType string `yaml:"software-type,omitempty"`
+	SoftwareRepo string `yaml:"software-repo,omitempty"`
+	// SoftwareVersion & SoftwareRelease are known only when the operation
+	// 	is run on the software from the repository.
+	SoftwareVersion string `yaml:"software-version,omitempty"`
+	SoftwareRelease string `yaml:"software-release,omitempty"`
+	// ProductVersion is the version of the product being updated, and
+	// 	MatchedVersion is the product-version entry of the software's
+	// 	compatibility info that matched it.
+	ProductVersion string `yaml:"product-version,omitempty"`
+	MatchedVersion string `yaml:"matched-version,omitempty"`
+	// Operations contains the details of install, rollback & commit of the
+	// 	software for the matched version.
+	Operations map[string]repo.OperationInfo `yaml:",omitempty"`
+	BootID     string                        `yaml:"boot-id,omitempty"`
+	// Library is the plugins library of the reboot operation, which is used
+	// 	to run the post-reboot plugins.
+	Library string `yaml:",omitempty"`
+	// AutoRollback indicates whether to roll back the update when the
+	// 	post-reboot actions fail.
+	AutoRollback bool `yaml:"auto-rollback,omitempty"`
+	// RollbackOnInterrupt indicates whether to run the failure handler of
+	// 	the phase when the operation is interrupted by a signal, and Signal
+	// 	is the signal that interrupted the last operation.
+	RollbackOnInterrupt bool   `yaml:"rollback-on-interrupt,omitempty"`
+	Signal              string `yaml:",omitempty"`
+	// AutoReboot & AutoCommit indicate whether the install continues onto
+	// 	the reboot and the commit of the update, and SoakPeriod is the time
+	// 	to wait after the post-reboot actions before committing, which ends
+	// 	at SoakEnds.
+	AutoReboot bool          `yaml:"auto-reboot,omitempty"`
+	AutoCommit bool          `yaml:"auto-commit,omitempty"`
+	SoakPeriod time.Duration `yaml:"soak-period,omitempty"`
+	SoakEnds   time.Time     `yaml:"soak-ends,omitempty"`
+	// OutputFile & OutputFormat are the output options of the install, where
+	// 	the combined results of the chained operations are written.
+	OutputFile   string `yaml:"output-file,omitempty"`
+	OutputFormat string `yaml:"output-format,omitempty"`
+	// Deadline is the time by which the running operation must complete.
+	Deadline    time.Time `yaml:",omitempty"`
+	Started     time.Time
+	Updated     time.Time
+	Transitions []Transition `yaml:",omitempty"`
+}
+
+func getJournalPath() string {
+	return filepath.FromSlash(stateDir + journalFileName)
+}
+
+func getBootID() string {
+	id, err := ioutil.ReadFile(bootIDFile)
+	if err != nil {
+		log.Printf("ioutil.ReadFile(%s); Error: %s", bootIDFile, err.Error())
+		return ""
+	}
+	return strings.TrimSpace(string(id))
+}
+
+// LoadJournal reads the update state journal. If there is no journal, then
+// 	node is considered to be idle.
+func LoadJournal() (*Journal, error) {
+	log.Println("Entering update::LoadJournal")
+	defer log.Println("Exiting update::LoadJournal")
+
+	j := Journal{State: StateIdle}
+	path := getJournalPath()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &j, nil
+	}
+	if err != nil {
+		log.Printf("ioutil.ReadFile(%s); Error: %s", path, err.Error())
+		return &j, logutil.PrintNLogError("Failed to read the update journal.")
+	}
+	if err = yaml.Unmarshal(data, &j); err != nil {
+		log.Printf("yaml.Unmarshal(%s); Error: %s", path, err.Error())
+		return &j, logutil.PrintNLogError("Failed to parse the update journal %s.", path)
+	}
+	if j.State == "" {
+		j.State = StateIdle
+	}
+	return &j, nil
+}
+
+// save writes the journal atomically to the state dir.
+func (j *Journal) save() error {
+	out, err := yaml.Marshal(j)
+	if err != nil {
+		log.Printf("yaml.Marshal(%+v); Error: %s", j, err.Error())
+		return err
+	}
+	if err = fsutil.WriteFileAtomic(getJournalPath(), out, 0644); err != nil {
+		return logutil.PrintNLogError("Failed to write the update journal.")
+	}
+	return nil
+}
+
+// CanTransition tells whether the journal can move into the specified state.
+func (j *Journal) CanTransition(to State) bool {
+	if (j.State == StateFailed || j.State == StateInterrupted) && to != StateRollingBack &&
+		to != operationStates[j.FailedOperation].running {
+		return false
+	}
+	for _, s := range transitions[j.State] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves the journal into the specified state and persists it.
+func (j *Journal) Transition(to State) error {
+	log.Printf("Entering update::Journal::Transition(%s -> %s)", j.State, to)
+	defer log.Println("Exiting update::Journal::Transition")
+
+	if !j.CanTransition(to) {
+		return errcode.New(errcode.InvalidState, "Invalid update state transition from "+
+			"'%s' to '%s'.", j.State, to)
+	}
+	now := time.Now()
+	j.Transitions = append(j.Transitions, Transition{From: j.State, To: to, Time: now})
+	j.State = to
+	j.Updated = now
+	j.FailedOperation = ""
+	if to == StateFailed || to == StateInterrupted {
+		j.FailedOperation = j.Operation
+	}
+	if err := j.save(); err != nil {
+		return err
+	}
+	switch to {
+	case StateCommitted:
+		emitEvent(j.event(EventCommitted))
+	case StateRolledBack:
+		emitEvent(j.event(EventRolledBack))
+	}
+	return nil
+}
+
+// isNested tells whether the specified operation is being run by the
+// 	scripts of the same operation (Ex: `sum install -filename` runs the
+// 	install script of the RPM, which in turn runs `sum install`).
+func (j *Journal) isNested(operation string) bool {
+	return j.RunID != "" && j.Operation == operation &&
+		os.Getenv(runIDEnv) == j.RunID
+}
+
+// begin moves the journal into the running state of the operation.
+func (j *Journal) begin(operation, swName, swType string) error {
+	log.Printf("Entering update::Journal::begin(%s, %s, %s)", operation, swName, swType)
+	defer log.Println("Exiting update::Journal::begin")
+
+	opStates, ok := operationStates[operation]
+	if !ok {
+		return fmt.Errorf("unknown update operation %s", operation)
+	}
+	if !j.CanTransition(opStates.running) {
+		err := &StateError{Operation: operation, State: j.State}
+		logutil.PrintNLogError("%s", err.Error())
+		return err
+	}
+
+	now := time.Now()
+	if opStates.running == StateInstalling {
+		// A new install starts a fresh update cycle.
+		j.Transitions = nil
+		j.Started = now
+		j.SoftwareName = ""
+		j.SoftwareType = ""
+		j.SoftwareRepo = ""
+		j.SoftwareVersion = ""
+		j.SoftwareRelease = ""
+		j.ProductVersion = ""
+		j.MatchedVersion = ""
+		j.Operations = nil
+		j.Library = ""
+		j.AutoRollback = false
+		j.RollbackOnInterrupt = false
+		j.AutoReboot = false
+		j.AutoCommit = false
+		j.SoakPeriod = 0
+		j.SoakEnds = time.Time{}
+		j.OutputFile = ""
+		j.OutputFormat = ""
+		if err := clearRuns(); err != nil {
+			return logutil.PrintNLogError("Failed to clear the previous update details.")
+		}
+		if err := clearCheckpoints(); err != nil {
+			return logutil.PrintNLogError("Failed to clear the previous update details.")
+		}
+	}
+	if swName != "" {
+		j.SoftwareName = swName
+		j.SoftwareType = swType
+	}
+	j.Operation = operation
+	j.Signal = ""
+	j.setRunID(now)
+	j.BootID = getBootID()
+	j.setDeadline()
+
+	return j.Transition(opStates.running)
+}
+
+// setRunID assigns a new run to the operation, and passes it on to the child
+// 	processes.
+func (j *Journal) setRunID(now time.Time) {
+	j.PID = os.Getpid()
+	j.RunID = fmt.Sprintf("%d-%d", now.Unix(), j.PID)
+	os.Setenv(runIDEnv, j.RunID)
+}
+
+// isInterrupted tells whether the operation was stopped by a signal, or is
+// 	shown as running, but the process running it no longer exists.
+func (j *Journal) isInterrupted() bool {
+	if j.State == StateInterrupted {
+		return true
+	}
+	if !j.isRunning() {
+		return false
+	}
+	if j.PID <= 0 {
+		return true
+	}
+	// INFO: Signal 0 only checks whether the process exists.
+	err := syscall.Kill(j.PID, syscall.Signal(0))
+	return err != nil && err != syscall.EPERM
+}
+
+// resume takes over the interrupted operation, so that it can be continued
+// 	from where it stopped.
+func (j *Journal) resume(operation string) error {
+	log.Printf("Entering update::Journal::resume(%s)", operation)
+	defer log.Println("Exiting update::Journal::resume")
+
+	opStates := operationStates[operation]
+	if j.Operation != operation ||
+		(j.State != opStates.running && j.State != StateInterrupted) {
+		return errcode.New(errcode.InvalidState, "There is no interrupted %s to resume. "+
+			"Update is %s.", operation, j.State)
+	}
+	if !j.isInterrupted() {
+		return errcode.New(errcode.InvalidState, "Cannot resume %s as it is still running "+
+			"(PID %d).", operation, j.PID)
+	}
+	if j.State == StateInterrupted && len(j.Transitions) > 0 {
+		// INFO: Undo the interruption, so that the operation continues
+		// 	from the state it was stopped in.
+		last := j.Transitions[len(j.Transitions)-1]
+		j.Transitions = j.Transitions[:len(j.Transitions)-1]
+		j.State = last.From
+		j.FailedOperation = ""
+	}
+
+	now := time.Now()
+	j.setRunID(now)
+	j.BootID = getBootID()
+	j.setDeadline()
+	j.Updated = now
+	return j.save()
+}
+
+// setSoftwareInfo records the details of the software that's being updated.
+func (j *Journal) setSoftwareInfo(info repo.RPMInfo) error {
+	j.SoftwareVersion = info.GetRPMVersion()
+	j.SoftwareRelease = info.GetRPMRelease()
+	j.MatchedVersion = info.GetMatchedVersion()
+	j.Operations = map[string]repo.OperationInfo{}
+	for _, op := range []string{"install", "rollback", "commit"} {
+		j.Operations[op] = info.GetOperationInfo(op)
+	}
+	// INFO: The timeout of the operation could be based on the estimate of
+	// 	the software, which is known only now.
+	j.setDeadline()
+	j.Updated = time.Now()
+	return j.save()
+}
+
+// getOperationInfo returns the details of the specified operation of the
+// 	software that's being updated.
+func (j *Journal) getOperationInfo(operation string) repo.OperationInfo {
+	return j.Operations[operation]
+}
+
+// isRunning tells whether an operation is in progress.
+func (j *Journal) isRunning() bool {
+	for _, opStates := range operationStates {
+		if j.State == opStates.running {
+			return true
+		}
+	}
+	return false
+}
+
+// end moves the journal into the final state of the operation based on
+// 	whether the operation succeeded.
+func (j *Journal) end(operation string, succeeded bool) error {
+	log.Printf("Entering update::Journal::end(%s, %v)", operation, succeeded)
+	defer log.Println("Exiting update::Journal::end")
+
+	opStates := operationStates[operation]
+
+	// INFO: Reload the journal, as the operation might have invoked another
+	// 	`sum` operation that moved the workflow to another state.
+	cur, err := LoadJournal()
+	if err != nil {
+		return err
+	}
+	*j = *cur
+	started := j.operationStarted(operation)
+	// INFO: Failing to record the history should not fail the operation, so
+	// 	the error is only reported.
+	defer j.recordHistory(operation, started, succeeded)
+	if j.State != opStates.running {
+		log.Printf("Update state moved from %s to %s during %s. "+
+			"Leaving the state as is.", opStates.running, j.State, operation)
+		return nil
+	}
+
+	j.Deadline = time.Time{}
+	to := StateFailed
+	if succeeded {
+		to = opStates.done
+	} else if sig := getInterruption(); sig != nil {
+		j.Signal = sig.String()
+		if isLeftForResume(j.RollbackOnInterrupt) {
+			logutil.PrintNLog("The %s operation is interrupted. Run `sum resume` "+
+				"to continue it.\n", operation)
+			to = StateInterrupted
+		}
+	}
+	if to == j.State {
+		return j.save()
+	}
+	return j.Transition(to)
+}
+
+// setLibrary records the plugins library of the operation.
+func (j *Journal) setLibrary(library string) error {
+	j.Library = library
+	j.Updated = time.Now()
+	return j.save()
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestJournal_Transition(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sum-state")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(tmpDir)
+	SetStateDir(tmpDir)
+	defer SetStateDir(DefaultStateDir)
+
+	tests := []struct {
+		name     string
+		from     State
+		failedOp string
+		to       State
+		wantErr  bool
+	}{
+		{name: "Install from idle", from: StateIdle, to: StateInstalling},
+		{name: "Installed", from: StateInstalling, to: StateInstalled},
+		{name: "Reboot while installing", from: StateInstalling, to: StateRebooting},
+		{name: "Commit after install", from: StateInstalled, to: StateCommitting},
+		{name: "Commit from idle", from: StateIdle, to: StateCommitting, wantErr: true},
+		{name: "Rollback after commit", from: StateCommitted, to: StateRollingBack, wantErr: true},
+		{name: "Reboot after commit", from: StateCommitted, to: StateRebooting, wantErr: true},
+		{name: "Rollback after failure", from: StateFailed, to: StateRollingBack},
+		{name: "Retry failed install", from: StateFailed, failedOp: "install", to: StateInstalling},
+		{name: "Commit after failed install", from: StateFailed, failedOp: "install",
+			to: StateCommitting, wantErr: true},
+		{name: "Commit after interrupted install", from: StateInterrupted, failedOp: "install",
+			to: StateCommitting, wantErr: true},
+		{name: "Retry failed commit", from: StateFailed, failedOp: "commit", to: StateCommitting},
+		{name: "Install after failed commit", from: StateFailed, failedOp: "commit",
+			to: StateInstalling, wantErr: true},
+		{name: "Retry failed reboot", from: StateFailed, failedOp: "reboot", to: StateRebooting},
+		{name: "Commit after failed post-reboot", from: StateFailed, failedOp: "postreboot",
+			to: StateCommitting, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &Journal{State: tt.from, FailedOperation: tt.failedOp}
+			err := j.Transition(tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Transition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got, err := LoadJournal()
+			if err != nil {
+				t.Fatalf("LoadJournal() error = %v", err)
+			}
+			if !tt.wantErr && got.State != tt.to {
+				t.Errorf("LoadJournal() state = %v, want %v", got.State, tt.to)
+			}
+		})
+	}
+}
+
+func TestJournal_beginEnd(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sum-state")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(tmpDir)
+	SetStateDir(tmpDir)
+	defer SetStateDir(DefaultStateDir)
+	defer os.Unsetenv(runIDEnv)
+
+	j, err := LoadJournal()
+	if err != nil {
+		t.Fatalf("LoadJournal() error = %v", err)
+	}
+	if j.State != StateIdle {
+		t.Fatalf("LoadJournal() state = %v, want %v", j.State, StateIdle)
+	}
+	if err = j.begin("commit", "", ""); err == nil {
+		t.Fatalf("begin(commit) on idle node must fail")
+	}
+	if code := errcode.Of(err); code != errcode.InvalidState {
+		t.Errorf("begin(commit) on idle node error code = %v, want %v",
+			code, errcode.InvalidState)
+	}
+	if err = j.begin("install", "a.rpm", "update"); err != nil {
+		t.Fatalf("begin(install) error = %v", err)
+	}
+	if !j.isNested("install") {
+		t.Errorf("isNested(install) = false, want true")
+	}
+	if j.isNested("reboot") {
+		t.Errorf("isNested(reboot) = true, want false")
+	}
+	if err = j.end("install", true); err != nil {
+		t.Fatalf("end(install) error = %v", err)
+	}
+	if j.State != StateInstalled || j.SoftwareName != "a.rpm" {
+		t.Errorf("Journal after install = %+v", j)
+	}
+	if err = j.begin("commit", "", ""); err != nil {
+		t.Fatalf("begin(commit) error = %v", err)
+	}
+	if err = j.end("commit", false); err != nil {
+		t.Fatalf("end(commit) error = %v", err)
+	}
+	if j.State != StateFailed {
+		t.Errorf("Journal state after failed commit = %v, want %v", j.State, StateFailed)
+	}
+}
+
+func TestJournal_commitAfterFailedInstall(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sum-state")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(tmpDir)
+	SetStateDir(tmpDir)
+	defer SetStateDir(DefaultStateDir)
+	defer os.Unsetenv(runIDEnv)
+
+	j, _ := LoadJournal()
+	if err = j.begin("install", "a.rpm", "update"); err != nil {
+		t.Fatalf("begin(install) error = %v", err)
+	}
+	if err = j.end("install", false); err != nil {
+		t.Fatalf("end(install) error = %v", err)
+	}
+	if j.State != StateFailed || j.FailedOperation != "install" {
+		t.Fatalf("Journal after failed install = %s, %s, want %s, install",
+			j.State, j.FailedOperation, StateFailed)
+	}
+	err = j.begin("commit", "", "")
+	if code := errcode.Of(err); code != errcode.InvalidState {
+		t.Errorf("begin(commit) after failed install code = %v, want %v", code, errcode.InvalidState)
+	}
+	if err = j.begin("install", "a.rpm", "update"); err != nil {
+		t.Errorf("begin(install) after failed install error = %v", err)
+	}
+	if j.FailedOperation != "" {
+		t.Errorf("Journal failed operation = %s, want none", j.FailedOperation)
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"flag"
+	"fmt"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/software-update-manager/repo"
+	"github.com/VeritasOS/software-update-manager/utils/rpm"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PluginPlan is a plugin that would be run by an operation.
+type PluginPlan struct {
+	FileName    string
+	Description string
+	Requires    []string `yaml:",omitempty" json:",omitempty"`
+	RequiredBy  []string `yaml:",omitempty" json:",omitempty"`
+
+	// execStart is the command run by the plugin.
+	execStart string
+}
+
+// PluginTypePlan is the list of plugins of a plugin type in the dependency
+// 	order i.e., a plugin is listed after all the plugins it requires.
+type PluginTypePlan struct {
+	Type      string
+	Plugins   []PluginPlan `yaml:",omitempty" json:",omitempty"`
+	StdOutErr string       `yaml:",omitempty" json:",omitempty"`
+}
+
+// Plan is the list of actions that an operation would perform, which is
+// 	reported instead of running the operation when `-dry-run` is specified.
+type Plan struct {
+	Operation       string
+	Library         string
+	SoftwareName    string `yaml:",omitempty" json:",omitempty"`
+	SoftwareType    string `yaml:",omitempty" json:",omitempty"`
+	SoftwareVersion string `yaml:",omitempty" json:",omitempty"`
+	SoftwareRelease string `yaml:",omitempty" json:",omitempty"`
+	// MatchedVersion is the product-version entry of the software's
+	// 	compatibility info that matched, and OperationInfo is its details of
+	// 	the operation.
+	MatchedVersion string              `yaml:",omitempty" json:",omitempty"`
+	OperationInfo  *repo.OperationInfo `yaml:",omitempty" json:",omitempty"`
+	PluginTypes    []PluginTypePlan
+	// RestartAfter is the plugin type after which the node is restarted.
+	RestartAfter string `yaml:",omitempty" json:",omitempty"`
+	// OnFailure are the plugin types run when the operation fails, as per
+	// 	the FailurePolicy.
+	OnFailure     []PluginTypePlan `yaml:",omitempty" json:",omitempty"`
+	FailurePolicy string           `yaml:",omitempty" json:",omitempty"`
+}
+
+// DryRun returns the plan of the specified operation without running any of
+// 	its plugins or scripts. When the software name is specified in params,
+// 	the plan is of the software in the repository. Otherwise, it's of the
+// 	plugins in the specified library.
+func DryRun(operation, library string, params map[string]string) (Plan, error) {
+	log.Printf("Entering update::DryRun(%s, %s, %+v)", operation, library, params)
+	defer log.Println("Exiting update::DryRun")
+
+	plan := Plan{Operation: operation, Library: library}
+	var rpmInfo repo.RPMInfo
+	if swName := params["softwareName"]; swName != "" {
+		var cleanup func()
+		var err error
+		rpmInfo, plan.Library, cleanup, err = getRPMLibrary(swName,
+			params["softwareType"], params)
+		if err != nil {
+			return plan, err
+		}
+		defer cleanup()
+		plan.SoftwareName = swName
+		plan.SoftwareType = params["softwareType"]
+		plan.SoftwareVersion = rpmInfo.GetRPMVersion()
+		plan.SoftwareRelease = rpmInfo.GetRPMRelease()
+		plan.MatchedVersion = rpmInfo.GetMatchedVersion()
+		if operation != "reboot" {
+			opInfo := rpmInfo.GetOperationInfo(operation)
+			plan.OperationInfo = &opInfo
+		}
+	}
+
+	wf, err := LoadWorkflow(plan.Library)
+	if err != nil {
+		return plan, err
+	}
+	phase := wf.Phases[operation]
+	pluginTypes := wf.pluginTypes(operation)
+	restart := phase.reboots()
+	if operation == PhaseRollback {
+		restart = restart ||
+			(plan.OperationInfo != nil && plan.OperationInfo.RequiresRestart)
+	}
+	if restart && len(pluginTypes) != 0 {
+		plan.RestartAfter = pluginTypes[len(pluginTypes)-1]
+	}
+	if operation == PhaseRollback {
+		pluginTypes = append(pluginTypes, wf.pluginTypes(PhaseCompleteRollback)...)
+	}
+	plan.PluginTypes = getPluginTypesPlan(plan.Library, pluginTypes...)
+	plan.OnFailure = getPluginTypesPlan(plan.Library, phase.OnFailure...)
+	plan.FailurePolicy = phase.FailurePolicy
+
+	// INFO: The library of the software in the repository is reported as
+	// 	the location where it would be installed.
+	if rpmInfo != nil {
+		plan.Library = getScriptsDir(rpmInfo, params["softwareType"]) + "library"
+	}
+	return plan, nil
+}
+
+// getRPMLibrary returns the details and the plugins library of the specified
+// 	software in the repository. If the software is not installed, then it's
+// 	extracted into a temporary location, which is removed by the returned
+// 	cleanup function.
+func getRPMLibrary(swName, swType string, params map[string]string) (repo.RPMInfo, string, func(), error) {
+	log.Printf("Entering update::getRPMLibrary(%s, %s)", swName, swType)
+	defer log.Println("Exiting update::getRPMLibrary")
+
+	cleanup := func() {}
+	if swType == "" {
+		return nil, "", cleanup, logutil.PrintNLogError(
+			"Invalid usage. Software type must be specified.")
+	}
+	absSwPath := getSoftwarePath(swName, swType, params["softwareRepo"])
+	if _, err := os.Stat(absSwPath); err != nil {
+		log.Printf("os.Stat(%s); Error: %s", absSwPath, err.Error())
+		return nil, "", cleanup, logutil.PrintNLogError("%s software %s not found.",
+			swType, swName)
+	}
+	listInfo, err := repo.ListRPMFilesInfo([]string{absSwPath}, params["productVersion"])
+	if err != nil {
+		return nil, "", cleanup, err
+	}
+	if len(listInfo) != 1 {
+		log.Printf("Expected details of %s software, but got %+v.", swName, listInfo)
+		return nil, "", cleanup, logutil.PrintNLogError(
+			"Failed to get details of %s software.", swName)
+	}
+	rpmInfo := listInfo[0]
+
+	library := getScriptsDir(rpmInfo, swType) + "library"
+	if _, err = os.Stat(library); err == nil {
+		return rpmInfo, library, cleanup, nil
+	}
+
+	tmpDir, err := ioutil.TempDir("", "sum-dry-run")
+	if err != nil {
+		log.Printf("ioutil.TempDir(); Error: %s", err.Error())
+		return nil, "", cleanup, logutil.PrintNLogError(
+			"Failed to create a temporary location to extract %s.", swName)
+	}
+	cleanup = func() { os.RemoveAll(tmpDir) }
+	if err = rpm.Extract(absSwPath, tmpDir); err != nil {
+		cleanup()
+		return nil, "", func() {}, logutil.PrintNLogError(
+			"Failed to extract %s software.", swName)
+	}
+	return rpmInfo, filepath.Join(tmpDir, library), cleanup, nil
+}
+
+// getPluginTypesPlan returns the plugins of the specified plugin types in
+// 	the plugins library.
+func getPluginTypesPlan(library string, pluginTypes ...string) []PluginTypePlan {
+	plans := []PluginTypePlan{}
+	for _, pt := range pluginTypes {
+		plan, err := getPluginTypePlan(library, pt)
+		if err != nil {
+			plan.StdOutErr = err.Error()
+		}
+		plans = append(plans, plan)
+	}
+	return plans
+}
+
+// getPluginTypePlan returns the plugins of the specified type in the
+// 	dependency order, and the plugins independent of each other in the
+// 	lexical order.
+// NOTE: Plugin Manager runs a plugin only after all the plugins it requires
+// 	complete, but it runs the plugins independent of each other in
+// 	parallel, so their start order isn't fixed.
+func getPluginTypePlan(library, pluginType string) (PluginTypePlan, error) {
+	log.Printf("Entering update::getPluginTypePlan(%s, %s)", library, pluginType)
+	defer log.Println("Exiting update::getPluginTypePlan")
+
+	plan := PluginTypePlan{Type: pluginType}
+	plugins, err := readPlugins(library, pluginType)
+	if err != nil {
+		return plan, err
+	}
+
+	// INFO: A plugin's `RequiredBy` is same as the other plugin's `Requires`.
+	for file, p := range plugins {
+		for _, rby := range p.RequiredBy {
+			if other, ok := plugins[rby]; ok && !contains(other.Requires, file) {
+				other.Requires = append(other.Requires, file)
+			}
+		}
+	}
+	for file, p := range plugins {
+		for _, rs := range p.Requires {
+			if other, ok := plugins[rs]; ok && !contains(other.RequiredBy, file) {
+				other.RequiredBy = append(other.RequiredBy, file)
+			}
+		}
+	}
+
+	pending := []string{}
+	for file := range plugins {
+		pending = append(pending, file)
+	}
+	sort.Strings(pending)
+	placed := map[string]bool{}
+	for len(pending) != 0 {
+		remaining := []string{}
+		for _, file := range pending {
+			met := true
+			for _, rs := range plugins[file].Requires {
+				if !placed[rs] {
+					met = false
+					break
+				}
+			}
+			if !met {
+				remaining = append(remaining, file)
+				continue
+			}
+			placed[file] = true
+			plan.Plugins = append(plan.Plugins, *plugins[file])
+		}
+		if len(remaining) == len(pending) {
+			return plan, fmt.Errorf("there is either a circular dependency "+
+				"between plugins, or some dependencies are missing in these "+
+				"plugins: %v", remaining)
+		}
+		pending = remaining
+	}
+	return plan, nil
+}
+
+// readPlugins parses the plugins of the specified type in the plugins library.
+func readPlugins(library, pluginType string) (map[string]*PluginPlan, error) {
+	plugins := map[string]*PluginPlan{}
+	dirs, err := ioutil.ReadDir(library)
+	if err != nil {
+		log.Printf("ioutil.ReadDir(%s); Error: %s", library, err.Error())
+		return plugins, fmt.Errorf("library '%s' doesn't exist", library)
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		compDir := filepath.Join(library, dir.Name())
+		files, err := ioutil.ReadDir(compDir)
+		if err != nil {
+			log.Printf("ioutil.ReadDir(%s); Error: %s", compDir, err.Error())
+			continue
+		}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), "."+pluginType) {
+				continue
+			}
+			file := filepath.FromSlash(dir.Name() + "/" + f.Name())
+			data, err := ioutil.ReadFile(filepath.Join(compDir, f.Name()))
+			if err != nil {
+				log.Printf("ioutil.ReadFile(%s); Error: %s", file, err.Error())
+				return plugins, fmt.Errorf("failed to read %s plugin", file)
+			}
+			plugin := parsePlugin(string(data))
+			plugin.FileName = file
+			plugins[file] = &plugin
+		}
+	}
+	return plugins, nil
+}
+
+// parsePlugin parses the attributes of the plugin file.
+func parsePlugin(contents string) PluginPlan {
+	plugin := PluginPlan{}
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, "=", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		val := strings.TrimSpace(fields[1])
+		switch strings.TrimSpace(fields[0]) {
+		case "Description":
+			plugin.Description = val
+		case "Requires":
+			plugin.Requires = strings.Fields(val)
+		case "RequiredBy":
+			plugin.RequiredBy = strings.Fields(val)
+		case "ExecStart":
+			plugin.execStart = val
+		}
+	}
+	return plugin
+}
+
+func contains(list []string, item string) bool {
+	for _, l := range list {
+		if l == item {
+			return true
+		}
+	}
+	return false
+}
+
+func registerDryRunOption(f *flag.FlagSet) {
+	f.BoolVar(
+		&cmdOptions.dryRun,
+		"dry-run",
+		false,
+		"List the plugins that would be run by the operation without running them.",
+	)
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	pm "github.com/VeritasOS/plugin-manager"
+	"github.com/VeritasOS/plugin-manager/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	tests := []struct {
+		name         string
+		operation    string
+		plugins      map[string]string
+		wantOrder    map[string][]string
+		wantErrTypes []string
+		wantRestart  string
+	}{
+		{
+			name:      "Install in dependency order",
+			operation: "install",
+			plugins: map[string]string{
+				"A/a.preinstall": "Description=A\nRequires=B/b.preinstall\nExecStart=/bin/false\n",
+				"B/b.preinstall": "Description=B\nExecStart=/bin/false\n",
+				"C/c.preinstall": "Description=C\nRequiredBy=A/a.preinstall\nExecStart=/bin/false\n",
+				"A/a.install":    "Description=Install\nExecStart=/bin/false\n",
+			},
+			wantOrder: map[string][]string{
+				"preinstall": {"B/b.preinstall", "C/c.preinstall", "A/a.preinstall"},
+				"install":    {"A/a.install"},
+			},
+		},
+		{
+			name:      "Reboot",
+			operation: "reboot",
+			plugins: map[string]string{
+				"A/a.prereboot": "Description=Pre reboot\nExecStart=/bin/false\n",
+			},
+			wantOrder: map[string][]string{
+				"prereboot": {"A/a.prereboot"},
+			},
+			wantRestart: "prereboot",
+		},
+		{
+			name:      "Reboot with a custom phase",
+			operation: "reboot",
+			plugins: map[string]string{
+				"A/a.prereboot": "Description=Pre reboot\nExecStart=/bin/false\n",
+				"A/a.snapshot":  "Description=Snapshot\nExecStart=/bin/false\n",
+				WorkflowFileName: "phases:\n  snapshot:\n    plugin-types: [snapshot]\n" +
+					"    after: reboot\n",
+			},
+			wantOrder: map[string][]string{
+				"prereboot": {"A/a.prereboot"},
+				"snapshot":  {"A/a.snapshot"},
+			},
+			wantRestart: "snapshot",
+		},
+		{
+			name:      "Circular dependency",
+			operation: "commit",
+			plugins: map[string]string{
+				"A/a.commit": "Description=A\nRequires=B/b.commit\n",
+				"B/b.commit": "Description=B\nRequires=A/a.commit\n",
+			},
+			wantOrder: map[string][]string{
+				"commit-precheck": nil,
+				"commit":          nil,
+			},
+			wantErrTypes: []string{"commit"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			library, cleanup := setupTestEnv(t, tt.plugins)
+			defer cleanup()
+
+			plan, err := DryRun(tt.operation, library, map[string]string{})
+			if err != nil {
+				t.Fatalf("DryRun() error = %v", err)
+			}
+			gotOrder := map[string][]string{}
+			gotErrTypes := []string{}
+			for _, pt := range plan.PluginTypes {
+				var files []string
+				for _, p := range pt.Plugins {
+					files = append(files, p.FileName)
+				}
+				gotOrder[pt.Type] = files
+				if pt.StdOutErr != "" {
+					gotErrTypes = append(gotErrTypes, pt.Type)
+				}
+			}
+			if !reflect.DeepEqual(gotOrder, tt.wantOrder) {
+				t.Errorf("DryRun() plugins = %v, want %v", gotOrder, tt.wantOrder)
+			}
+			if len(tt.wantErrTypes) != 0 && !reflect.DeepEqual(gotErrTypes, tt.wantErrTypes) {
+				t.Errorf("DryRun() failed types = %v, want %v", gotErrTypes, tt.wantErrTypes)
+			}
+			if plan.RestartAfter != tt.wantRestart {
+				t.Errorf("DryRun() restart after = %v, want %v", plan.RestartAfter, tt.wantRestart)
+			}
+			if len(mockedCommands) != 0 {
+				t.Errorf("DryRun() ran %v", mockedCommands)
+			}
+		})
+	}
+}
+
+// Test_getPluginTypePlan_pmOrder checks that the plugins are listed in the
+// 	dependency order of Plugin Manager i.e., each plugin is listed after the
+// 	plugins it requires in the graph generated by `pm list`.
+func Test_getPluginTypePlan_pmOrder(t *testing.T) {
+	plugins := map[string]string{
+		"A/a.planorder": "Description=A\nRequires=B/b.planorder\nExecStart=/bin/false\n",
+		"B/b.planorder": "Description=B\nExecStart=/bin/false\n",
+		"C/c.planorder": "Description=C\nRequiredBy=A/a.planorder D/d.planorder\nExecStart=/bin/false\n",
+		"D/d.planorder": "Description=D\nRequires=A/a.planorder\nExecStart=/bin/false\n",
+		"E/e.planorder": "Description=E\nExecStart=/bin/false\n",
+	}
+	library, cleanup := setupTestEnv(t, plugins)
+	defer cleanup()
+
+	plan, err := getPluginTypePlan(library, "planorder")
+	if err != nil {
+		t.Fatalf("getPluginTypePlan() error = %v", err)
+	}
+	position := map[string]int{}
+	for idx, p := range plan.Plugins {
+		position[p.FileName] = idx
+	}
+
+	logDir := filepath.Join(filepath.Dir(library), "log")
+	os.MkdirAll(logDir, 0755)
+	config.SetPMLogDir(logDir)
+	config.SetPluginsLibrary(library)
+	if err = pm.List("planorder"); err != nil {
+		t.Fatalf("pm.List() error = %v", err)
+	}
+	dotFiles, _ := filepath.Glob(filepath.Join(logDir, "*.dot"))
+	if len(dotFiles) != 1 {
+		t.Fatalf("pm.List() generated %v, want a graph", dotFiles)
+	}
+	data, err := ioutil.ReadFile(dotFiles[0])
+	if err != nil {
+		t.Fatalf("Failed to read %s. Error: %s", dotFiles[0], err.Error())
+	}
+
+	// INFO: The graph has the plugin types run earlier by this process too,
+	// 	so only the subgraph of the plugin type is read.
+	graph := string(data)
+	start := strings.Index(graph, `label="planorder plugins"`)
+	if start == -1 {
+		t.Fatalf("pm.List() graph = %s, want planorder plugins", graph)
+	}
+	graph = graph[start:]
+	graph = graph[:strings.Index(graph, "}")]
+
+	quoted := regexp.MustCompile(`"([^"]+)"`)
+	names := func(s string) []string {
+		files := []string{}
+		for _, m := range quoted.FindAllStringSubmatch(s, -1) {
+			files = append(files, m[1])
+		}
+		return files
+	}
+	listed := map[string]bool{}
+	for _, line := range strings.Split(graph, "\n") {
+		edge := strings.Split(line, " -> ")
+		if len(edge) != 2 {
+			if files := names(line); len(files) == 1 && strings.TrimSpace(line) == `"`+files[0]+`"` {
+				listed[files[0]] = true
+			}
+			continue
+		}
+		for _, from := range names(edge[0]) {
+			for _, to := range names(edge[1]) {
+				if position[from] >= position[to] {
+					t.Errorf("getPluginTypePlan() lists %s, which requires %s, before it",
+						to, from)
+				}
+			}
+		}
+	}
+	if len(listed) != len(plan.Plugins) {
+		t.Errorf("getPluginTypePlan() plugins = %v, pm.List() plugins = %v",
+			position, listed)
+	}
+	for file := range listed {
+		if _, ok := position[file]; !ok {
+			t.Errorf("getPluginTypePlan() didn't list %s", file)
+		}
+	}
+}
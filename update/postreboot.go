@@ -0,0 +1,250 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"flag"
+	"fmt"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	osutils "github.com/VeritasOS/plugin-manager/utils/os"
+	"github.com/VeritasOS/plugin-manager/utils/output"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"github.com/VeritasOS/software-update-manager/utils/fsutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// postRebootUnit is the systemd unit that runs the post-reboot actions of an
+// 	update when the node comes back up after the reboot.
+const postRebootUnit = "sum-postreboot.service"
+
+// systemdUnitDir is the location where the post-reboot unit is generated.
+var systemdUnitDir = "/etc/systemd/system/"
+
+var execCommand = exec.Command
+
+const postRebootUnitTemplate = `# Generated by Software Update Manager (SUM). Do not edit.
+[Unit]
+Description=Software Update Manager post-reboot actions
+After=multi-user.target
+ConditionPathExists=%s
+
+[Service]
+Type=oneshot
+ExecStart=%s postreboot -on-boot
+TimeoutStartSec=0
+
+[Install]
+WantedBy=multi-user.target
+`
+
+func getPostRebootUnitPath() string {
+	return filepath.FromSlash(systemdUnitDir + postRebootUnit)
+}
+
+// installPostRebootTrigger generates and enables the post-reboot unit, so
+// 	that the post-reboot plugins are run after the node restarts.
+func installPostRebootTrigger() error {
+	log.Println("Entering update::installPostRebootTrigger")
+	defer log.Println("Exiting update::installPostRebootTrigger")
+
+	if isRebootSimulated() {
+		// INFO: The post-reboot actions are run through `sum postreboot`
+		// 	when the node restarts are simulated.
+		log.Println("Skipping the post-reboot unit as reboot is simulated.")
+		return nil
+	}
+
+	sumPath, err := os.Executable()
+	if err != nil {
+		log.Printf("os.Executable(); Error: %s", err.Error())
+		return logutil.PrintNLogError("Failed to determine the %s path.", os.Args[0])
+	}
+
+	unit := fmt.Sprintf(postRebootUnitTemplate, getJournalPath(), sumPath)
+	err = fsutil.WriteFileAtomic(getPostRebootUnitPath(), []byte(unit), 0644)
+	if err != nil {
+		return logutil.PrintNLogError("Failed to generate the post-reboot unit.")
+	}
+
+	for _, cmdParams := range [][]string{
+		{"daemon-reload"},
+		{"enable", postRebootUnit},
+	} {
+		cmd := execCommand("systemctl", cmdParams...)
+		stdOutErr, err := cmd.CombinedOutput()
+		log.Println("Stdout & Stderr:", string(stdOutErr))
+		if err != nil {
+			log.Printf("Failed to run systemctl %v. Error: %s", cmdParams, err.Error())
+			return logutil.PrintNLogError("Failed to enable the post-reboot unit.")
+		}
+	}
+	return nil
+}
+
+// removePostRebootTrigger disables and removes the post-reboot unit, and
+// 	clears the reboot request of the simulated reboot provider.
+func removePostRebootTrigger() {
+	log.Println("Entering update::removePostRebootTrigger")
+	defer log.Println("Exiting update::removePostRebootTrigger")
+
+	clearRebootRequest()
+	unitPath := getPostRebootUnitPath()
+	if _, err := os.Stat(unitPath); os.IsNotExist(err) {
+		return
+	}
+	// INFO: Ignore errors, as a stale unit is harmless. It doesn't run the
+	// 	post-reboot actions unless a reboot operation is pending.
+	cmd := execCommand("systemctl", "disable", postRebootUnit)
+	stdOutErr, err := cmd.CombinedOutput()
+	log.Println("Stdout & Stderr:", string(stdOutErr))
+	if err != nil {
+		log.Printf("Failed to disable %s. Error: %s", postRebootUnit, err.Error())
+	}
+	if err = osutils.OsRemoveAll(unitPath); err != nil {
+		log.Printf("Unable to remove %s. Error: %s", unitPath, err.Error())
+	}
+}
+
+// PostReboot runs the postreboot phase (by default, the postreboot plugins)
+// 	of the update workflow after the node is restarted.
+func PostReboot(result *Status, library string) bool {
+	log.Println("Entering update::PostReboot")
+	defer log.Println("Exiting update::PostReboot")
+
+	_, err := runWorkflowPhase(result, &result.Reboot, PhasePostReboot, library)
+	if err != nil {
+		result.Status = dStatusFail
+		result.StdOutErr = err.Error()
+		return false
+	}
+	result.Status = dStatusOk
+	return true
+}
+
+// isPostRebootPending tells whether the node was restarted after the reboot
+// 	operation, and the post-reboot actions are yet to be run.
+func (j *Journal) isPostRebootPending() bool {
+	if j.State != StateRebooting && j.State != StateRollbackRebooting {
+		return false
+	}
+	if getRebootRequest() != nil {
+		// INFO: The simulated reboot is considered complete once requested.
+		return true
+	}
+	bootID := getBootID()
+	return bootID != "" && bootID != j.BootID
+}
+
+// runPostReboot runs the post-reboot operation of the update, and rolls back
+// 	the update if the post-reboot actions fail and auto rollback is set.
+func runPostReboot(journal *Journal, library string, onBoot, autoRollback bool) error {
+	log.Printf("Entering update::runPostReboot(%s, %v, %v)", library, onBoot, autoRollback)
+	defer log.Println("Exiting update::runPostReboot")
+
+	if !journal.isPostRebootPending() {
+		if onBoot {
+			// INFO: Nothing to do when the node is restarted for reasons
+			// 	other than the update.
+			log.Printf("No post-reboot actions pending. Update is %s.", journal.State)
+			removePostRebootTrigger()
+			return nil
+		}
+		err := errcode.New(errcode.InvalidState, "Cannot run post-reboot actions as the "+
+			"node has not restarted after the reboot operation. Update is %s.",
+			journal.State)
+		output.Write(failedStatus(err))
+		return err
+	}
+	defer removePostRebootTrigger()
+
+	if journal.Library != "" {
+		library = journal.Library
+	}
+	if journal.State == StateRollbackRebooting {
+		return resumeRollback(journal, library)
+	}
+	autoRollback = autoRollback || journal.AutoRollback
+
+	if err := journal.begin("postreboot", "", ""); err != nil {
+		output.Write(failedStatus(err))
+		return err
+	}
+
+	status := journal.newStatus()
+	var err error
+	if !PostReboot(&status, library) {
+		err = status.fail("Failed to run post-reboot actions of the update.")
+	}
+	status.save()
+	status.progress.finish(status.Status)
+	if jerr := journal.end("postreboot", err == nil); jerr != nil && err == nil {
+		err = jerr
+	}
+
+	if err != nil && autoRollback {
+		logutil.PrintNLog("Rolling back the update as post-reboot actions failed.\n")
+		if jerr := journal.begin("rollback", "", ""); jerr != nil {
+			output.Write(status)
+			return err
+		}
+		status.checkpoint = newCheckpoint("rollback", false)
+		status.deadline = journal.Deadline
+		status.rollbackOnInterrupt = journal.RollbackOnInterrupt
+		status.progress = newProgress(journal)
+		rolledBack := runRollback(journal, &status, library)
+		if !rolledBack {
+			status.ErrorCode = errcode.RollbackFailed
+			status.StdOutErr = logutil.PrintNLogError(
+				"Failed to roll back the update after post-reboot failure.").Error()
+		}
+		status.Status = dStatusFail
+		status.save()
+		journal.end("rollback", rolledBack)
+	}
+
+	if err == nil && journal.AutoCommit {
+		err = autoCommit(journal, library)
+	}
+
+	if journal.isChained() {
+		writeChainStatus(journal)
+	} else {
+		output.Write(status)
+	}
+	return err
+}
+
+// registerCommandPostReboot registers postreboot command and its options
+func registerCommandPostReboot(progname string) {
+	log.Printf("Entering update::registerCommandPostReboot(%s)", progname)
+	defer log.Println("Exiting update::registerCommandPostReboot")
+
+	cmdOptions.postRebootCmd = flag.NewFlagSet(progname+" postreboot", flag.PanicOnError)
+	cmdOptions.postRebootCmd.BoolVar(
+		&cmdOptions.onBoot,
+		"on-boot",
+		false,
+		"Run only if post-reboot actions are pending (used by the boot-time trigger).",
+	)
+	cmdOptions.postRebootCmd.BoolVar(
+		&cmdOptions.soakEnded,
+		"soak-ended",
+		false,
+		"Commit the update once its soak period ends (used by the soak timer).",
+	)
+	registerAutoRollbackOption(cmdOptions.postRebootCmd)
+	registerWaitOption(cmdOptions.postRebootCmd)
+	output.RegisterCommandOptions(cmdOptions.postRebootCmd, map[string]string{"output-format": "yaml"})
+}
+
+func registerAutoRollbackOption(f *flag.FlagSet) {
+	f.BoolVar(
+		&cmdOptions.autoRollback,
+		"auto-rollback",
+		false,
+		"Roll back the update automatically if the post-reboot actions fail.",
+	)
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"testing"
+)
+
+func Test_runPostReboot(t *testing.T) {
+	tests := []struct {
+		name         string
+		state        State
+		bootID       string
+		plugins      map[string]string
+		onBoot       bool
+		autoRollback bool
+		wantErr      bool
+		wantState    State
+	}{
+		{
+			name:      "Nothing pending on boot",
+			state:     StateCommitted,
+			onBoot:    true,
+			wantState: StateCommitted,
+		},
+		{
+			name:      "Node not restarted",
+			state:     StateRebooting,
+			bootID:    getBootID(),
+			wantErr:   true,
+			wantState: StateRebooting,
+		},
+		{
+			name:   "Post-reboot plugins succeed",
+			state:  StateRebooting,
+			bootID: "stale-boot-id",
+			plugins: map[string]string{
+				"A/a.postreboot": "Description=Post reboot\nExecStart=/bin/true\n",
+			},
+			onBoot:    true,
+			wantState: StateAwaitingCommit,
+		},
+		{
+			name:   "Post-reboot plugins fail",
+			state:  StateRebooting,
+			bootID: "stale-boot-id",
+			plugins: map[string]string{
+				"A/a.postreboot": "Description=Post reboot\nExecStart=/bin/false\n",
+			},
+			wantErr:   true,
+			wantState: StateFailed,
+		},
+		{
+			name:   "Post-reboot plugins fail with auto rollback",
+			state:  StateRebooting,
+			bootID: "stale-boot-id",
+			plugins: map[string]string{
+				"A/a.postreboot":  "Description=Post reboot\nExecStart=/bin/false\n",
+				"A/a.prerollback": "Description=Pre rollback\nExecStart=/bin/true\n",
+			},
+			autoRollback: true,
+			wantErr:      true,
+			wantState:    StateRolledBack,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			library, cleanup := setupTestEnv(t, tt.plugins)
+			defer cleanup()
+
+			j := &Journal{State: tt.state, BootID: tt.bootID}
+			if err := j.save(); err != nil {
+				t.Fatalf("Failed to save journal. Error: %s", err.Error())
+			}
+			err := runPostReboot(j, library, tt.onBoot, tt.autoRollback)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("runPostReboot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got, _ := LoadJournal()
+			if got.State != tt.wantState {
+				t.Errorf("runPostReboot() state = %v, want %v", got.State, tt.wantState)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"bufio"
+	"fmt"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/software-update-manager/repo"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"github.com/VeritasOS/software-update-manager/validate/version"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Preflight checks.
+const (
+	CheckFreeSpace       = "free-space"
+	CheckMemory          = "memory"
+	CheckKernelRelease   = "kernel-release"
+	CheckOSRelease       = "os-release"
+	CheckServiceRunning  = "service-running"
+	CheckServiceStopped  = "service-stopped"
+	CheckNoPendingUpdate = "no-pending-update"
+)
+
+// Files from which the system details are read by the preflight checks.
+var (
+	memInfoFile       = "/proc/meminfo"
+	kernelReleaseFile = "/proc/sys/kernel/osrelease"
+	osReleaseFile     = "/etc/os-release"
+)
+
+// PreflightResult is the result of a preflight check.
+type PreflightResult struct {
+	Check string
+	// Target is the mount point or the service that is checked.
+	Target string `yaml:",omitempty" json:",omitempty"`
+	Status string
+	// Required & Actual are the required and the actual values of the
+	// 	system, and Reason tells why the check failed.
+	Required string `yaml:",omitempty" json:",omitempty"`
+	Actual   string `yaml:",omitempty" json:",omitempty"`
+	Reason   string `yaml:",omitempty" json:",omitempty"`
+}
+
+// PreflightError is returned when any of the preflight checks fail.
+type PreflightError struct {
+	Results []PreflightResult
+}
+
+func (e *PreflightError) Error() string {
+	reasons := []string{}
+	for _, r := range e.Results {
+		if r.Status != dStatusOk {
+			reasons = append(reasons, r.Reason)
+		}
+	}
+	return "Preflight checks failed. " + strings.Join(reasons, " ")
+}
+
+// ErrorCode returns the class of the failure.
+func (e *PreflightError) ErrorCode() errcode.Code {
+	return errcode.PreflightFailed
+}
+
+// runPreflight runs the preflight checks of the software being installed
+// 	by the update of the journal. All the checks are run, so that all the
+// 	failures are reported together.
+func runPreflight(j *Journal, checks repo.PreflightChecks) error {
+	log.Printf("Entering update::runPreflight(%+v)", checks)
+	defer log.Println("Exiting update::runPreflight")
+
+	results := []PreflightResult{}
+	for _, fs := range checks.FreeSpace {
+		results = append(results, checkFreeSpace(fs))
+	}
+	if checks.MinimumMemoryMB > 0 {
+		results = append(results, checkMemory(checks.MinimumMemoryMB))
+	}
+	if len(checks.KernelRelease) != 0 {
+		results = append(results, checkRelease(CheckKernelRelease,
+			checks.KernelRelease, readKernelRelease))
+	}
+	if len(checks.OSRelease) != 0 {
+		results = append(results, checkRelease(CheckOSRelease,
+			checks.OSRelease, readOSRelease))
+	}
+	for _, svc := range checks.RunningServices {
+		results = append(results, checkService(svc, true))
+	}
+	for _, svc := range checks.StoppedServices {
+		results = append(results, checkService(svc, false))
+	}
+	if checks.NoPendingUpdate {
+		results = append(results, checkNoPendingUpdate(j))
+	}
+	if len(results) == 0 {
+		return nil
+	}
+
+	logutil.PrintNLog("Running preflight checks...\n")
+	failed := false
+	for _, r := range results {
+		log.Printf("Preflight check: %+v", r)
+		if r.Status != dStatusOk {
+			failed = true
+			logutil.PrintNLogError("%s", r.Reason)
+		}
+	}
+	if failed {
+		return &PreflightError{Results: results}
+	}
+	return nil
+}
+
+// newPreflightResult returns the result of the check, which has failed for
+// 	the specified reason, if any.
+func newPreflightResult(check, target, required, actual, reason string) PreflightResult {
+	r := PreflightResult{Check: check, Target: target, Status: dStatusOk,
+		Required: required, Actual: actual, Reason: reason}
+	if reason != "" {
+		r.Status = dStatusFail
+	}
+	return r
+}
+
+func checkFreeSpace(fs repo.FreeSpaceCheck) PreflightResult {
+	required := fmt.Sprintf("%dMB", fs.MinimumMB)
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(fs.MountPoint, &st); err != nil {
+		log.Printf("syscall.Statfs(%s); Error: %s", fs.MountPoint, err.Error())
+		return newPreflightResult(CheckFreeSpace, fs.MountPoint, required, "",
+			fmt.Sprintf("Unable to get the free space on %s.", fs.MountPoint))
+	}
+	free := st.Bavail * uint64(st.Bsize) / (1024 * 1024)
+	reason := ""
+	if free < fs.MinimumMB {
+		reason = fmt.Sprintf("%s has %dMB free space, and %dMB is required.",
+			fs.MountPoint, free, fs.MinimumMB)
+	}
+	return newPreflightResult(CheckFreeSpace, fs.MountPoint, required,
+		fmt.Sprintf("%dMB", free), reason)
+}
+
+func checkMemory(minimumMB uint64) PreflightResult {
+	required := fmt.Sprintf("%dMB", minimumMB)
+	total, err := readMemTotalMB()
+	if err != nil {
+		log.Printf("Unable to read the memory of the node. Error: %s", err.Error())
+		return newPreflightResult(CheckMemory, "", required, "",
+			"Unable to get the memory of the node.")
+	}
+	reason := ""
+	if total < minimumMB {
+		reason = fmt.Sprintf("The node has %dMB memory, and %dMB is required.",
+			total, minimumMB)
+	}
+	return newPreflightResult(CheckMemory, "", required, fmt.Sprintf("%dMB", total), reason)
+}
+
+// readMemTotalMB returns the total RAM of the node.
+func readMemTotalMB() (uint64, error) {
+	f, err := os.Open(memInfoFile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Ex: MemTotal:       16265396 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			return kb / 1024, err
+		}
+	}
+	return 0, fmt.Errorf("MemTotal is not found in %s", memInfoFile)
+}
+
+// checkRelease checks whether the release read by readRelease matches any
+// 	of the supported releases.
+func checkRelease(check string, supported []string, readRelease func() (string, error)) PreflightResult {
+	required := strings.Join(supported, ", ")
+	release, err := readRelease()
+	if err != nil {
+		log.Printf("Unable to read the %s. Error: %s", check, err.Error())
+		return newPreflightResult(check, "", required, "",
+			fmt.Sprintf("Unable to get the %s of the node.", check))
+	}
+	for _, s := range supported {
+		if version.Compare(release, s) {
+			return newPreflightResult(check, "", required, release, "")
+		}
+	}
+	return newPreflightResult(check, "", required, release,
+		fmt.Sprintf("The %s %s is not one of the supported %s.", check, release, required))
+}
+
+func readKernelRelease() (string, error) {
+	data, err := ioutil.ReadFile(kernelReleaseFile)
+	return strings.TrimSpace(string(data)), err
+}
+
+// readOSRelease returns the VERSION_ID of the OS.
+func readOSRelease() (string, error) {
+	data, err := ioutil.ReadFile(osReleaseFile)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// Ex: VERSION_ID="8.4"
+		if strings.HasPrefix(line, "VERSION_ID=") {
+			return strings.Trim(strings.TrimPrefix(line, "VERSION_ID="), `"'`), nil
+		}
+	}
+	return "", fmt.Errorf("VERSION_ID is not found in %s", osReleaseFile)
+}
+
+// checkService checks whether the systemd service is running or stopped as
+// 	required.
+func checkService(service string, running bool) PreflightResult {
+	check, required := CheckServiceRunning, "active"
+	if !running {
+		check, required = CheckServiceStopped, "inactive"
+	}
+	cmd := execCommand("systemctl", "is-active", service)
+	out, err := cmd.Output()
+	actual := strings.TrimSpace(string(out))
+	if actual == "" {
+		actual = "unknown"
+	}
+	reason := ""
+	if (err == nil) != running {
+		reason = fmt.Sprintf("%s service is %s, and is required to be %s.",
+			service, actual, required)
+	}
+	return newPreflightResult(check, service, required, actual, reason)
+}
+
+// checkNoPendingUpdate checks that the earlier update was completed i.e.,
+// 	was committed or rolled back, before the install began.
+func checkNoPendingUpdate(j *Journal) PreflightResult {
+	prev := StateIdle
+	for _, t := range j.Transitions {
+		if t.To == StateInstalling {
+			prev = t.From
+		}
+	}
+	reason := ""
+	if prev == StateFailed || prev == StateInterrupted {
+		reason = fmt.Sprintf("The earlier update is %s. Commit or roll back the "+
+			"update before installing a new one.", prev)
+	}
+	return newPreflightResult(CheckNoPendingUpdate, "", "", string(prev), reason)
+}
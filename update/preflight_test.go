@@ -0,0 +1,114 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"github.com/VeritasOS/software-update-manager/repo"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func Test_runPreflight(t *testing.T) {
+	library, cleanup := setupTestEnv(t, nil)
+	defer cleanup()
+	tmpDir := filepath.Dir(library)
+	defer func(mem, kernel, osRelease string) {
+		memInfoFile, kernelReleaseFile, osReleaseFile = mem, kernel, osRelease
+	}(memInfoFile, kernelReleaseFile, osReleaseFile)
+	memInfoFile = filepath.Join(tmpDir, "meminfo")
+	kernelReleaseFile = filepath.Join(tmpDir, "osrelease")
+	osReleaseFile = filepath.Join(tmpDir, "os-release")
+	ioutil.WriteFile(memInfoFile, []byte("MemTotal:        4194304 kB\nMemFree:  1024 kB\n"), 0644)
+	ioutil.WriteFile(kernelReleaseFile, []byte("4.18.0-305.el8.x86_64\n"), 0644)
+	ioutil.WriteFile(osReleaseFile, []byte("NAME=\"RHEL\"\nVERSION_ID=\"8.4\"\n"), 0644)
+
+	tests := []struct {
+		name       string
+		checks     repo.PreflightChecks
+		exitStatus int
+		from       State
+		wantFailed []string
+	}{
+		{
+			name: "No checks",
+		},
+		{
+			name: "Checks pass",
+			checks: repo.PreflightChecks{
+				FreeSpace:       []repo.FreeSpaceCheck{{MountPoint: tmpDir, MinimumMB: 1}},
+				MinimumMemoryMB: 4096,
+				KernelRelease:   []string{"3.10.*", "4.18.*"},
+				OSRelease:       []string{"8.*"},
+				RunningServices: []string{"sshd"},
+				NoPendingUpdate: true,
+			},
+			from: StateCommitted,
+		},
+		{
+			name: "Checks fail",
+			checks: repo.PreflightChecks{
+				FreeSpace: []repo.FreeSpaceCheck{
+					{MountPoint: tmpDir, MinimumMB: 1 << 40},
+					{MountPoint: filepath.Join(tmpDir, "missing"), MinimumMB: 1},
+				},
+				MinimumMemoryMB: 8192,
+				KernelRelease:   []string{"5.*"},
+				OSRelease:       []string{"7.9"},
+				RunningServices: []string{"sshd"},
+				NoPendingUpdate: true,
+			},
+			exitStatus: 3,
+			from:       StateFailed,
+			wantFailed: []string{CheckFreeSpace, CheckFreeSpace, CheckMemory,
+				CheckKernelRelease, CheckOSRelease, CheckServiceRunning,
+				CheckNoPendingUpdate},
+		},
+		{
+			name:       "Service is not stopped",
+			checks:     repo.PreflightChecks{StoppedServices: []string{"nfs-server"}},
+			wantFailed: []string{CheckServiceStopped},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockedExitStatus = tt.exitStatus
+			j := &Journal{Transitions: []Transition{{From: tt.from, To: StateInstalling}}}
+			err := runPreflight(j, tt.checks)
+			if len(tt.wantFailed) == 0 {
+				if err != nil {
+					t.Errorf("runPreflight() error = %v", err)
+				}
+				return
+			}
+			pe, ok := err.(*PreflightError)
+			if !ok {
+				t.Fatalf("runPreflight() error = %v, want PreflightError", err)
+			}
+			if code := errcode.Of(err); code != errcode.PreflightFailed {
+				t.Errorf("runPreflight() code = %s, want %s", code, errcode.PreflightFailed)
+			}
+			failed := []string{}
+			for _, r := range pe.Results {
+				if r.Status == dStatusFail {
+					if r.Reason == "" {
+						t.Errorf("runPreflight() result %+v has no reason", r)
+					}
+					failed = append(failed, r.Check)
+				}
+			}
+			if len(failed) != len(tt.wantFailed) {
+				t.Fatalf("runPreflight() failed checks = %v, want %v", failed, tt.wantFailed)
+			}
+			for i := range failed {
+				if failed[i] != tt.wantFailed[i] {
+					t.Errorf("runPreflight() failed checks = %v, want %v", failed, tt.wantFailed)
+				}
+			}
+			if status := failedStatus(err); len(status.Preflight) != len(pe.Results) {
+				t.Errorf("failedStatus() preflight = %+v, want %+v", status.Preflight, pe.Results)
+			}
+		})
+	}
+}
@@ -0,0 +1,413 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"github.com/VeritasOS/software-update-manager/utils/fsutil"
+	"github.com/VeritasOS/software-update-manager/utils/process"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// progressFileName is the file in the state dir where the progress of the
+// 	running operation is recorded.
+const progressFileName = "progress.json"
+
+// progressInterval is how often the running plugin is looked up, and the
+// 	progress file is read for streaming.
+var progressInterval = 2 * time.Second
+
+// Progress is the progress of the running operation.
+type Progress struct {
+	Operation string
+	// Phase is the workflow phase being run.
+	Phase string
+	// PluginType & Plugin are the plugin type and the plugin being run.
+	PluginType string `yaml:",omitempty" json:",omitempty"`
+	Plugin     string `yaml:",omitempty" json:",omitempty"`
+	Status     string
+	Percent    int
+	// RemainingSeconds is the estimated time to complete the operation.
+	RemainingSeconds int64
+	Updated          time.Time
+}
+
+func getProgressPath() string {
+	return filepath.FromSlash(stateDir + progressFileName)
+}
+
+// progress tracks the progress of the operation as the plugins of its
+// 	phases are run.
+// INFO: Each plugin is considered to take the same time, so the estimated
+// 	minutes of the operation (if specified by the software) are divided
+// 	among the plugins of the operation. Otherwise, the time remaining is
+// 	extrapolated from the time taken by the plugins run so far.
+type progress struct {
+	sync.Mutex
+	Progress
+
+	started  time.Time
+	estimate time.Duration
+	// phases are the workflow phases run by the operation, in order.
+	phases []string
+	// plans are the plugins of the plugin types of the phases, in the
+	// 	dependency order.
+	plans map[string][]PluginPlan
+	total int
+	// done is the number of plugins of the completed plugin types, and
+	// 	running is the number of plugins of the running plugin type that
+	// 	are done.
+	done    int
+	running int
+	// phaseTypes are the plugin types of the running phase.
+	phaseTypes []string
+}
+
+// newProgress returns the progress tracker of the operation of the journal.
+func newProgress(j *Journal) *progress {
+	op := j.Operation
+	phases := []string{op}
+	if op == "rollback" {
+		phases = []string{PhaseRollback, PhaseCompleteRollback}
+	}
+	p := progress{
+		started:  time.Now(),
+		estimate: time.Duration(j.getOperationInfo(op).EstimatedMinutes) * time.Minute,
+		phases:   phases,
+	}
+	p.Operation = op
+	p.Status = dStatusInProgress
+	return &p
+}
+
+// startPhase records the start of the workflow phase. The plugins of the
+// 	phases of the operation, including the custom phases run with them, are
+// 	counted on the first phase, and the plugins of the phases before the
+// 	specified one are considered done, as those would have been run before
+// 	the node was restarted.
+func (p *progress) startPhase(wf Workflow, phase, library string) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+
+	if p.plans == nil {
+		p.plans = map[string][]PluginPlan{}
+		phases := []string{}
+		for _, name := range p.phases {
+			phases = append(phases, wf.sequence(name)...)
+		}
+		p.phases = phases
+		for _, name := range p.phases {
+			for _, pt := range wf.Phases[name].PluginTypes {
+				plan, err := getPluginTypePlan(library, pt)
+				if err != nil {
+					log.Printf("Unable to count the %s plugins. Error: %s", pt, err.Error())
+				}
+				p.plans[pt] = plan.Plugins
+				p.total += len(plan.Plugins)
+			}
+		}
+	}
+	before := 0
+	for _, name := range p.phases {
+		if name == phase {
+			break
+		}
+		for _, pt := range wf.Phases[name].PluginTypes {
+			before += len(p.plans[pt])
+		}
+	}
+	if before > p.done {
+		p.done = before
+	}
+	p.Phase = phase
+	p.phaseTypes = wf.Phases[phase].PluginTypes
+	p.PluginType = ""
+	p.Plugin = ""
+	p.write()
+}
+
+// startPluginType records the start of the plugin type.
+func (p *progress) startPluginType(pluginType string) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.PluginType = pluginType
+	p.Plugin = ""
+	p.running = 0
+	p.write()
+}
+
+// endPluginType records the completion of the plugin type. The plugin types
+// 	of the failure handler are not counted, as they're not part of the
+// 	operation's plugins.
+func (p *progress) endPluginType(pluginType string, succeeded bool) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	if succeeded && contains(p.phaseTypes, pluginType) {
+		p.done += len(p.plans[pluginType])
+		if p.done > p.total {
+			p.done = p.total
+		}
+	}
+	p.Plugin = ""
+	p.running = 0
+	p.write()
+}
+
+// watch looks up the running plugin periodically until the returned
+// 	function is called.
+func (p *progress) watch() func() {
+	if p == nil {
+		return func() {}
+	}
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				p.poll()
+			}
+		}
+	}()
+	return func() {
+		close(stopCh)
+		<-doneCh
+	}
+}
+
+// poll records the plugin that is being run, which is the first plugin of
+// 	the running plugin type (in the dependency order) whose command is
+// 	being run by this process. The plugins before it are considered done.
+func (p *progress) poll() {
+	cmdlines := map[string]bool{}
+	for _, pid := range process.Descendants(os.Getpid()) {
+		if cmdline, err := process.Cmdline(pid); err == nil {
+			cmdlines[cmdline] = true
+		}
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	for idx, plugin := range p.plans[p.PluginType] {
+		if plugin.execStart != "" && cmdlines[os.ExpandEnv(plugin.execStart)] {
+			if plugin.FileName != p.Plugin {
+				p.Plugin = plugin.FileName
+				p.running = idx
+				p.write()
+			}
+			return
+		}
+	}
+}
+
+// finish records the completion of the operation with the specified status.
+func (p *progress) finish(status string) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.Status = status
+	p.PluginType = ""
+	p.Plugin = ""
+	p.running = 0
+	if status == dStatusOk {
+		p.done = p.total
+	}
+	p.write()
+}
+
+// write records the progress into the progress file.
+func (p *progress) write() {
+	completed := p.done + p.running
+	p.Percent = 0
+	if p.total > 0 {
+		p.Percent = completed * 100 / p.total
+	}
+	if p.Status == dStatusOk {
+		p.Percent = 100
+	}
+
+	var remaining time.Duration
+	elapsed := time.Since(p.started)
+	switch {
+	case p.Status != dStatusInProgress:
+	case p.estimate > 0 && p.total > 0:
+		remaining = p.estimate * time.Duration(p.total-completed) / time.Duration(p.total)
+	case p.estimate > 0:
+		remaining = p.estimate - elapsed
+	case completed > 0:
+		remaining = elapsed * time.Duration(p.total-completed) / time.Duration(completed)
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	p.RemainingSeconds = int64(remaining / time.Second)
+	p.Updated = time.Now()
+
+	data, err := json.Marshal(p.Progress)
+	if err != nil {
+		log.Printf("json.Marshal(%+v); Error: %s", p.Progress, err.Error())
+		return
+	}
+	// INFO: Failing to record the progress should not fail the update, so
+	// 	just log the error.
+	if err = fsutil.WriteFileAtomic(getProgressPath(), data, 0644); err != nil {
+		log.Printf("Failed to record the progress. Error: %s", err.Error())
+	}
+}
+
+// streamProgress writes the progress of the operation to w as NDJSON, each
+// 	time the progress file is updated, until the returned function is
+// 	called. The progress is read from the file, as the plugins are run by
+// 	the `sum` invoked by the scripts of the software.
+func streamProgress(w io.Writer) func() {
+	since := time.Now()
+	var last []byte
+	emit := func() {
+		data, err := ioutil.ReadFile(getProgressPath())
+		if err != nil || bytes.Equal(data, last) {
+			return
+		}
+		var prog Progress
+		if err = json.Unmarshal(data, &prog); err != nil || prog.Updated.Before(since) {
+			// INFO: The progress of the earlier operation isn't streamed.
+			return
+		}
+		last = data
+		w.Write(append(data, '\n'))
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				emit()
+				return
+			case <-ticker.C:
+				emit()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopCh)
+			<-doneCh
+		})
+	}
+}
+
+// progressStdout is the target to stream the progress to the standard output.
+const progressStdout = "stdout"
+
+// stdoutStream is the progress stream on the standard output of `sum`, while
+// 	the standard output is redirected to the standard error.
+type stdoutStream struct {
+	*os.File
+}
+
+// Close restores the standard output, and closes the stream.
+func (s stdoutStream) Close() error {
+	err := syscall.Dup3(int(s.Fd()), syscall.Stdout, 0)
+	if err != nil {
+		log.Printf("syscall.Dup3(%d, %d); Error: %s", s.Fd(), syscall.Stdout, err.Error())
+	}
+	s.File.Close()
+	return err
+}
+
+// openStdoutStream returns the standard output as the progress stream, and
+// 	redirects the standard output of `sum` and of its plugins to the
+// 	standard error, so that only the progress is written to the standard
+// 	output.
+func openStdoutStream() (io.WriteCloser, error) {
+	fd, err := syscall.Dup(syscall.Stdout)
+	if err != nil {
+		log.Printf("syscall.Dup(%d); Error: %s", syscall.Stdout, err.Error())
+		return nil, logutil.PrintNLogError("Failed to stream the progress to " +
+			"the standard output.")
+	}
+	if err = syscall.Dup3(syscall.Stderr, syscall.Stdout, 0); err != nil {
+		log.Printf("syscall.Dup3(%d, %d); Error: %s", syscall.Stderr,
+			syscall.Stdout, err.Error())
+		syscall.Close(fd)
+		return nil, logutil.PrintNLogError("Failed to stream the progress to " +
+			"the standard output.")
+	}
+	return stdoutStream{os.NewFile(uintptr(fd), "progress")}, nil
+}
+
+// openProgressStream opens the file, or the file descriptor (Ex: 3) that
+// 	the progress is streamed to. The progress is streamed to the standard
+// 	output when the target is stdout or 1.
+// INFO: The progress isn't streamed to the standard error, as it would be
+// 	mixed with the output of the operation and of its plugins.
+func openProgressStream(target string) (io.WriteCloser, error) {
+	log.Printf("Entering update::openProgressStream(%s)", target)
+	defer log.Println("Exiting update::openProgressStream")
+
+	if target == progressStdout || target == strconv.Itoa(syscall.Stdout) {
+		return openStdoutStream()
+	}
+	if fd, err := strconv.Atoi(target); err == nil {
+		if fd <= 2 {
+			return nil, errcode.New(errcode.InvalidUsage, "Invalid usage. The "+
+				"progress can't be streamed to the file descriptor %d.", fd)
+		}
+		f := os.NewFile(uintptr(fd), "progress")
+		if _, err = f.Stat(); err != nil {
+			log.Printf("Stat(%d); Error: %s", fd, err.Error())
+			return nil, errcode.New(errcode.InvalidUsage, "Invalid usage. The "+
+				"file descriptor %d is not open.", fd)
+		}
+		return f, nil
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("os.OpenFile(%s); Error: %s", target, err.Error())
+		return nil, errcode.New(errcode.InvalidUsage, "Failed to open the "+
+			"progress file %s.", target)
+	}
+	return f, nil
+}
+
+func registerProgressOption(f *flag.FlagSet) {
+	f.StringVar(
+		&cmdOptions.progress,
+		"progress",
+		"",
+		"Stream the progress of the operation as NDJSON to the specified file, file descriptor (ex: 3), or stdout.",
+	)
+}
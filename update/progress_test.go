@@ -0,0 +1,285 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func readProgress(t *testing.T) Progress {
+	var prog Progress
+	data, err := ioutil.ReadFile(getProgressPath())
+	if err != nil {
+		t.Fatalf("Failed to read the progress. Error: %s", err.Error())
+	}
+	if err = json.Unmarshal(data, &prog); err != nil {
+		t.Fatalf("Failed to parse the progress. Error: %s", err.Error())
+	}
+	return prog
+}
+
+func Test_progress(t *testing.T) {
+	tests := []struct {
+		name        string
+		preinstall  string
+		wantPercent int
+		wantStatus  string
+	}{
+		{
+			name:        "Install succeeds",
+			preinstall:  "/bin/true",
+			wantPercent: 100,
+			wantStatus:  dStatusOk,
+		},
+		{
+			// None of the plugin types complete.
+			name:        "Install fails",
+			preinstall:  "/bin/false",
+			wantPercent: 0,
+			wantStatus:  dStatusFail,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugins := map[string]string{
+				"A/a.preinstall": "Description=Pre install\nExecStart=" + tt.preinstall + "\n",
+				"B/b.preinstall": "Description=Pre install\nExecStart=/bin/true\n",
+				"A/a.install":    "Description=Install\nExecStart=/bin/true\n",
+				"B/b.install":    "Description=Install\nExecStart=/bin/true\n",
+			}
+			library, cleanup := setupTestEnv(t, plugins)
+			defer cleanup()
+
+			j, _ := LoadJournal()
+			if err := j.begin("install", "", ""); err != nil {
+				t.Fatalf("begin() error = %v", err)
+			}
+			status := j.newStatus()
+			Install(&status, library)
+			prog := readProgress(t)
+			if prog.Operation != "install" || prog.Phase != PhaseInstall {
+				t.Errorf("progress = %+v, want install operation & phase", prog)
+			}
+			if prog.Percent != tt.wantPercent {
+				t.Errorf("progress percent = %d, want %d", prog.Percent, tt.wantPercent)
+			}
+
+			status.progress.finish(status.Status)
+			prog = readProgress(t)
+			if prog.Status != tt.wantStatus || prog.RemainingSeconds != 0 {
+				t.Errorf("progress after finish = %+v, want %s status", prog, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func Test_progressRemaining(t *testing.T) {
+	_, cleanup := setupTestEnv(t, nil)
+	defer cleanup()
+
+	p := &progress{estimate: 10 * time.Minute, total: 4, done: 1, running: 1,
+		started: time.Now()}
+	p.Status = dStatusInProgress
+	p.write()
+	if prog := readProgress(t); prog.Percent != 50 || prog.RemainingSeconds != 300 {
+		t.Errorf("progress = %+v, want 50%% with 300s remaining", prog)
+	}
+
+	// Without the estimate, the time remaining is extrapolated.
+	p = &progress{total: 4, done: 2, started: time.Now().Add(-time.Minute)}
+	p.Status = dStatusInProgress
+	p.write()
+	if prog := readProgress(t); prog.RemainingSeconds < 59 || prog.RemainingSeconds > 61 {
+		t.Errorf("progress remaining = %d, want 60", prog.RemainingSeconds)
+	}
+}
+
+func Test_progressPoll(t *testing.T) {
+	_, cleanup := setupTestEnv(t, nil)
+	defer cleanup()
+
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start %v. Error: %s", cmd.Args, err.Error())
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	p := &progress{total: 3, plans: map[string][]PluginPlan{
+		"preinstall": {
+			{FileName: "A/a.preinstall", execStart: "/bin/true"},
+			{FileName: "B/b.preinstall", execStart: "sleep 30"},
+			{FileName: "C/c.preinstall", execStart: "/bin/true"},
+		},
+	}}
+	p.Status = dStatusInProgress
+	p.PluginType = "preinstall"
+	// INFO: The process might take a moment to exec the command.
+	for i := 0; i < 100 && p.Plugin == ""; i++ {
+		p.poll()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if p.Plugin != "B/b.preinstall" || p.running != 1 {
+		t.Errorf("poll() plugin = %q, running = %d, want B/b.preinstall, 1",
+			p.Plugin, p.running)
+	}
+}
+
+func Test_streamProgress(t *testing.T) {
+	_, cleanup := setupTestEnv(t, nil)
+	defer cleanup()
+	defer func(interval time.Duration) { progressInterval = interval }(progressInterval)
+	progressInterval = 10 * time.Millisecond
+
+	var out bytes.Buffer
+	stop := streamProgress(&out)
+	p := &progress{total: 2, started: time.Now()}
+	p.Operation = "install"
+	p.Status = dStatusInProgress
+	p.write()
+	time.Sleep(50 * time.Millisecond)
+	p.done = 2
+	p.Status = dStatusOk
+	p.write()
+	stop()
+	stop()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("streamProgress() wrote %q, want 2 lines", out.String())
+	}
+	var last Progress
+	if err := json.Unmarshal([]byte(lines[1]), &last); err != nil {
+		t.Fatalf("Failed to parse %q. Error: %s", lines[1], err.Error())
+	}
+	if last.Percent != 100 || last.Status != dStatusOk {
+		t.Errorf("streamProgress() last = %+v, want 100%% %s", last, dStatusOk)
+	}
+}
+
+func TestInstall_progressStream(t *testing.T) {
+	plugins := map[string]string{
+		"A/a.preinstall": "Description=Pre install\nExecStart=/bin/echo Pre install\n",
+		"A/a.install":    "Description=Install\nExecStart=/bin/echo Install\n",
+	}
+	library, cleanup := setupTestEnv(t, plugins)
+	defer cleanup()
+	defer func(interval time.Duration) { progressInterval = interval }(progressInterval)
+	progressInterval = 10 * time.Millisecond
+	defer func(args []string) { os.Args = args }(os.Args)
+	defer setOutput("", "")
+	RegisterCommandOptions("sum")
+	defer func() { cmdOptions.progress = "" }()
+
+	// The progress is streamed to a file descriptor inherited by `sum`.
+	streamFile := filepath.Join(filepath.Dir(library), "progress.ndjson")
+	f, err := os.Create(streamFile)
+	if err != nil {
+		t.Fatalf("os.Create(%s) error = %v", streamFile, err)
+	}
+	defer f.Close()
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatalf("syscall.Dup() error = %v", err)
+	}
+	outFile := filepath.Join(filepath.Dir(library), "status.yaml")
+	os.Args = []string{"sum", "install", "-progress", strconv.Itoa(fd),
+		"-output-file", outFile}
+	if err = ScanCommandOptions(map[string]interface{}{"library": library}); err != nil {
+		t.Fatalf("ScanCommandOptions(install) error = %v", err)
+	}
+
+	// Only the progress is streamed, one JSON document per line.
+	data, err := ioutil.ReadFile(streamFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s. Error: %s", streamFile, err.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var last Progress
+	for _, line := range lines {
+		if err = json.Unmarshal([]byte(line), &last); err != nil {
+			t.Fatalf("Failed to parse the progress %q. Error: %s", line, err.Error())
+		}
+	}
+	if last.Operation != "install" || last.Percent != 100 || last.Status != dStatusOk {
+		t.Errorf("Streamed progress = %+v, want 100%% %s install", last, dStatusOk)
+	}
+
+	if _, err = openProgressStream("2"); err == nil {
+		t.Errorf("openProgressStream(2) error = nil, want the invalid usage")
+	}
+}
+
+func TestInstall_progressStdout(t *testing.T) {
+	plugins := map[string]string{
+		"A/a.preinstall": "Description=Pre install\nExecStart=/bin/echo Pre install\n",
+		"A/a.install":    "Description=Install\nExecStart=/bin/echo Install\n",
+	}
+	library, cleanup := setupTestEnv(t, plugins)
+	defer cleanup()
+	defer func(interval time.Duration) { progressInterval = interval }(progressInterval)
+	progressInterval = 10 * time.Millisecond
+	defer func(args []string) { os.Args = args }(os.Args)
+	defer setOutput("", "")
+	RegisterCommandOptions("sum")
+	defer func() { cmdOptions.progress = "" }()
+
+	// The standard output and error of the test are captured into files.
+	capture := func(fd int, name string) (string, func()) {
+		path := filepath.Join(filepath.Dir(library), name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("os.Create(%s) error = %v", path, err)
+		}
+		defer f.Close()
+		saved, err := syscall.Dup(fd)
+		if err != nil {
+			t.Fatalf("syscall.Dup(%d) error = %v", fd, err)
+		}
+		syscall.Dup3(int(f.Fd()), fd, 0)
+		return path, func() {
+			syscall.Dup3(saved, fd, 0)
+			syscall.Close(saved)
+		}
+	}
+	stdoutFile, restoreStdout := capture(syscall.Stdout, "stdout")
+	stderrFile, restoreStderr := capture(syscall.Stderr, "stderr")
+	os.Args = []string{"sum", "install", "-progress", "stdout"}
+	err := ScanCommandOptions(map[string]interface{}{"library": library})
+	restoreStderr()
+	restoreStdout()
+	if err != nil {
+		t.Fatalf("ScanCommandOptions(install) error = %v", err)
+	}
+
+	// Only the progress is written to the standard output.
+	data, _ := ioutil.ReadFile(stdoutFile)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var last Progress
+	for _, line := range lines {
+		if err = json.Unmarshal([]byte(line), &last); err != nil {
+			t.Fatalf("Failed to parse the progress %q. Error: %s", line, err.Error())
+		}
+	}
+	if last.Operation != "install" || last.Percent != 100 || last.Status != dStatusOk {
+		t.Errorf("Streamed progress = %+v, want 100%% %s install", last, dStatusOk)
+	}
+	// The output of the operation, and its status are written to the
+	// 	standard error.
+	data, _ = ioutil.ReadFile(stderrFile)
+	for _, want := range []string{"Running preinstall plugins", "\nstatus: " + dStatusOk} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Standard error = %q, want %q", string(data), want)
+		}
+	}
+}
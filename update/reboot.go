@@ -0,0 +1,237 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"fmt"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	osutils "github.com/VeritasOS/plugin-manager/utils/os"
+	"github.com/VeritasOS/software-update-manager/utils/fsutil"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Reboot providers.
+const (
+	RebootProviderSystemd   = "systemd"
+	RebootProviderKexec     = "kexec"
+	RebootProviderCommand   = "command"
+	RebootProviderSimulated = "simulated"
+)
+
+// rebootRequestFileName is the name of the file in the state dir, which
+// 	records the reboot requested from the simulated reboot provider.
+const rebootRequestFileName = "reboot-request.yaml"
+
+// RebootConfig is the configuration of the reboot provider.
+type RebootConfig struct {
+	// Provider is one of systemd (default), kexec, command or simulated.
+	Provider string `yaml:",omitempty"`
+	// Command is the shell command run by the command provider.
+	Command string `yaml:",omitempty"`
+	// Kernel, Initrd and Cmdline are the kernel image, initial ramdisk and
+	// 	kernel command line loaded by the kexec provider. When kernel isn't
+	// 	specified, the kernel loaded by systemd (i.e., default boot entry) is
+	// 	used, and when cmdline isn't specified, the current one is reused.
+	Kernel  string `yaml:",omitempty"`
+	Initrd  string `yaml:",omitempty"`
+	Cmdline string `yaml:",omitempty"`
+}
+
+// RebootProvider restarts the node as part of the update workflow.
+type RebootProvider interface {
+	// Reboot requests the node to be restarted.
+	Reboot() error
+}
+
+// rebootProvider, when set, overrides the configured reboot provider.
+var rebootProvider RebootProvider
+
+// SetRebootProvider sets the reboot provider to be used instead of the one in
+// 	the SUM configuration. A nil provider restores the configured one.
+func SetRebootProvider(provider RebootProvider) {
+	rebootProvider = provider
+}
+
+// NewRebootProvider returns the reboot provider of the specified
+// 	configuration.
+func NewRebootProvider(conf RebootConfig) (RebootProvider, error) {
+	switch conf.Provider {
+	case "", RebootProviderSystemd:
+		return &SystemdReboot{}, nil
+	case RebootProviderKexec:
+		return &KexecReboot{Kernel: conf.Kernel, Initrd: conf.Initrd,
+			Cmdline: conf.Cmdline}, nil
+	case RebootProviderCommand:
+		if conf.Command == "" {
+			return nil, fmt.Errorf("Command must be specified for %s reboot provider.",
+				conf.Provider)
+		}
+		return &CommandReboot{Command: conf.Command}, nil
+	case RebootProviderSimulated:
+		return &SimulatedReboot{}, nil
+	}
+	return nil, fmt.Errorf("Unknown reboot provider %s.", conf.Provider)
+}
+
+// getRebootProvider returns the reboot provider to be used for restarting
+// 	the node.
+func getRebootProvider() (RebootProvider, error) {
+	if rebootProvider != nil {
+		return rebootProvider, nil
+	}
+	conf, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	provider, err := NewRebootProvider(conf.Reboot)
+	if err != nil {
+		return nil, logutil.PrintNLogError("Invalid reboot configuration. %s",
+			err.Error())
+	}
+	return provider, nil
+}
+
+// rebootSystem restarts the node.
+func rebootSystem() error {
+	log.Println("Entering update::rebootSystem")
+	defer log.Println("Exiting update::rebootSystem")
+
+	provider, err := getRebootProvider()
+	if err != nil {
+		return err
+	}
+	log.Printf("Rebooting through %T provider.", provider)
+	// INFO: The pending events are delivered before the node goes down.
+	emitEvent(newEvent(EventRebootRequested))
+	flushEvents()
+	if err = provider.Reboot(); err != nil {
+		log.Printf("Failed to reboot the system. Error: %s\n", err.Error())
+		rerr := &RebootError{Provider: fmt.Sprintf("%T", provider)}
+		logutil.PrintNLogError("%s", rerr.Error())
+		return rerr
+	}
+	return nil
+}
+
+// isRebootSimulated tells whether the node restarts are simulated, in which
+// 	case the post-reboot actions aren't triggered on boot.
+func isRebootSimulated() bool {
+	provider, err := getRebootProvider()
+	if err != nil {
+		return false
+	}
+	_, ok := provider.(*SimulatedReboot)
+	return ok
+}
+
+// runCommand runs the specified command, and logs its output.
+func runCommand(name string, args ...string) error {
+	cmd := execCommand(name, args...)
+	stdOutErr, err := cmd.CombinedOutput()
+	log.Println("Stdout & Stderr:", string(stdOutErr))
+	if err != nil {
+		log.Printf("Failed to run %s %v. Error: %s", name, args, err.Error())
+	}
+	return err
+}
+
+// SystemdReboot restarts the node through systemd.
+type SystemdReboot struct{}
+
+// Reboot runs `systemctl reboot`.
+func (p *SystemdReboot) Reboot() error {
+	return runCommand("systemctl", "reboot")
+}
+
+// KexecReboot restarts the node into the kernel loaded through kexec,
+// 	skipping the firmware and boot loader.
+type KexecReboot struct {
+	Kernel  string
+	Initrd  string
+	Cmdline string
+}
+
+// Reboot loads the kernel (if specified), and runs `systemctl kexec`.
+func (p *KexecReboot) Reboot() error {
+	if p.Kernel != "" {
+		args := []string{"-l", p.Kernel}
+		if p.Initrd != "" {
+			args = append(args, "--initrd="+p.Initrd)
+		}
+		if p.Cmdline != "" {
+			args = append(args, "--append="+p.Cmdline)
+		} else {
+			args = append(args, "--reuse-cmdline")
+		}
+		if err := runCommand("kexec", args...); err != nil {
+			return err
+		}
+	}
+	return runCommand("systemctl", "kexec")
+}
+
+// CommandReboot restarts the node through a custom command.
+type CommandReboot struct {
+	Command string
+}
+
+// Reboot runs the command through shell.
+func (p *CommandReboot) Reboot() error {
+	return runCommand("sh", "-c", p.Command)
+}
+
+// SimulatedReboot doesn't restart the node, but only records that a reboot
+// 	was requested. The post-reboot actions could then be run through
+// 	`sum postreboot`, as if the node came back up.
+type SimulatedReboot struct{}
+
+// RebootRequest is the reboot requested from the simulated reboot provider.
+type RebootRequest struct {
+	Requested time.Time
+	BootID    string
+}
+
+func getRebootRequestPath() string {
+	return filepath.FromSlash(stateDir + rebootRequestFileName)
+}
+
+// Reboot records the reboot request.
+func (p *SimulatedReboot) Reboot() error {
+	req := RebootRequest{Requested: time.Now(), BootID: getBootID()}
+	out, err := yaml.Marshal(req)
+	if err != nil {
+		log.Printf("yaml.Marshal(%+v); Error: %s", req, err.Error())
+		return err
+	}
+	logutil.PrintNLog("Simulating the reboot of the node.\n")
+	return fsutil.WriteFileAtomic(getRebootRequestPath(), out, 0644)
+}
+
+// getRebootRequest returns the reboot recorded by the simulated reboot
+// 	provider, if any.
+func getRebootRequest() *RebootRequest {
+	data, err := ioutil.ReadFile(getRebootRequestPath())
+	if err != nil {
+		return nil
+	}
+	req := RebootRequest{}
+	if err = yaml.Unmarshal(data, &req); err != nil {
+		log.Printf("yaml.Unmarshal(%s); Error: %s", getRebootRequestPath(), err.Error())
+		return nil
+	}
+	return &req
+}
+
+// clearRebootRequest removes the reboot recorded by the simulated reboot
+// 	provider.
+func clearRebootRequest() {
+	path := getRebootRequestPath()
+	if err := osutils.OsRemoveAll(path); err != nil {
+		log.Printf("Unable to remove %s. Error: %s", path, err.Error())
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewRebootProvider(t *testing.T) {
+	tests := []struct {
+		name         string
+		conf         RebootConfig
+		wantErr      bool
+		wantCommands []string
+	}{
+		{
+			name:         "Default",
+			wantCommands: []string{"systemctl reboot"},
+		},
+		{
+			name:         "Systemd",
+			conf:         RebootConfig{Provider: RebootProviderSystemd},
+			wantCommands: []string{"systemctl reboot"},
+		},
+		{
+			name:         "Kexec into loaded kernel",
+			conf:         RebootConfig{Provider: RebootProviderKexec},
+			wantCommands: []string{"systemctl kexec"},
+		},
+		{
+			name: "Kexec into specified kernel",
+			conf: RebootConfig{Provider: RebootProviderKexec,
+				Kernel: "/boot/vmlinuz", Initrd: "/boot/initrd.img"},
+			wantCommands: []string{
+				"kexec -l /boot/vmlinuz --initrd=/boot/initrd.img --reuse-cmdline",
+				"systemctl kexec",
+			},
+		},
+		{
+			name:         "Command",
+			conf:         RebootConfig{Provider: RebootProviderCommand, Command: "reboot -f"},
+			wantCommands: []string{"sh -c reboot -f"},
+		},
+		{
+			name:    "Command not specified",
+			conf:    RebootConfig{Provider: RebootProviderCommand},
+			wantErr: true,
+		},
+		{
+			name: "Simulated",
+			conf: RebootConfig{Provider: RebootProviderSimulated},
+		},
+		{
+			name:    "Unknown",
+			conf:    RebootConfig{Provider: "unknown"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, cleanup := setupTestEnv(t, nil)
+			defer cleanup()
+
+			provider, err := NewRebootProvider(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRebootProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if err = provider.Reboot(); err != nil {
+				t.Errorf("Reboot() error = %v", err)
+			}
+			if !reflect.DeepEqual(mockedCommands, tt.wantCommands) {
+				t.Errorf("Reboot() commands = %v, want %v", mockedCommands, tt.wantCommands)
+			}
+		})
+	}
+}
+
+func Test_simulatedReboot(t *testing.T) {
+	plugins := map[string]string{
+		"A/a.postreboot": "Description=Post reboot\nExecStart=/bin/true\n",
+	}
+	library, cleanup := setupTestEnv(t, plugins)
+	defer cleanup()
+	SetRebootProvider(&SimulatedReboot{})
+	defer SetRebootProvider(nil)
+
+	j := &Journal{State: StateRebooting, BootID: getBootID()}
+	if err := j.save(); err != nil {
+		t.Fatalf("Failed to save journal. Error: %s", err.Error())
+	}
+	if j.isPostRebootPending() {
+		t.Fatalf("isPostRebootPending() = true before the reboot is requested")
+	}
+	if err := installPostRebootTrigger(); err != nil {
+		t.Fatalf("installPostRebootTrigger() error = %v", err)
+	}
+	if err := rebootSystem(); err != nil {
+		t.Fatalf("rebootSystem() error = %v", err)
+	}
+	if len(mockedCommands) != 0 {
+		t.Errorf("rebootSystem() commands = %v, want none", mockedCommands)
+	}
+	if getRebootRequest() == nil {
+		t.Fatalf("getRebootRequest() = nil, want the recorded reboot")
+	}
+
+	if err := runPostReboot(j, library, false, false); err != nil {
+		t.Fatalf("runPostReboot() error = %v", err)
+	}
+	got, _ := LoadJournal()
+	if got.State != StateAwaitingCommit {
+		t.Errorf("runPostReboot() state = %v, want %v", got.State, StateAwaitingCommit)
+	}
+	if getRebootRequest() != nil {
+		t.Errorf("getRebootRequest() is not cleared after post-reboot actions")
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"github.com/VeritasOS/software-update-manager/repo"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"log"
+	"strings"
+	"time"
+)
+
+// getRetention returns the retention policies of the software repository
+// 	from the configuration, and the software that must not be pruned i.e.,
+// 	the software of the update, and the rollback target which is the
+// 	software last committed before it. When the update can still be rolled
+// 	back, but its rollback target isn't known (Ex: the history was
+// 	removed), the repository is not pruned.
+func getRetention() (map[string]repo.RetentionPolicy, []string, error) {
+	log.Println("Entering update::getRetention")
+	defer log.Println("Exiting update::getRetention")
+
+	conf, err := LoadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	policies := map[string]repo.RetentionPolicy{}
+	for swType, policy := range conf.RepoRetention {
+		policies[strings.ToLower(swType)] = policy
+	}
+
+	keep := []string{}
+	j, err := LoadJournal()
+	if err != nil {
+		return nil, nil, err
+	}
+	if j.SoftwareName != "" {
+		keep = append(keep, strings.ToLower(j.SoftwareType)+"/"+j.SoftwareName)
+	}
+	records, err := GetHistory("", time.Time{})
+	if err != nil {
+		return nil, nil, err
+	}
+	target := ""
+	for i := len(records) - 1; i >= 0; i-- {
+		rec := records[i]
+		if rec.Operation == "commit" && rec.Status == dStatusOk &&
+			rec.SoftwareName != "" && rec.SoftwareName != j.SoftwareName {
+			target = strings.ToLower(rec.SoftwareType) + "/" + rec.SoftwareName
+			keep = append(keep, target)
+			break
+		}
+	}
+	// INFO: The update can be rolled back until it's committed or rolled
+	// 	back.
+	if target == "" && j.SoftwareName != "" && j.State != StateIdle &&
+		j.State != StateCommitted && j.State != StateRolledBack {
+		return nil, nil, errcode.New(errcode.InvalidState, "Cannot prune the "+
+			"repository as the rollback target of the %s update is not known. "+
+			"Commit or roll back the update before pruning.", j.SoftwareName)
+	}
+	log.Printf("Retention policies: %+v, software to keep: %v", policies, keep)
+	return policies, keep, nil
+}
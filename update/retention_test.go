@@ -0,0 +1,72 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"github.com/VeritasOS/software-update-manager/repo"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"os"
+	"testing"
+)
+
+func Test_getRetention(t *testing.T) {
+	library, cleanup := setupTestEnv(t, nil)
+	defer cleanup()
+	writeTestConfig(t, library, "repo-retention:\n  Update:\n    keep-newest: 2\n    keep-days: 30\n")
+
+	// a is committed, and then b is installed, so a is the rollback target.
+	j, _ := LoadJournal()
+	for _, op := range []struct{ operation, swName string }{
+		{"install", "a-1.0.0-1.x86_64.rpm"},
+		{"commit", ""},
+		{"install", "b-2.0.0-1.x86_64.rpm"},
+	} {
+		if err := j.begin(op.operation, op.swName, "Update"); err != nil {
+			t.Fatalf("begin(%s) error = %v", op.operation, err)
+		}
+		if err := j.end(op.operation, true); err != nil {
+			t.Fatalf("end(%s) error = %v", op.operation, err)
+		}
+	}
+
+	policies, keep, err := getRetention()
+	if err != nil {
+		t.Fatalf("getRetention() error = %v", err)
+	}
+	if p := policies["update"]; p != (repo.RetentionPolicy{KeepNewest: 2, KeepDays: 30}) {
+		t.Errorf("getRetention() policies = %+v", policies)
+	}
+	want := []string{"update/b-2.0.0-1.x86_64.rpm", "update/a-1.0.0-1.x86_64.rpm"}
+	if len(keep) != len(want) || keep[0] != want[0] || keep[1] != want[1] {
+		t.Errorf("getRetention() keep = %v, want %v", keep, want)
+	}
+}
+
+func Test_getRetention_unknownRollbackTarget(t *testing.T) {
+	_, cleanup := setupTestEnv(t, nil)
+	defer cleanup()
+
+	// The history of the commit of the rollback target was removed.
+	j, _ := LoadJournal()
+	if err := j.begin("install", "b-2.0.0-1.x86_64.rpm", "Update"); err != nil {
+		t.Fatalf("begin(install) error = %v", err)
+	}
+	if err := j.end("install", true); err != nil {
+		t.Fatalf("end(install) error = %v", err)
+	}
+	os.Remove(getHistoryPath())
+	if _, _, err := getRetention(); errcode.Of(err) != errcode.InvalidState {
+		t.Errorf("getRetention() error = %v, want %s", err, errcode.InvalidState)
+	}
+
+	// Once committed, the update can't be rolled back.
+	if err := j.begin("commit", "", ""); err != nil {
+		t.Fatalf("begin(commit) error = %v", err)
+	}
+	if err := j.end("commit", true); err != nil {
+		t.Fatalf("end(commit) error = %v", err)
+	}
+	if _, keep, err := getRetention(); err != nil || len(keep) != 1 {
+		t.Errorf("getRetention() after commit = %v, %v, want only the update kept", keep, err)
+	}
+}
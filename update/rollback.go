@@ -0,0 +1,128 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/plugin-manager/utils/output"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"log"
+)
+
+// CompleteRollback runs the complete-rollback phase (by default, the rollback
+// 	plugins) of the update workflow. When the rollback requires a restart,
+// 	these are run after the node is restarted into the previous version.
+func CompleteRollback(result *Status, library string) bool {
+	log.Println("Entering update::CompleteRollback")
+	defer log.Println("Exiting update::CompleteRollback")
+
+	_, err := runWorkflowPhase(result, &result.Rollback, PhaseCompleteRollback, library)
+	if err != nil {
+		result.Status = dStatusFail
+		result.StdOutErr = err.Error()
+		result.ErrorCode = errcode.Of(err)
+		return false
+	}
+	result.Status = dStatusOk
+	return true
+}
+
+// runRollback runs the rollback workflow i.e., rollback phase (by default,
+// 	rollback-precheck and prerollback plugins), followed by the
+// 	complete-rollback phase (by default, rollback plugins). If the software
+// 	or the workflow requires a restart for rollback, then the node is
+// 	restarted into the previous version, and the complete-rollback phase is
+// 	run after the restart.
+func runRollback(journal *Journal, result *Status, library string) bool {
+	log.Printf("Entering update::runRollback(%s)", library)
+	defer log.Println("Exiting update::runRollback")
+
+	if journal.isRestartedForRollback() {
+		// INFO: The node was already restarted into the previous version
+		// 	before the rollback got interrupted, so only the rollback
+		// 	plugins are pending.
+		return CompleteRollback(result, library)
+	}
+
+	if !Rollback(result, library) {
+		return false
+	}
+
+	// INFO: The restart is required either by the software, or by the
+	// 	workflow.
+	phase, err := getWorkflowPhase(PhaseRollback, library)
+	if err != nil {
+		result.StdOutErr = err.Error()
+		result.ErrorCode = errcode.Of(err)
+		return false
+	}
+	if !journal.getOperationInfo("rollback").RequiresRestart && !phase.reboots() {
+		return CompleteRollback(result, library)
+	}
+
+	// INFO: The rollback plugins are run from the same library after the
+	// 	restart, so record it along with the boot id to detect the restart.
+	journal.BootID = getBootID()
+	if err := journal.setLibrary(library); err != nil {
+		result.StdOutErr = err.Error()
+		result.ErrorCode = errcode.Of(err)
+		return false
+	}
+	if err := journal.Transition(StateRollbackRebooting); err != nil {
+		result.StdOutErr = err.Error()
+		result.ErrorCode = errcode.Of(err)
+		return false
+	}
+
+	err = installPostRebootTrigger()
+	if err == nil {
+		logutil.PrintNLog("Restarting the node to complete the rollback...\n")
+		err = rebootSystem()
+		if err != nil {
+			removePostRebootTrigger()
+		}
+	}
+	if err != nil {
+		result.StdOutErr = err.Error()
+		result.ErrorCode = errcode.Of(err)
+		journal.Transition(StateFailed)
+		return false
+	}
+	return true
+}
+
+// isRestartedForRollback tells whether the rollback in progress is being
+// 	completed after restarting the node into the previous version.
+func (j *Journal) isRestartedForRollback() bool {
+	if j.State != StateRollingBack || len(j.Transitions) == 0 {
+		return false
+	}
+	last := j.Transitions[len(j.Transitions)-1]
+	return last.From == StateRollbackRebooting && last.To == StateRollingBack
+}
+
+// resumeRollback runs the rollback plugins after the node is restarted into
+// 	the previous version as part of the rollback.
+func resumeRollback(journal *Journal, library string) error {
+	log.Printf("Entering update::resumeRollback(%s)", library)
+	defer log.Println("Exiting update::resumeRollback")
+
+	if err := journal.begin("rollback", "", ""); err != nil {
+		output.Write(failedStatus(err))
+		return err
+	}
+
+	status := journal.newStatus()
+	status.checkpoint = newCheckpoint("rollback", false)
+	var err error
+	if !CompleteRollback(&status, library) {
+		err = status.fail("Failed to roll back the update.")
+	}
+	status.save()
+	status.progress.finish(status.Status)
+	if jerr := journal.end("rollback", err == nil); jerr != nil && err == nil {
+		err = jerr
+	}
+	output.Write(status)
+	return err
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"github.com/VeritasOS/software-update-manager/repo"
+	"reflect"
+	"testing"
+)
+
+func Test_runRollback(t *testing.T) {
+	plugins := map[string]string{
+		"A/a.rollback-precheck": "Description=Rollback precheck\nExecStart=/bin/true\n",
+		"A/a.prerollback":       "Description=Pre rollback\nExecStart=/bin/true\n",
+		"A/a.rollback":          "Description=Rollback\nExecStart=/bin/true\n",
+	}
+	tests := []struct {
+		name            string
+		requiresRestart bool
+		rebootExit      int
+		want            bool
+		wantState       State
+		wantTypes       []string
+	}{
+		{
+			name:      "Rollback without restart",
+			want:      true,
+			wantState: StateRolledBack,
+			wantTypes: []string{"rollback-precheck", "prerollback", "rollback"},
+		},
+		{
+			name:            "Rollback with restart",
+			requiresRestart: true,
+			want:            true,
+			wantState:       StateRollbackRebooting,
+			wantTypes:       []string{"rollback-precheck", "prerollback"},
+		},
+		{
+			name:            "Rollback restart fails",
+			requiresRestart: true,
+			rebootExit:      1,
+			want:            false,
+			wantState:       StateFailed,
+			wantTypes:       []string{"rollback-precheck", "prerollback"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			library, cleanup := setupTestEnv(t, plugins)
+			defer cleanup()
+			mockedExitStatus = tt.rebootExit
+
+			j := &Journal{State: StateAwaitingCommit, Operations: map[string]repo.OperationInfo{
+				"rollback": {RequiresRestart: tt.requiresRestart},
+			}}
+			if err := j.begin("rollback", "", ""); err != nil {
+				t.Fatalf("begin(rollback) error = %v", err)
+			}
+			var status Status
+			got := runRollback(j, &status, library)
+			if got != tt.want {
+				t.Errorf("runRollback() = %v, want %v", got, tt.want)
+			}
+			if err := j.end("rollback", got); err != nil {
+				t.Fatalf("end(rollback) error = %v", err)
+			}
+			if j.State != tt.wantState {
+				t.Errorf("runRollback() state = %v, want %v", j.State, tt.wantState)
+			}
+			gotTypes := []string{}
+			for _, rs := range status.Rollback {
+				gotTypes = append(gotTypes, rs.Type)
+			}
+			if !reflect.DeepEqual(gotTypes, tt.wantTypes) {
+				t.Errorf("runRollback() ran %v, want %v", gotTypes, tt.wantTypes)
+			}
+
+			if tt.wantState != StateRollbackRebooting {
+				return
+			}
+			// Complete the rollback after the restart.
+			j.BootID = "stale-boot-id"
+			j.save()
+			if err := runPostReboot(j, library, true, false); err != nil {
+				t.Fatalf("runPostReboot() error = %v", err)
+			}
+			if j.State != StateRolledBack {
+				t.Errorf("Rollback after restart state = %v, want %v",
+					j.State, StateRolledBack)
+			}
+		})
+	}
+}
@@ -0,0 +1,653 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"flag"
+	"fmt"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	osutils "github.com/VeritasOS/plugin-manager/utils/os"
+	"github.com/VeritasOS/plugin-manager/utils/output"
+	"github.com/VeritasOS/software-update-manager/repo"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"github.com/VeritasOS/software-update-manager/utils/fsutil"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// scheduleFileName is the file in the state dir where the scheduled
+// 	operations are recorded.
+const scheduleFileName = "schedule.yaml"
+
+// scheduleLockFileName is the file in the state dir that's locked while the
+// 	schedule is being updated.
+const scheduleLockFileName = "schedule.lock"
+
+// scheduleUnit & scheduleTimer are the systemd units that run the scheduled
+// 	operations when they're due.
+const (
+	scheduleUnit  = "sum-schedule.service"
+	scheduleTimer = "sum-schedule.timer"
+)
+
+const scheduleUnitTemplate = `# Generated by Software Update Manager (SUM). Do not edit.
+[Unit]
+Description=Software Update Manager scheduled operations
+
+[Service]
+Type=oneshot
+ExecStart=%s schedule run
+TimeoutStartSec=0
+`
+
+const scheduleTimerTemplate = `# Generated by Software Update Manager (SUM). Do not edit.
+[Unit]
+Description=Run the Software Update Manager scheduled operations
+
+[Timer]
+OnCalendar=minutely
+
+[Install]
+WantedBy=timers.target
+`
+
+// scheduleTimeLayouts are the formats of the time of a scheduled operation.
+var scheduleTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04"}
+
+// ScheduledOperation is an operation to be run at the specified time.
+type ScheduledOperation struct {
+	ID        int
+	Operation string
+	At        time.Time
+	// Args are the options of the operation.
+	Args           []string `yaml:",omitempty" json:",omitempty"`
+	SoftwareName   string   `yaml:",omitempty" json:",omitempty"`
+	SoftwareType   string   `yaml:",omitempty" json:",omitempty"`
+	SoftwareRepo   string   `yaml:",omitempty" json:",omitempty"`
+	ProductVersion string   `yaml:",omitempty" json:",omitempty"`
+	Created        time.Time
+	// Reason tells why the operation is not started yet, though it's due.
+	Reason string `yaml:",omitempty" json:",omitempty"`
+}
+
+// Schedule is the list of operations to be run, in the order of their time.
+type Schedule struct {
+	NextID     int `yaml:"next-id"`
+	Operations []ScheduledOperation
+}
+
+// MaintenanceWindow is a recurring period of time in which the scheduled
+// 	operations are allowed to run.
+type MaintenanceWindow struct {
+	// Days are the days of the week (Ex: sat) on which the window starts.
+	// 	When not specified, the window starts every day.
+	Days []string `yaml:",omitempty"`
+	// Start is the local time of the day (Ex: 22:00) when the window starts.
+	Start    string
+	Duration time.Duration
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday,
+	"wed": time.Wednesday, "thu": time.Thursday, "fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// validate checks that the window is well formed.
+func (w MaintenanceWindow) validate() error {
+	if _, err := time.Parse("15:04", w.Start); err != nil {
+		return fmt.Errorf("invalid start %q of the maintenance window, "+
+			"expected HH:MM", w.Start)
+	}
+	if w.Duration <= 0 || w.Duration > 7*24*time.Hour {
+		return fmt.Errorf("invalid duration %s of the maintenance window, "+
+			"expected up to 168h", w.Duration)
+	}
+	for _, day := range w.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("invalid day %q of the maintenance window", day)
+		}
+	}
+	return nil
+}
+
+// end returns the end of the occurrence of the window that contains the
+// 	specified time, if any.
+func (w MaintenanceWindow) end(t time.Time) (time.Time, bool) {
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	// INFO: The occurrences that started on the earlier days could still be
+	// 	open, when the window is longer than a day or crosses the midnight.
+	days := int(w.Duration/(24*time.Hour)) + 1
+	for k := 0; k <= days; k++ {
+		day := t.AddDate(0, 0, -k)
+		if !w.isOn(day.Weekday()) {
+			continue
+		}
+		from := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(),
+			start.Minute(), 0, 0, t.Location())
+		if !t.Before(from) && t.Before(from.Add(w.Duration)) {
+			return from.Add(w.Duration), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (w MaintenanceWindow) isOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// getMaintenanceWindowEnd returns the end of the maintenance window that
+// 	contains the specified time. When no windows are configured, the
+// 	operations can run at any time, and a zero end is returned.
+func getMaintenanceWindowEnd(windows []MaintenanceWindow, t time.Time) (time.Time, bool) {
+	if len(windows) == 0 {
+		return time.Time{}, true
+	}
+	var end time.Time
+	found := false
+	for _, w := range windows {
+		if e, ok := w.end(t); ok && e.After(end) {
+			end = e
+			found = true
+		}
+	}
+	return end, found
+}
+
+func getSchedulePath() string {
+	return filepath.FromSlash(stateDir + scheduleFileName)
+}
+
+// loadSchedule reads the scheduled operations.
+func loadSchedule() (*Schedule, error) {
+	s := Schedule{NextID: 1}
+	path := getSchedulePath()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &s, nil
+	}
+	if err != nil {
+		log.Printf("ioutil.ReadFile(%s); Error: %s", path, err.Error())
+		return &s, logutil.PrintNLogError("Failed to read the schedule.")
+	}
+	if err = yaml.Unmarshal(data, &s); err != nil {
+		log.Printf("yaml.Unmarshal(%s); Error: %s", path, err.Error())
+		return &s, logutil.PrintNLogError("Failed to parse the schedule %s.", path)
+	}
+	return &s, nil
+}
+
+// save writes the schedule, and keeps the timer that runs the scheduled
+// 	operations enabled only as long as there are operations scheduled.
+func (s *Schedule) save() error {
+	sort.SliceStable(s.Operations, func(i, k int) bool {
+		return s.Operations[i].At.Before(s.Operations[k].At)
+	})
+	out, err := yaml.Marshal(s)
+	if err != nil {
+		log.Printf("yaml.Marshal(%+v); Error: %s", s, err.Error())
+		return err
+	}
+	if err = fsutil.WriteFileAtomic(getSchedulePath(), out, 0644); err != nil {
+		return logutil.PrintNLogError("Failed to write the schedule.")
+	}
+	if len(s.Operations) == 0 {
+		removeScheduleTimer()
+		return nil
+	}
+	return installScheduleTimer()
+}
+
+// updateSchedule reads the schedule, modifies it through fn, and writes it
+// 	back with the schedule locked, so that the concurrent updates of the
+// 	schedule (Ex: by `schedule install` and by the `schedule run` of the
+// 	timer) aren't lost. The schedule isn't written when fn fails.
+// INFO: The schedule has its own lock rather than the system lock, as the
+// 	scheduled operations are run by `schedule run`, and take the system
+// 	lock themselves.
+func updateSchedule(fn func(s *Schedule) error) error {
+	log.Println("Entering update::updateSchedule")
+	defer log.Println("Exiting update::updateSchedule")
+
+	path := filepath.FromSlash(stateDir + scheduleLockFileName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("os.MkdirAll(%s); Error: %s", filepath.Dir(path), err.Error())
+		return logutil.PrintNLogError("Failed to lock the schedule.")
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		log.Printf("os.OpenFile(%s); Error: %s", path, err.Error())
+		return logutil.PrintNLogError("Failed to lock the schedule.")
+	}
+	defer f.Close()
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		log.Printf("syscall.Flock(%s); Error: %s", path, err.Error())
+		return logutil.PrintNLogError("Failed to lock the schedule.")
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	s, err := loadSchedule()
+	if err != nil {
+		return err
+	}
+	if err = fn(s); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// remove removes the scheduled operation, and tells whether it was found.
+func (s *Schedule) remove(id int) bool {
+	for i, op := range s.Operations {
+		if op.ID == id {
+			s.Operations = append(s.Operations[:i], s.Operations[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// parseScheduleTime parses the time of a scheduled operation in any of the
+// 	scheduleTimeLayouts, where the time without a zone is the local time.
+func parseScheduleTime(at string) (time.Time, error) {
+	for _, layout := range scheduleTimeLayouts {
+		if t, err := time.ParseInLocation(layout, at, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected one of %s",
+		at, strings.Join(scheduleTimeLayouts, ", "))
+}
+
+// splitScheduleArgs separates the time of the scheduled operation (i.e.,
+// 	-at) from the options of the operation.
+func splitScheduleArgs(args []string) (scheduleArgs, opArgs []string) {
+	for i := 0; i < len(args); i++ {
+		name := strings.SplitN(strings.TrimLeft(args[i], "-"), "=", 2)[0]
+		if !strings.HasPrefix(args[i], "-") || name != "at" {
+			opArgs = append(opArgs, args[i])
+			continue
+		}
+		scheduleArgs = append(scheduleArgs, args[i])
+		if !strings.Contains(args[i], "=") && i+1 < len(args) {
+			i++
+			scheduleArgs = append(scheduleArgs, args[i])
+		}
+	}
+	return scheduleArgs, opArgs
+}
+
+// scheduleOperation records the operation to be run at the specified time.
+func scheduleOperation(operation string, at time.Time, args []string) (ScheduledOperation, error) {
+	log.Printf("Entering update::scheduleOperation(%s, %s, %v)", operation, at, args)
+	defer log.Println("Exiting update::scheduleOperation")
+
+	op := ScheduledOperation{Operation: operation, At: at, Args: args,
+		SoftwareName: cmdOptions.softwareName, SoftwareType: cmdOptions.softwareType,
+		SoftwareRepo: cmdOptions.softwareRepo, ProductVersion: cmdOptions.productVersion,
+		Created: time.Now()}
+	if !at.After(op.Created) {
+		return op, errcode.New(errcode.InvalidUsage, "Cannot schedule %s at %s "+
+			"as the time has passed.", operation, at.Format(time.RFC3339))
+	}
+	conf, err := LoadConfig()
+	if err != nil {
+		return op, err
+	}
+	// INFO: Refuse the operation upfront, if it can never fit in any of
+	// 	the maintenance windows.
+	if estimate := op.estimate(); estimate > 0 && len(conf.MaintenanceWindows) != 0 {
+		fits := false
+		for _, w := range conf.MaintenanceWindows {
+			fits = fits || w.Duration >= estimate
+		}
+		if !fits {
+			return op, errcode.New(errcode.InvalidUsage, "Cannot schedule %s as its "+
+				"estimated %s is longer than the maintenance windows.", operation, estimate)
+		}
+	}
+
+	err = updateSchedule(func(s *Schedule) error {
+		op.ID = s.NextID
+		s.NextID++
+		s.Operations = append(s.Operations, op)
+		return nil
+	})
+	if err != nil {
+		return op, err
+	}
+	logutil.PrintNLog("Scheduled %s (ID %d) at %s.\n", operation, op.ID,
+		at.Format(time.RFC3339))
+	return op, nil
+}
+
+// cancelScheduledOperation removes the specified operation from the schedule.
+func cancelScheduledOperation(id int) error {
+	log.Printf("Entering update::cancelScheduledOperation(%d)", id)
+	defer log.Println("Exiting update::cancelScheduledOperation")
+
+	err := updateSchedule(func(s *Schedule) error {
+		if !s.remove(id) {
+			return errcode.New(errcode.InvalidUsage, "There is no operation scheduled "+
+				"with ID %d.", id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logutil.PrintNLog("Cancelled the scheduled operation with ID %d.\n", id)
+	return nil
+}
+
+// estimate returns the estimated time of the operation as per the software.
+// 	The estimate of the install is from the software in the repository,
+// 	and that of the other operations is from the update in progress.
+func (op ScheduledOperation) estimate() time.Duration {
+	var info repo.OperationInfo
+	if op.Operation == "install" && op.SoftwareName != "" {
+		listInfo, err := repo.List(map[string]string{
+			"softwareName":   op.SoftwareName,
+			"softwareType":   op.SoftwareType,
+			"softwareRepo":   op.SoftwareRepo,
+			"productVersion": op.ProductVersion,
+		})
+		if err != nil || len(listInfo) != 1 {
+			log.Printf("Unable to get the estimate of %s software.", op.SoftwareName)
+			return 0
+		}
+		info = listInfo[0].GetOperationInfo(op.Operation)
+	} else if j, err := LoadJournal(); err == nil {
+		info = j.getOperationInfo(op.Operation)
+	}
+	return time.Duration(info.EstimatedMinutes) * time.Minute
+}
+
+// runSchedule runs the scheduled operations that are due, one after the
+// 	other. An operation is started only within a maintenance window, and
+// 	only if it's estimated to complete before the end of the window.
+func runSchedule(now time.Time) error {
+	log.Printf("Entering update::runSchedule(%s)", now)
+	defer log.Println("Exiting update::runSchedule")
+
+	conf, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	s, err := loadSchedule()
+	if err != nil {
+		return err
+	}
+	due := []ScheduledOperation{}
+	for _, op := range s.Operations {
+		if !op.At.After(now) {
+			due = append(due, op)
+		}
+	}
+
+	for _, op := range due {
+		reason := ""
+		end, ok := getMaintenanceWindowEnd(conf.MaintenanceWindows, now)
+		estimate := op.estimate()
+		if !ok {
+			reason = "Waiting for a maintenance window."
+		} else if !end.IsZero() && now.Add(estimate).After(end) {
+			reason = fmt.Sprintf("Refused to start as the estimated %s would run "+
+				"past the end of the maintenance window at %s.", estimate,
+				end.Format(time.RFC3339))
+			logutil.PrintNLogWarning("%s %s", op.Operation, reason)
+		}
+		if reason == "" {
+			reason, err = runScheduledOperation(op)
+			if err != nil {
+				return err
+			}
+			now = time.Now()
+		}
+		if reason == "" {
+			continue
+		}
+		if err = setScheduleReason(op.ID, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runScheduledOperation removes the operation from the schedule, and runs
+// 	it. The operation is removed before it's run, so that it's never run
+// 	twice. When the operation can't be started as another operation is in
+// 	progress, it's scheduled again, and the reason is returned.
+func runScheduledOperation(op ScheduledOperation) (string, error) {
+	log.Printf("Entering update::runScheduledOperation(%+v)", op)
+	defer log.Println("Exiting update::runScheduledOperation")
+
+	// INFO: Reload the schedule, as the operation might have been cancelled
+	// 	in the meantime.
+	found := false
+	err := updateSchedule(func(s *Schedule) error {
+		found = s.remove(op.ID)
+		return nil
+	})
+	if err != nil || !found {
+		return "", err
+	}
+
+	sumPath, err := os.Executable()
+	if err != nil {
+		log.Printf("os.Executable(); Error: %s", err.Error())
+		return "", logutil.PrintNLogError("Failed to determine the %s path.", os.Args[0])
+	}
+	logutil.PrintNLog("Running the scheduled %s (ID %d)...\n", op.Operation, op.ID)
+	cmd := execCommand(sumPath, append([]string{op.Operation}, op.Args...)...)
+	stdOutErr, err := cmd.CombinedOutput()
+	log.Println("Stdout & Stderr:", string(stdOutErr))
+	if err == nil {
+		logutil.PrintNLog("Completed the scheduled %s (ID %d).\n", op.Operation, op.ID)
+		return "", nil
+	}
+	code := errcode.Unknown
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = errcode.FromExitStatus(exitErr.ExitCode())
+	}
+	if code != errcode.Busy {
+		logutil.PrintNLogError("The scheduled %s (ID %d) failed. Run `sum status` "+
+			"for details.", op.Operation, op.ID)
+		return "", nil
+	}
+	err = updateSchedule(func(s *Schedule) error {
+		s.Operations = append(s.Operations, op)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return "Waiting for the operation in progress to complete.", nil
+}
+
+// setScheduleReason records why the scheduled operation isn't started yet.
+func setScheduleReason(id int, reason string) error {
+	return updateSchedule(func(s *Schedule) error {
+		for i := range s.Operations {
+			if s.Operations[i].ID == id {
+				s.Operations[i].Reason = reason
+			}
+		}
+		return nil
+	})
+}
+
+func getScheduleUnitPath() string {
+	return filepath.FromSlash(systemdUnitDir + scheduleUnit)
+}
+
+func getScheduleTimerPath() string {
+	return filepath.FromSlash(systemdUnitDir + scheduleTimer)
+}
+
+// installScheduleTimer generates and starts the timer that runs the
+// 	scheduled operations.
+func installScheduleTimer() error {
+	log.Println("Entering update::installScheduleTimer")
+	defer log.Println("Exiting update::installScheduleTimer")
+
+	if _, err := os.Stat(getScheduleTimerPath()); err == nil {
+		return nil
+	}
+	sumPath, err := os.Executable()
+	if err != nil {
+		log.Printf("os.Executable(); Error: %s", err.Error())
+		return logutil.PrintNLogError("Failed to determine the %s path.", os.Args[0])
+	}
+	for path, unit := range map[string]string{
+		getScheduleUnitPath():  fmt.Sprintf(scheduleUnitTemplate, sumPath),
+		getScheduleTimerPath(): scheduleTimerTemplate,
+	} {
+		if err = fsutil.WriteFileAtomic(path, []byte(unit), 0644); err != nil {
+			return logutil.PrintNLogError("Failed to generate the schedule timer.")
+		}
+	}
+
+	for _, cmdParams := range [][]string{
+		{"daemon-reload"},
+		{"enable", "--now", scheduleTimer},
+	} {
+		cmd := execCommand("systemctl", cmdParams...)
+		stdOutErr, err := cmd.CombinedOutput()
+		log.Println("Stdout & Stderr:", string(stdOutErr))
+		if err != nil {
+			log.Printf("Failed to run systemctl %v. Error: %s", cmdParams, err.Error())
+			osutils.OsRemoveAll(getScheduleTimerPath())
+			return logutil.PrintNLogError("Failed to enable the schedule timer.")
+		}
+	}
+	return nil
+}
+
+// removeScheduleTimer stops and removes the timer that runs the scheduled
+// 	operations.
+func removeScheduleTimer() {
+	log.Println("Entering update::removeScheduleTimer")
+	defer log.Println("Exiting update::removeScheduleTimer")
+
+	timerPath := getScheduleTimerPath()
+	if _, err := os.Stat(timerPath); os.IsNotExist(err) {
+		return
+	}
+	// INFO: Ignore errors, as a stale timer is harmless. It doesn't run
+	// 	anything when there are no operations scheduled.
+	cmd := execCommand("systemctl", "disable", "--now", scheduleTimer)
+	stdOutErr, err := cmd.CombinedOutput()
+	log.Println("Stdout & Stderr:", string(stdOutErr))
+	if err != nil {
+		log.Printf("Failed to disable %s. Error: %s", scheduleTimer, err.Error())
+	}
+	for _, path := range []string{timerPath, getScheduleUnitPath()} {
+		if err = osutils.OsRemoveAll(path); err != nil {
+			log.Printf("Unable to remove %s. Error: %s", path, err.Error())
+		}
+	}
+}
+
+// runScheduleCommand runs the specified action of the schedule command.
+func runScheduleCommand(action string, args []string) error {
+	log.Printf("Entering update::runScheduleCommand(%s, %v)", action, args)
+	defer log.Println("Exiting update::runScheduleCommand")
+
+	switch action {
+	case "install", "reboot", "commit":
+		scheduleArgs, opArgs := splitScheduleArgs(args)
+		if err := cmdOptions.scheduleCmd.Parse(scheduleArgs); err != nil {
+			return errcode.New(errcode.InvalidUsage, "schedule command arguments parse error: %s", err.Error())
+		}
+		if cmdOptions.scheduleAt == "" {
+			return errcode.New(errcode.InvalidUsage, "Invalid usage. Time of the "+
+				"operation must be specified through -at.")
+		}
+		at, err := parseScheduleTime(cmdOptions.scheduleAt)
+		if err != nil {
+			return errcode.New(errcode.InvalidUsage, "Invalid usage. %s.", err.Error())
+		}
+		// INFO: The options of the operation are validated now, rather
+		// 	than when it's run.
+		opCmd := map[string]*flag.FlagSet{
+			"install": cmdOptions.installCmd,
+			"reboot":  cmdOptions.rebootCmd,
+			"commit":  cmdOptions.commitCmd,
+		}[action]
+		if err = opCmd.Parse(opArgs); err != nil {
+			return errcode.New(errcode.InvalidUsage, "%s command arguments parse error: %s", action, err.Error())
+		}
+		_, err = scheduleOperation(action, at, opArgs)
+		return err
+
+	case "list":
+		if err := cmdOptions.scheduleCmd.Parse(args); err != nil {
+			return errcode.New(errcode.InvalidUsage, "schedule command arguments parse error: %s", err.Error())
+		}
+		s, err := loadSchedule()
+		if err != nil {
+			return err
+		}
+		return output.Write(s.Operations)
+
+	case "cancel":
+		if err := cmdOptions.scheduleCmd.Parse(args); err != nil {
+			return errcode.New(errcode.InvalidUsage, "schedule command arguments parse error: %s", err.Error())
+		}
+		if cmdOptions.scheduleID == 0 {
+			return errcode.New(errcode.InvalidUsage, "Invalid usage. ID of the "+
+				"scheduled operation must be specified through -id.")
+		}
+		return cancelScheduledOperation(cmdOptions.scheduleID)
+
+	case "run":
+		return runSchedule(time.Now())
+	}
+	cmdOptions.scheduleCmd.Usage()
+	return errcode.New(errcode.InvalidUsage, "Unknown schedule action %q. "+
+		"Expected one of install, reboot, commit, list, cancel or run.", action)
+}
+
+// registerCommandSchedule registers schedule command and its options
+func registerCommandSchedule(progname string) {
+	log.Printf("Entering update::registerCommandSchedule(%s)", progname)
+	defer log.Println("Exiting update::registerCommandSchedule")
+
+	cmdOptions.scheduleCmd = flag.NewFlagSet(progname+
+		" schedule install|reboot|commit|list|cancel|run", flag.PanicOnError)
+	cmdOptions.scheduleCmd.StringVar(
+		&cmdOptions.scheduleAt,
+		"at",
+		"",
+		"Time to run the operation (ex: 2021-06-05T22:00). The operation "+
+			"options follow, same as that of the operation.",
+	)
+	cmdOptions.scheduleCmd.IntVar(
+		&cmdOptions.scheduleID,
+		"id",
+		0,
+		"ID of the scheduled operation to cancel.",
+	)
+	output.RegisterCommandOptions(cmdOptions.scheduleCmd, map[string]string{"output-format": "yaml"})
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"github.com/VeritasOS/software-update-manager/repo"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindow_end(t *testing.T) {
+	// 2021-06-05 is a Saturday.
+	at := func(value string) time.Time {
+		tm, _ := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+		return tm
+	}
+	tests := []struct {
+		name    string
+		window  MaintenanceWindow
+		t       time.Time
+		wantEnd time.Time
+		wantOk  bool
+	}{
+		{
+			name:    "Within the window",
+			window:  MaintenanceWindow{Start: "22:00", Duration: time.Hour},
+			t:       at("2021-06-05 22:30"),
+			wantEnd: at("2021-06-05 23:00"),
+			wantOk:  true,
+		},
+		{
+			name:   "Before the window",
+			window: MaintenanceWindow{Start: "22:00", Duration: time.Hour},
+			t:      at("2021-06-05 21:59"),
+		},
+		{
+			name:    "Past the midnight",
+			window:  MaintenanceWindow{Days: []string{"sat"}, Start: "22:00", Duration: 4 * time.Hour},
+			t:       at("2021-06-06 01:00"),
+			wantEnd: at("2021-06-06 02:00"),
+			wantOk:  true,
+		},
+		{
+			name:   "Not on the day",
+			window: MaintenanceWindow{Days: []string{"Sun"}, Start: "22:00", Duration: 4 * time.Hour},
+			t:      at("2021-06-05 23:00"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotEnd, gotOk := tt.window.end(tt.t)
+			if gotOk != tt.wantOk || !gotEnd.Equal(tt.wantEnd) {
+				t.Errorf("end() = %v, %v, want %v, %v", gotEnd, gotOk, tt.wantEnd, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindow_validate(t *testing.T) {
+	windows := []MaintenanceWindow{
+		{Start: "10pm", Duration: time.Hour},
+		{Start: "22:00"},
+		{Days: []string{"someday"}, Start: "22:00", Duration: time.Hour},
+	}
+	for _, w := range windows {
+		if err := w.validate(); err == nil {
+			t.Errorf("validate(%+v) succeeded, want error", w)
+		}
+	}
+}
+
+func Test_splitScheduleArgs(t *testing.T) {
+	args := []string{"-at", "2021-06-05T22:00", "-software-name", "a.rpm", "--at=now"}
+	scheduleArgs, opArgs := splitScheduleArgs(args)
+	if want := []string{"-at", "2021-06-05T22:00", "--at=now"}; !reflect.DeepEqual(scheduleArgs, want) {
+		t.Errorf("splitScheduleArgs() scheduleArgs = %v, want %v", scheduleArgs, want)
+	}
+	if want := []string{"-software-name", "a.rpm"}; !reflect.DeepEqual(opArgs, want) {
+		t.Errorf("splitScheduleArgs() opArgs = %v, want %v", opArgs, want)
+	}
+}
+
+func Test_scheduleOperation_concurrent(t *testing.T) {
+	_, cleanup := setupTestEnv(t, nil)
+	defer cleanup()
+
+	// The operations scheduled at the same time are all recorded.
+	const count = 10
+	at := time.Now().Add(time.Hour)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := scheduleOperation("commit", at, nil); err != nil {
+				t.Errorf("scheduleOperation() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s, err := loadSchedule()
+	if err != nil {
+		t.Fatalf("loadSchedule() error = %v", err)
+	}
+	ids := map[int]bool{}
+	for _, op := range s.Operations {
+		ids[op.ID] = true
+	}
+	if len(s.Operations) != count || len(ids) != count || s.NextID != count+1 {
+		t.Errorf("Schedule = %+v, want %d operations with distinct IDs", s, count)
+	}
+}
+
+func Test_runSchedule(t *testing.T) {
+	now := time.Now()
+	window := "maintenance-windows:\n- start: \"" + now.Add(-time.Hour).Format("15:04") +
+		"\"\n  duration: 2h\n"
+	tests := []struct {
+		name       string
+		config     string
+		estimate   uint
+		at         time.Time
+		wantRun    bool
+		wantReason string
+	}{
+		{
+			name:    "Without maintenance windows",
+			at:      now.Add(-time.Minute),
+			wantRun: true,
+		},
+		{
+			name:    "Not due",
+			at:      now.Add(time.Minute),
+			wantRun: false,
+		},
+		{
+			name:     "Fits in the window",
+			config:   window,
+			estimate: 30,
+			at:       now.Add(-time.Minute),
+			wantRun:  true,
+		},
+		{
+			name:       "Runs past the window",
+			config:     window,
+			estimate:   90,
+			at:         now.Add(-time.Minute),
+			wantReason: "Refused to start",
+		},
+		{
+			name:       "Outside the window",
+			config:     "maintenance-windows:\n- start: \"" + now.Add(time.Hour).Format("15:04") + "\"\n  duration: 30m\n",
+			at:         now.Add(-time.Minute),
+			wantReason: "Waiting for a maintenance window",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			library, cleanup := setupTestEnv(t, nil)
+			defer cleanup()
+			if tt.config != "" {
+				writeTestConfig(t, library, tt.config)
+			}
+			j, _ := LoadJournal()
+			j.Operations = map[string]repo.OperationInfo{
+				"commit": {EstimatedMinutes: tt.estimate},
+			}
+			j.save()
+			s := &Schedule{NextID: 2, Operations: []ScheduledOperation{
+				{ID: 1, Operation: "commit", At: tt.at},
+			}}
+			if err := s.save(); err != nil {
+				t.Fatalf("save() error = %v", err)
+			}
+			mockedCommands = nil
+
+			if err := runSchedule(now); err != nil {
+				t.Fatalf("runSchedule() error = %v", err)
+			}
+			sumPath, _ := os.Executable()
+			ran := false
+			for _, cmd := range mockedCommands {
+				ran = ran || cmd == sumPath+" commit"
+			}
+			if ran != tt.wantRun {
+				t.Errorf("runSchedule() ran = %v, want %v. Commands: %v", ran, tt.wantRun, mockedCommands)
+			}
+			s, _ = loadSchedule()
+			if tt.wantRun {
+				if len(s.Operations) != 0 {
+					t.Errorf("runSchedule() left %+v in the schedule", s.Operations)
+				}
+				return
+			}
+			if len(s.Operations) != 1 || !strings.HasPrefix(s.Operations[0].Reason, tt.wantReason) {
+				t.Errorf("runSchedule() schedule = %+v, want reason %q", s.Operations, tt.wantReason)
+			}
+		})
+	}
+}
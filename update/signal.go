@@ -0,0 +1,153 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"flag"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/software-update-manager/utils/process"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// dStatusInterrupted is the status of an operation or a plugin type that was
+// 	stopped by a signal.
+const dStatusInterrupted = "Interrupted"
+
+// interruptSignals are the signals that interrupt the update operation.
+var interruptSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+
+// forceExitDelay is the time after the first signal, after which another
+// 	signal forces an immediate exit.
+// INFO: The signals received before that are considered to be the same
+// 	interruption, as a Ctrl-C on the terminal is delivered to the plugins
+// 	directly as well as forwarded by the `sum` running them.
+var forceExitDelay = time.Second
+
+// exit is the function that terminates the process on a forced exit.
+var exit = os.Exit
+
+// interruption records the signal that interrupted the operation.
+var interruption struct {
+	sync.Mutex
+	signal   os.Signal
+	received time.Time
+}
+
+var trapSignalsOnce sync.Once
+
+// trapSignals starts handling the interrupt signals for the rest of the
+// 	operation.
+func trapSignals() {
+	trapSignalsOnce.Do(func() {
+		sigCh := make(chan os.Signal, 2)
+		signal.Notify(sigCh, interruptSignals...)
+		go func() {
+			for sig := range sigCh {
+				onSignal(sig)
+			}
+		}()
+	})
+}
+
+// onSignal forwards the first signal to the running plugins, so that the
+// 	operation stops once they exit. Another signal kills the plugins, and
+// 	exits right away.
+func onSignal(sig os.Signal) {
+	interruption.Lock()
+	first := interruption.signal == nil
+	if first {
+		interruption.signal = sig
+		interruption.received = time.Now()
+	}
+	elapsed := time.Since(interruption.received)
+	interruption.Unlock()
+
+	sysSig, _ := sig.(syscall.Signal)
+	if first {
+		logutil.PrintNLogWarning("Received %s. Stopping the operation once the "+
+			"running plugins exit. Send the signal again to exit immediately.", sig)
+		signalPlugins(sysSig)
+		return
+	}
+	if elapsed < forceExitDelay {
+		log.Printf("Ignoring %s received %s after the first signal.", sig, elapsed)
+		return
+	}
+	logutil.PrintNLogError("Received %s again. Exiting immediately.", sig)
+	signalPlugins(syscall.SIGKILL)
+	exit(128 + int(sysSig))
+}
+
+// detached are the process groups of the running commands that aren't part of
+// 	the operation (Ex: the event hooks).
+// INFO: The detached commands are started, and the plugins are signalled
+// 	with the lock held, so that a command being started isn't taken for a
+// 	plugin.
+var detached struct {
+	sync.Mutex
+	groups map[int]bool
+}
+
+// startDetached starts the command in its own process group, which is
+// 	neither signalled nor killed along with the plugins of the operation.
+// 	The returned function must be called once the command exits.
+func startDetached(cmd *exec.Cmd) (func(), error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	detached.Lock()
+	defer detached.Unlock()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	if detached.groups == nil {
+		detached.groups = map[int]bool{}
+	}
+	pgid := cmd.Process.Pid
+	detached.groups[pgid] = true
+	return func() {
+		detached.Lock()
+		delete(detached.groups, pgid)
+		detached.Unlock()
+	}, nil
+}
+
+// signalPlugins sends the signal to the descendants of this process i.e., the
+// 	plugins and the scripts of the operation, except the detached commands.
+func signalPlugins(sig syscall.Signal) int {
+	detached.Lock()
+	defer detached.Unlock()
+	groups := []int{}
+	for pgid := range detached.groups {
+		groups = append(groups, pgid)
+	}
+	return process.SignalDescendants(os.Getpid(), sig, groups...)
+}
+
+// getInterruption returns the signal that interrupted the operation, if any.
+func getInterruption() os.Signal {
+	interruption.Lock()
+	defer interruption.Unlock()
+	return interruption.signal
+}
+
+// isLeftForResume tells whether the operation was interrupted by a signal,
+// 	and is to be left as is for resuming, instead of being handled as a
+// 	failure.
+func isLeftForResume(rollbackOnInterrupt bool) bool {
+	return getInterruption() != nil && !rollbackOnInterrupt
+}
+
+func registerRollbackOnInterruptOption(f *flag.FlagSet) {
+	f.BoolVar(
+		&cmdOptions.rollbackOnInterrupt,
+		"rollback-on-interrupt",
+		false,
+		"Run the failure handler of the phase (by default, the rollback plugins) "+
+			"when the operation is interrupted by SIGINT or SIGTERM.",
+	)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func resetInterruption() {
+	interruption.Lock()
+	interruption.signal = nil
+	interruption.Unlock()
+}
+
+func Test_onSignal(t *testing.T) {
+	defer resetInterruption()
+	exitCode := -1
+	exit = func(code int) { exitCode = code }
+	defer func() { exit = os.Exit }()
+	defer func() { forceExitDelay = time.Second }()
+
+	onSignal(syscall.SIGTERM)
+	if getInterruption() != syscall.SIGTERM {
+		t.Errorf("getInterruption() = %v, want %v", getInterruption(), syscall.SIGTERM)
+	}
+	// The same interruption delivered again is ignored.
+	onSignal(syscall.SIGTERM)
+	if exitCode != -1 {
+		t.Errorf("onSignal() exited with %d on the same interruption", exitCode)
+	}
+	forceExitDelay = 0
+	onSignal(syscall.SIGINT)
+	if want := 128 + int(syscall.SIGINT); exitCode != want {
+		t.Errorf("onSignal() exit code = %d, want %d", exitCode, want)
+	}
+}
+
+func Test_interruptedInstall(t *testing.T) {
+	plugins := map[string]string{
+		"A/a.preinstall": "Description=Pre install\nExecStart=/bin/sleep 30\n",
+		"A/a.install":    "Description=Install\nExecStart=/bin/true\n",
+		"A/a.rollback":   "Description=Rollback\nExecStart=/bin/true\n",
+	}
+	tests := []struct {
+		name                string
+		rollbackOnInterrupt bool
+		wantResults         []string
+		wantState           State
+	}{
+		{
+			name:        "Left for resume",
+			wantResults: []string{"preinstall " + dStatusInterrupted},
+			wantState:   StateInterrupted,
+		},
+		{
+			name:                "Rollback on interrupt",
+			rollbackOnInterrupt: true,
+			wantResults: []string{"preinstall " + dStatusInterrupted,
+				"rollback " + dStatusOk},
+			wantState: StateFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			library, cleanup := setupTestEnv(t, plugins)
+			defer cleanup()
+			defer resetInterruption()
+
+			j, _ := LoadJournal()
+			if err := j.begin("install", "", ""); err != nil {
+				t.Fatalf("begin() error = %v", err)
+			}
+			j.RollbackOnInterrupt = tt.rollbackOnInterrupt
+			go func() {
+				time.Sleep(200 * time.Millisecond)
+				onSignal(syscall.SIGTERM)
+			}()
+			status := j.newStatus()
+			if Install(&status, library) {
+				t.Fatalf("Install() = true, want interrupted")
+			}
+			got := []string{}
+			for _, res := range status.Install {
+				got = append(got, res.Type+" "+res.Status)
+			}
+			if len(got) != len(tt.wantResults) {
+				t.Fatalf("Install() results = %v, want %v", got, tt.wantResults)
+			}
+			for i := range got {
+				if got[i] != tt.wantResults[i] {
+					t.Errorf("Install() results = %v, want %v", got, tt.wantResults)
+				}
+			}
+
+			if err := j.save(); err != nil {
+				t.Fatalf("save() error = %v", err)
+			}
+			if err := j.end("install", false); err != nil {
+				t.Fatalf("end() error = %v", err)
+			}
+			if j.State != tt.wantState || j.Signal != syscall.SIGTERM.String() {
+				t.Errorf("end() state = %v, signal = %v, want %v, %v",
+					j.State, j.Signal, tt.wantState, syscall.SIGTERM)
+			}
+			if tt.wantState != StateInterrupted {
+				return
+			}
+			if err := j.resume("install"); err != nil {
+				t.Fatalf("resume() error = %v", err)
+			}
+			if j.State != StateInstalling {
+				t.Errorf("resume() state = %v, want %v", j.State, StateInstalling)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"flag"
+	"fmt"
+	pm "github.com/VeritasOS/plugin-manager"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	osutils "github.com/VeritasOS/plugin-manager/utils/os"
+	"github.com/VeritasOS/plugin-manager/utils/output"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"github.com/VeritasOS/software-update-manager/utils/fsutil"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// runsDirName is the directory in the state dir that holds the results of
+// 	the operations run as part of the current update.
+const runsDirName = "runs"
+
+// dStatusInProgress is the status of a plugin type whose plugins are running.
+const dStatusInProgress = "In Progress"
+
+func getRunsDir() string {
+	return filepath.FromSlash(stateDir + runsDirName + string(os.PathSeparator))
+}
+
+// save records the results of the operations run by this process, so that
+// 	they can be reported through `sum status` while an update is running.
+//
+// INFO: Each process writes its results into its own file, as an operation
+// 	could invoke other `sum` operations (Ex: install plugins could call
+// 	`sum reboot`), and all of them could be running at the same time.
+func (s *Status) save() {
+	if s.runFile == "" {
+		s.runFile = fmt.Sprintf("%020d-%d.yaml", time.Now().UnixNano(), os.Getpid())
+	}
+	out, err := yaml.Marshal(s)
+	if err != nil {
+		log.Printf("yaml.Marshal(%+v); Error: %s", s, err.Error())
+		return
+	}
+	// INFO: Failing to record the results should not fail the update, so
+	// 	just log the error.
+	err = fsutil.WriteFileAtomic(getRunsDir()+s.runFile, out, 0644)
+	if err != nil {
+		log.Printf("Failed to record the run status. Error: %s", err.Error())
+	}
+}
+
+// clearRuns removes the results of the operations run as part of the
+// 	previous update.
+func clearRuns() error {
+	if err := osutils.OsRemoveAll(getRunsDir()); err != nil {
+		log.Printf("Unable to remove %s. Error: %s", getRunsDir(), err.Error())
+		return err
+	}
+	return nil
+}
+
+// discardInterruptedRuns removes the results of the runs that were
+// 	interrupted, as the completed results of those runs are carried over
+// 	by the resumed run.
+func discardInterruptedRuns() {
+	dir := getRunsDir()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Printf("ioutil.ReadDir(%s); Error: %s", dir, err.Error())
+		return
+	}
+	for _, f := range files {
+		path := filepath.FromSlash(dir + f.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Printf("ioutil.ReadFile(%s); Error: %s", path, err.Error())
+			continue
+		}
+		run := Status{}
+		if err = yaml.Unmarshal(data, &run); err != nil {
+			log.Printf("yaml.Unmarshal(%s); Error: %s", path, err.Error())
+			continue
+		}
+		if !run.isInProgress() && run.Status != dStatusInterrupted {
+			continue
+		}
+		if err = osutils.OsRemoveAll(path); err != nil {
+			log.Printf("Unable to remove %s. Error: %s", path, err.Error())
+		}
+	}
+}
+
+// isInProgress tells whether any of the plugin types of the run are still
+// 	shown as running.
+func (s *Status) isInProgress() bool {
+	for _, results := range [][]pm.RunStatus{s.Install, s.Reboot, s.Rollback, s.Commit} {
+		for _, result := range results {
+			if result.Status == dStatusInProgress {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadRuns reads the results of the operations run so far as part of the
+// 	current update in the order they were started.
+func loadRuns() ([]Status, error) {
+	var runs []Status
+	dir := getRunsDir()
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return runs, nil
+	}
+	if err != nil {
+		log.Printf("ioutil.ReadDir(%s); Error: %s", dir, err.Error())
+		return runs, logutil.PrintNLogError("Failed to get the update run details.")
+	}
+	names := []string{}
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.FromSlash(dir + name))
+		if err != nil {
+			log.Printf("ioutil.ReadFile(%s); Error: %s", name, err.Error())
+			continue
+		}
+		run := Status{}
+		if err = yaml.Unmarshal(data, &run); err != nil {
+			log.Printf("yaml.Unmarshal(%s); Error: %s", name, err.Error())
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// GetStatus returns the phase of the current update along with the results of
+// 	all the operations run so far. When the software type is specified, the
+// 	details are returned only if the current update is of that type.
+func GetStatus(swType string) (Status, error) {
+	log.Printf("Entering update::GetStatus(%s)", swType)
+	defer log.Println("Exiting update::GetStatus")
+
+	status := Status{Phase: StateIdle}
+	journal, err := LoadJournal()
+	if err != nil {
+		return status, err
+	}
+	if swType != "" && !strings.EqualFold(swType, journal.SoftwareType) {
+		log.Printf("Current update is of %s type, and not of %s type.",
+			journal.SoftwareType, swType)
+		return status, nil
+	}
+
+	status.Phase = journal.State
+	status.SoftwareName = journal.SoftwareName
+	status.SoftwareType = journal.SoftwareType
+	status.SoftwareVersion = journal.SoftwareVersion
+	status.SoftwareRelease = journal.SoftwareRelease
+	status.Started = journal.Started
+	status.Updated = journal.Updated
+
+	runs, err := loadRuns()
+	if err != nil {
+		return status, err
+	}
+	for _, run := range runs {
+		status.Install = append(status.Install, run.Install...)
+		status.Reboot = append(status.Reboot, run.Reboot...)
+		status.Rollback = append(status.Rollback, run.Rollback...)
+		status.Commit = append(status.Commit, run.Commit...)
+		status.Preflight = append(status.Preflight, run.Preflight...)
+		// The status of the latest operation is the status of the update.
+		if run.Status != "" {
+			status.Status = run.Status
+			status.StdOutErr = run.StdOutErr
+			status.ErrorCode = run.ErrorCode
+			status.RollbackStatus = run.RollbackStatus
+			status.RollbackStdOutErr = run.RollbackStdOutErr
+		}
+	}
+	if journal.isRunning() {
+		status.Status = dStatusInProgress
+		status.StdOutErr = ""
+		status.ErrorCode = ""
+	}
+	return status, nil
+}
+
+// runPhase runs the plugins of the specified type, and records the result
+// 	into the specified results of the operation.
+// 	When resuming an interrupted operation, the plugin type is skipped if it
+// 	was completed by the interrupted run, and its earlier result is recorded.
+func runPhase(status *Status, results *[]pm.RunStatus, pluginType, library string) error {
+	if result, ok := status.checkpoint.reuse(pluginType); ok {
+		logutil.PrintNLog("Skipping %s plugins as they were completed before the "+
+			"interruption.\n", pluginType)
+		*results = append(*results, result)
+		status.save()
+		status.progress.endPluginType(pluginType, true)
+		return nil
+	}
+
+	*results = append(*results, pm.RunStatus{Type: pluginType, Status: dStatusInProgress})
+	resIdx := len(*results) - 1
+	status.save()
+
+	status.progress.startPluginType(pluginType)
+	stopWatch := status.progress.watch()
+	err := runPM(&(*results)[resIdx], pluginType, library, status.deadline)
+	stopWatch()
+	status.progress.endPluginType(pluginType, err == nil)
+	if err != nil {
+		event := newEvent(EventPluginFailed)
+		event.PluginType = pluginType
+		event.Status = (*results)[resIdx].Status
+		event.ErrorCode = errcode.Of(err)
+		event.Message = err.Error()
+		emitEvent(event)
+	}
+	if err == nil {
+		status.checkpoint.add((*results)[resIdx])
+	}
+	status.save()
+	return err
+}
+
+// registerCommandStatus registers status command and its options
+func registerCommandStatus(progname string) {
+	log.Printf("Entering update::registerCommandStatus(%s)", progname)
+	defer log.Println("Exiting update::registerCommandStatus")
+
+	cmdOptions.statusCmd = flag.NewFlagSet(progname+" status", flag.PanicOnError)
+	cmdOptions.statusCmd.StringVar(
+		&cmdOptions.softwareType,
+		"type",
+		"",
+		"Type of the software.",
+	)
+	output.RegisterCommandOptions(cmdOptions.statusCmd, map[string]string{"output-format": "yaml"})
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	pm "github.com/VeritasOS/plugin-manager"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestGetStatus(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sum-state")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(tmpDir)
+	SetStateDir(tmpDir)
+	defer SetStateDir(DefaultStateDir)
+	defer os.Unsetenv(runIDEnv)
+
+	j, _ := LoadJournal()
+	if err = j.begin("install", "a.rpm", "Update"); err != nil {
+		t.Fatalf("begin(install) error = %v", err)
+	}
+	install := Status{Install: []pm.RunStatus{
+		{Type: "preinstall", Status: dStatusOk},
+		{Type: "install", Status: dStatusOk},
+	}, Status: dStatusOk}
+	install.save()
+
+	got, err := GetStatus("")
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if got.Phase != StateInstalling || got.Status != dStatusInProgress {
+		t.Errorf("GetStatus() phase = %v, status = %v; want %v, %v",
+			got.Phase, got.Status, StateInstalling, dStatusInProgress)
+	}
+	if err = j.end("install", true); err != nil {
+		t.Fatalf("end(install) error = %v", err)
+	}
+
+	if err = j.begin("reboot", "", ""); err != nil {
+		t.Fatalf("begin(reboot) error = %v", err)
+	}
+	reboot := Status{Reboot: []pm.RunStatus{
+		{Type: "prereboot", Status: dStatusFail},
+	}, Status: dStatusFail, StdOutErr: "Failed to reboot the update."}
+	reboot.save()
+	if err = j.end("reboot", false); err != nil {
+		t.Fatalf("end(reboot) error = %v", err)
+	}
+
+	got, err = GetStatus("update")
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if got.Phase != StateFailed || got.Status != dStatusFail ||
+		got.SoftwareName != "a.rpm" {
+		t.Errorf("GetStatus() = %+v", got)
+	}
+	if !reflect.DeepEqual(got.Install, install.Install) ||
+		!reflect.DeepEqual(got.Reboot, reboot.Reboot) {
+		t.Errorf("GetStatus() runs = %+v, %+v; want %+v, %+v",
+			got.Install, got.Reboot, install.Install, reboot.Reboot)
+	}
+
+	got, err = GetStatus("os")
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if got.Phase != StateIdle || len(got.Install) != 0 {
+		t.Errorf("GetStatus(os) = %+v, want idle", got)
+	}
+}
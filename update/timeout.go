@@ -0,0 +1,158 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// DefaultTimeoutFactor multiplies the estimated-minutes of an operation to
+// 	get its timeout, when the timeout isn't configured.
+const DefaultTimeoutFactor = 2
+
+// dStatusTimedOut is the status of a plugin type whose plugins were killed as
+// 	they didn't complete in time.
+const dStatusTimedOut = "Timed Out"
+
+// timeoutGracePeriod is the time given to the scripts of the software to
+// 	handle their own timeout (i.e., run the failure handler of the phase)
+// 	before they're killed.
+const timeoutGracePeriod = 5 * time.Minute
+
+// killInterval is how often the child processes are killed after a timeout,
+// 	until the plugins stop running.
+var killInterval = 100 * time.Millisecond
+
+// TimeoutConfig is the configuration of the time allowed for the operations
+// 	and the plugin types of the update.
+type TimeoutConfig struct {
+	// Operations is the time allowed for each of the operations (Ex:
+	// 	install: 2h). When not specified, it's the estimated-minutes of the
+	// 	operation multiplied by the factor, if the software specifies it.
+	Operations map[string]time.Duration `yaml:",omitempty"`
+	// PluginTypes is the time allowed for the plugins of each plugin type
+	// 	(Ex: preinstall: 10m).
+	PluginTypes map[string]time.Duration `yaml:"plugin-types,omitempty"`
+	// Factor multiplies the estimated-minutes of the operation to get its
+	// 	default timeout. Defaults to DefaultTimeoutFactor.
+	Factor float64 `yaml:",omitempty"`
+}
+
+// getTimeoutConfig returns the timeout configuration, or no timeouts if the
+// 	configuration can't be read.
+func getTimeoutConfig() TimeoutConfig {
+	conf, err := LoadConfig()
+	if err != nil {
+		log.Printf("Running without timeouts. Error: %s", err.Error())
+		return TimeoutConfig{}
+	}
+	return conf.Timeouts
+}
+
+// getOperationTimeout returns the time allowed for the specified operation,
+// 	or zero when the operation isn't time bound.
+func getOperationTimeout(operation string, estimatedMinutes uint) time.Duration {
+	conf := getTimeoutConfig()
+	if timeout, ok := conf.Operations[operation]; ok {
+		return timeout
+	}
+	factor := conf.Factor
+	if factor <= 0 {
+		factor = DefaultTimeoutFactor
+	}
+	return time.Duration(float64(estimatedMinutes) * factor * float64(time.Minute))
+}
+
+// getPluginTypeDeadline returns the time by which the plugins of the
+// 	specified plugin type must complete, given the deadline of the operation.
+func getPluginTypeDeadline(pluginType string, opDeadline time.Time) time.Time {
+	timeout := getTimeoutConfig().PluginTypes[pluginType]
+	if timeout <= 0 {
+		return opDeadline
+	}
+	deadline := time.Now().Add(timeout)
+	if !opDeadline.IsZero() && opDeadline.Before(deadline) {
+		return opDeadline
+	}
+	return deadline
+}
+
+// runWithDeadline runs fn, and when the deadline passes before fn returns,
+// 	kills the child processes of SUM until fn returns. A zero deadline means
+// 	no timeout.
+func runWithDeadline(deadline time.Time, fn func() error) (bool, error) {
+	if deadline.IsZero() {
+		return false, fn()
+	}
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return false, err
+	case <-timer.C:
+	}
+
+	// INFO: Keep killing, as the plugins that don't depend on the killed
+	// 	ones could still be started.
+	ticker := time.NewTicker(killInterval)
+	defer ticker.Stop()
+	for {
+		signalPlugins(syscall.SIGKILL)
+		select {
+		case err := <-done:
+			return true, err
+		case <-ticker.C:
+		}
+	}
+}
+
+// runCmdWithDeadline runs the command in its own process group, and kills the
+// 	whole group when the deadline passes before the command completes. The
+// 	combined stdout and stderr of the command is returned. A zero deadline
+// 	means no timeout.
+func runCmdWithDeadline(cmd *exec.Cmd, deadline time.Time) ([]byte, bool, error) {
+	if deadline.IsZero() {
+		stdOutErr, err := cmd.CombinedOutput()
+		return stdOutErr, false, err
+	}
+	var stdOutErr bytes.Buffer
+	cmd.Stdout = &stdOutErr
+	cmd.Stderr = &stdOutErr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, false, err
+	}
+	timer := time.AfterFunc(time.Until(deadline), func() {
+		log.Printf("Killing %v as it didn't complete by %s.", cmd.Args, deadline)
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	})
+	err := cmd.Wait()
+	timedOut := !timer.Stop()
+	return stdOutErr.Bytes(), timedOut, err
+}
+
+// setDeadline records the time by which the running operation must complete.
+func (j *Journal) setDeadline() {
+	j.Deadline = time.Time{}
+	timeout := getOperationTimeout(j.Operation,
+		j.getOperationInfo(j.Operation).EstimatedMinutes)
+	if timeout > 0 {
+		j.Deadline = time.Now().Add(timeout)
+		log.Printf("The %s operation must complete by %s.", j.Operation, j.Deadline)
+	}
+}
+
+// timeoutError returns the error of the plugin type that didn't complete by
+// 	the deadline.
+func timeoutError(pluginType string, deadline time.Time) error {
+	return fmt.Errorf("%s plugins did not complete by %s",
+		pluginType, deadline.Format(time.RFC3339))
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	pm "github.com/VeritasOS/plugin-manager"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_getOperationTimeout(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		estimated uint
+		want      time.Duration
+	}{
+		{
+			name: "No estimate",
+		},
+		{
+			name:      "Estimate with default factor",
+			estimated: 30,
+			want:      time.Hour,
+		},
+		{
+			name:      "Estimate with configured factor",
+			config:    "timeouts:\n  factor: 1.5\n",
+			estimated: 30,
+			want:      45 * time.Minute,
+		},
+		{
+			name:      "Configured timeout",
+			config:    "timeouts:\n  operations:\n    install: 2h\n",
+			estimated: 30,
+			want:      2 * time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			library, cleanup := setupTestEnv(t, nil)
+			defer cleanup()
+			writeTestConfig(t, library, tt.config)
+
+			if got := getOperationTimeout("install", tt.estimated); got != tt.want {
+				t.Errorf("getOperationTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_runWorkflowPhase_timeout(t *testing.T) {
+	plugins := map[string]string{
+		"A/a.preinstall": "Description=Pre install\nExecStart=/bin/sleep 30\n",
+		"A/a.install":    "Description=Install\nExecStart=/bin/true\n",
+		"A/a.rollback":   "Description=Rollback\nExecStart=/bin/true\n",
+	}
+	tests := []struct {
+		name     string
+		config   string
+		deadline time.Duration
+	}{
+		{
+			name:   "Plugin type timeout",
+			config: "timeouts:\n  plugin-types:\n    preinstall: 200ms\n",
+		},
+		{
+			name:     "Operation timeout",
+			deadline: 200 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			library, cleanup := setupTestEnv(t, plugins)
+			defer cleanup()
+			writeTestConfig(t, library, tt.config)
+
+			status := Status{}
+			if tt.deadline != 0 {
+				status.deadline = time.Now().Add(tt.deadline)
+			}
+			start := time.Now()
+			_, err := runWorkflowPhase(&status, &status.Install, PhaseInstall, library)
+			if err == nil {
+				t.Fatalf("runWorkflowPhase() error = nil, want timeout")
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("runWorkflowPhase() took %v, want the plugins killed", elapsed)
+			}
+			want := []pm.RunStatus{
+				{Type: "preinstall", Status: dStatusTimedOut},
+				{Type: "rollback", Status: dStatusOk},
+			}
+			if len(status.Install) != len(want) {
+				t.Fatalf("runWorkflowPhase() results = %+v, want %+v", status.Install, want)
+			}
+			for i := range want {
+				if status.Install[i].Type != want[i].Type ||
+					status.Install[i].Status != want[i].Status {
+					t.Errorf("runWorkflowPhase() result[%d] = %s %s, want %s %s", i,
+						status.Install[i].Type, status.Install[i].Status,
+						want[i].Type, want[i].Status)
+				}
+			}
+		})
+	}
+}
+
+func writeTestConfig(t *testing.T, library, config string) {
+	if config == "" {
+		return
+	}
+	path := filepath.Join(filepath.Dir(library), "sum.yaml")
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write %s. Error: %s", path, err.Error())
+	}
+}
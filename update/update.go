@@ -10,11 +10,15 @@ import (
 	logutil "github.com/VeritasOS/plugin-manager/utils/log"
 	"github.com/VeritasOS/plugin-manager/utils/output"
 	"github.com/VeritasOS/software-update-manager/repo"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"github.com/VeritasOS/software-update-manager/utils/lock"
 	"github.com/VeritasOS/software-update-manager/utils/rpm"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 )
 
 // RPMInstallRepoPath is the path where RPM contents are expected to installed/extracted.
@@ -39,90 +43,126 @@ type Status struct {
 	Commit    []pm.RunStatus `yaml:",omitempty"`
 	Status    string
 	StdOutErr string
+	// ErrorCode is the class of the failure, when the operation fails.
+	ErrorCode errcode.Code `yaml:",omitempty" json:",omitempty"`
+	// RollbackStatus & RollbackStdOutErr are the result of the failure
+	// 	handler (by default, the rollback plugins) of the operation, when
+	// 	it's run as per the failure policy.
+	RollbackStatus    string `yaml:",omitempty" json:",omitempty"`
+	RollbackStdOutErr string `yaml:",omitempty" json:",omitempty"`
+	// Preflight are the results of the preflight checks of the software,
+	// 	when any of them fail.
+	Preflight []PreflightResult `yaml:",omitempty" json:",omitempty"`
+
+	// Phase and software details of the update are reported by `sum status`.
+	Phase           State     `yaml:",omitempty" json:",omitempty"`
+	SoftwareName    string    `yaml:",omitempty" json:",omitempty"`
+	SoftwareType    string    `yaml:",omitempty" json:",omitempty"`
+	SoftwareVersion string    `yaml:",omitempty" json:",omitempty"`
+	SoftwareRelease string    `yaml:",omitempty" json:",omitempty"`
+	Started         time.Time `yaml:",omitempty" json:",omitempty"`
+	Updated         time.Time `yaml:",omitempty" json:",omitempty"`
+
+	// runFile is the file where this process records its results.
+	runFile string
+	// checkpoint records the plugin types completed by this process.
+	checkpoint *checkpoint
+	// deadline is the time by which the operation must complete.
+	deadline time.Time
+	// rollbackOnInterrupt indicates whether to run the failure handler of
+	// 	the phase when the operation is interrupted by a signal.
+	rollbackOnInterrupt bool
+	// progress tracks the progress of the operation.
+	progress *progress
 }
 
-// Commit runs the commit-precheck and commit plugins of the update workflow.
+// newStatus returns the status of an operation run as part of the update.
+func (j *Journal) newStatus() Status {
+	return Status{deadline: j.Deadline, rollbackOnInterrupt: j.RollbackOnInterrupt,
+		progress: newProgress(j)}
+}
+
+// Commit runs the commit phase (by default, the commit-precheck and commit
+// 	plugins) of the update workflow.
 func Commit(result *Status, library string) bool {
 	log.Println("Entering update::Commit")
 	defer log.Println("Exiting update::Commit")
 
-	// Plugin Types to run for update workflow as part of user commit action.
-	pluginTypes := []string{"commit-precheck", "commit"}
-
-	for _, pt := range pluginTypes {
-		result.Commit = append(result.Commit, pm.RunStatus{})
-		resIdx := len(result.Commit) - 1
-
-		err := runPM(&result.Commit[resIdx], pt, library)
-		if err != nil {
-			return false
-		}
-	}
-	return true
+	_, err := runWorkflowPhase(result, &result.Commit, PhaseCommit, library)
+	return err == nil
 }
 
-// Install runs the preinstall and install plugins of the update workflow.
+// Install runs the install phase (by default, the preinstall and install
+// 	plugins) of the update workflow. On failure, the failure policy of the
+// 	phase (by default, running the rollback plugins) is applied.
 func Install(result *Status, library string) bool {
 	log.Println("Entering update::Install")
 	defer log.Println("Exiting update::Install")
 
-	// Plugin Types to run for update workflow as part of install script.
-	pluginTypes := []string{"preinstall", "install"}
-	var err error
-
-	for _, pt := range pluginTypes {
-		result.Install = append(result.Install, pm.RunStatus{})
-		resIdx := len(result.Install) - 1
+	// INFO: The result of the failure handler is reported through the
+	// 	rollback status, and false is always returned to indicate
+	// 	installation failure.
+	phase, err := runWorkflowPhase(result, &result.Install, PhaseInstall, library)
+	if err != nil {
+		result.Status = dStatusFail
+		return false
+	}
 
-		err = runPM(&result.Install[resIdx], pt, library)
-		if err != nil {
+	if phase.reboots() {
+		if err = runRebootCommand(); err != nil {
 			result.Status = dStatusFail
-			break
+			result.StdOutErr = err.Error()
+			result.ErrorCode = errcode.Of(err)
+			return false
 		}
 	}
 
-	if err != nil {
-		// INFO: Discard rollback errors, and always return false to
-		//  indicate installation failure.
-		pt := "rollback"
-		result.Install = append(result.Install, pm.RunStatus{})
-		resIdx := len(result.Install) - 1
-		runPM(&result.Install[resIdx], pt, library)
-		return false
-	}
-
 	result.Status = dStatusOk
 	return true
 }
 
+// getSoftwarePath returns the path of the specified software in the software
+// 	repository.
+func getSoftwarePath(swName, swType, swRepo string) string {
+	if swRepo == "" {
+		swRepo = repo.SoftwareRepoPath
+	}
+	return filepath.Clean(filepath.FromSlash(swRepo +
+		string(os.PathSeparator) + swType + string(os.PathSeparator) +
+		swName))
+}
+
+// getScriptsDir returns the location where the scripts and the plugins
+// 	library of the software are installed.
+func getScriptsDir(rpmInfo repo.RPMInfo, swType string) string {
+	return RPMInstallRepoPath + swType + string(os.PathSeparator) +
+		fmt.Sprintf("%s-%s-%s", rpmInfo.GetRPMName(),
+			rpmInfo.GetRPMVersion(), rpmInfo.GetRPMRelease()) +
+		string(os.PathSeparator)
+}
+
 // runCmdFromRPM installs the specified software package from the software repo.
-func runCmdFromRPM(action, swName, swType string, params map[string]string) error {
+// 	When journal is specified, the version of the software is recorded in it.
+func runCmdFromRPM(journal *Journal, action, swName, swType string, params map[string]string) error {
 	log.Printf("Entering update::runCmdFromRPM(%s, %s, %s, %+v)",
 		action, swName, swType, params)
 	defer log.Println("Exiting update::runCmdFromRPM")
 
 	if swName == "" {
-		return logutil.PrintNLogError("Invalid usage. Software name must be specified.")
+		return errcode.New(errcode.InvalidUsage, "Invalid usage. Software name must be specified.")
 	}
 	if swType == "" {
-		return logutil.PrintNLogError("Invalid usage. Software type must be specified.")
-	}
-	swRepo := params["softwareRepo"]
-	if swRepo == "" {
-		swRepo = repo.SoftwareRepoPath
+		return errcode.New(errcode.InvalidUsage, "Invalid usage. Software type must be specified.")
 	}
-
-	absSwPath := filepath.Clean(filepath.FromSlash(swRepo +
-		string(os.PathSeparator) + swType + string(os.PathSeparator) +
-		swName))
+	absSwPath := getSoftwarePath(swName, swType, params["softwareRepo"])
 
 	fi, err := os.Stat(absSwPath)
 	if err != nil {
 		log.Printf("Unable to stat on %s: %+v. Error: %s\n",
 			absSwPath, fi, err.Error())
-		return logutil.PrintNLogError("Unable to install %s software %s. "+
-			"Specified software not found.",
-			swType, swName)
+		err = repo.NewNotFoundError(action, swName, swType)
+		logutil.PrintNLogError("%s", err.Error())
+		return err
 	}
 
 	// INFO: If there was an attempt to install this RPM previously,
@@ -147,41 +187,69 @@ func runCmdFromRPM(action, swName, swType string, params map[string]string) erro
 			swName)
 	}
 	rpmInfo := listInfo[0]
+	if journal != nil {
+		err = journal.setSoftwareInfo(rpmInfo)
+		if err != nil {
+			return err
+		}
+	}
 
 	// INFO: Only for `install` action, we need to first install/extract the
 	// 		SUM RPM to get the install script. For all other actions, the
 	// 		install script is expected to run first, and hence they're
 	// 		expected to be present at the scripts location.
+	// 		When resuming an interrupted install, the already installed RPM is
+	// 		used as is, so as to continue from where the install stopped.
+	resume := params["resume"] == "true"
 	if "install" == action {
-		if rpm.IsInstalled(rpmInfo.GetRPMName()) {
-			rpm.Uninstall(rpmInfo.GetRPMName())
-		}
-
-		err = rpm.Install(absSwPath)
-		if err != nil {
-			return logutil.PrintNLogError("Failed to install software.")
+		if resume && rpm.IsInstalled(rpmInfo.GetRPMName()) {
+			log.Printf("Resuming install using the installed %s RPM.",
+				rpmInfo.GetRPMName())
+		} else {
+			err = repo.VerifyChecksum(absSwPath, params["allowUnverified"] == "true")
+			if err != nil {
+				return err
+			}
+			// INFO: The checks are run by the outer `sum` only, before the
+			// 	software is installed and its plugins are run.
+			if journal != nil {
+				if err = runPreflight(journal, rpmInfo.GetPreflightChecks()); err != nil {
+					return err
+				}
+			}
+			if rpm.IsInstalled(rpmInfo.GetRPMName()) {
+				rpm.Uninstall(rpmInfo.GetRPMName())
+			}
+
+			err = rpm.Install(absSwPath)
+			if err != nil {
+				return logutil.PrintNLogError("Failed to install software.")
+			}
 		}
 	}
 
-	script := RPMInstallRepoPath + swType + string(os.PathSeparator) +
-		fmt.Sprintf("%s-%s-%s", rpmInfo.GetRPMName(),
-			rpmInfo.GetRPMVersion(), rpmInfo.GetRPMRelease()) +
-		string(os.PathSeparator) + action
+	script := getScriptsDir(rpmInfo, swType) + action
 	log.Println("Script to be invoked:", script)
 
-	const cmdStr = "/bin/sh"
-	cmdParams := []string{script, "-output-file", output.GetFile(),
+	cmdParams := []string{"-output-file", output.GetFile(),
 		"-output-format", output.GetFormat()}
-	cmd := exec.Command(os.ExpandEnv(cmdStr), cmdParams...)
-	stdOutErr, err := cmd.CombinedOutput()
-	log.Println("Stdout & Stderr:", string(stdOutErr))
-	if err != nil {
+	if resume {
+		cmdParams = append(cmdParams, "-resume")
+	}
+	// INFO: The script runs the plugins with the same deadline, so give it
+	// 	time to handle the timeout before killing it.
+	var deadline time.Time
+	if journal != nil && !journal.Deadline.IsZero() {
+		deadline = journal.Deadline.Add(timeoutGracePeriod)
+	}
+	if err = runScript(script, action, cmdParams, deadline); err != nil {
 		log.Printf("Failed to run %s script of %s RPM. Error: %s\n",
 			script, absSwPath, err.Error())
-		if "install" == action {
+		// INFO: Keep the installed RPM when the install is left for resuming.
+		if "install" == action && !isLeftForResume(params["rollbackOnInterrupt"] == "true") {
 			rpm.Uninstall(rpmInfo.GetRPMName())
 		}
-		return logutil.PrintNLogError("Failed to %s software.", action)
+		return err
 	}
 
 	log.Printf("Successfully completed %s of %s software", action, absSwPath)
@@ -190,84 +258,121 @@ func runCmdFromRPM(action, swName, swType string, params map[string]string) erro
 	return nil
 }
 
-// Reboot runs the prereboot plugins and reboot the system as part of the
-// 	update workflow.
+// runScript runs the script of the action with the arguments, and returns
+// 	the error of the class of the failure of the script.
+func runScript(script, action string, args []string, deadline time.Time) error {
+	log.Printf("Entering update::runScript(%s, %s, %v, %s)", script, action, args, deadline)
+	defer log.Println("Exiting update::runScript")
+
+	const cmdStr = "/bin/sh"
+	cmd := exec.Command(os.ExpandEnv(cmdStr), append([]string{script}, args...)...)
+	stdOutErr, timedOut, err := runCmdWithDeadline(cmd, deadline)
+	log.Println("Stdout & Stderr:", string(stdOutErr))
+	if err == nil {
+		return nil
+	}
+	if timedOut {
+		return errcode.New(errcode.TimedOut, "Timed out to %s software. "+
+			"The %s script did not complete by %s.", action, action,
+			deadline.Format(time.RFC3339))
+	}
+	// INFO: The script runs `sum`, and exits with its exit status, which
+	// 	tells the class of the failure.
+	code := errcode.Unknown
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = errcode.FromExitStatus(exitErr.ExitCode())
+	}
+	return errcode.New(code, "Failed to %s software.", action)
+}
+
+// Reboot runs the reboot phase (by default, the prereboot plugins) and
+// 	reboot the system as part of the update workflow.
 func Reboot(result *Status, library string) bool {
 	log.Println("Entering update::Reboot")
 	defer log.Println("Exiting update::Reboot")
 
-	// Plugin Types to run for update workflow as part of prereboot script.
-	pluginTypes := []string{"prereboot"}
-
-	for _, pt := range pluginTypes {
-		result.Reboot = append(result.Reboot, pm.RunStatus{})
-		resIdx := len(result.Reboot) - 1
+	// INFO: The result of the failure handler is reported through the
+	// 	rollback status, and false is always returned to indicate reboot
+	// 	failure.
+	phase, err := runWorkflowPhase(result, &result.Reboot, PhaseReboot, library)
+	if err != nil {
+		result.Status = dStatusFail
+		result.StdOutErr = err.Error()
+		return false
+	}
 
-		err := runPM(&result.Reboot[resIdx], pt, library)
-		if err != nil {
-			result.Status = dStatusFail
-			result.StdOutErr = err.Error()
-			// INFO: Discard rollback errors, and always return false to
-			//  indicate reboot failure.
-			pt := "rollback"
-			result.Reboot = append(result.Reboot, pm.RunStatus{})
-			resIdx := len(result.Reboot) - 1
+	// Run the post-reboot actions when the node comes back up.
+	if err := installPostRebootTrigger(); err != nil {
+		result.Status = dStatusFail
+		result.StdOutErr = err.Error()
+		result.ErrorCode = errcode.Of(err)
+		return false
+	}
 
-			runPM(&result.Reboot[resIdx], pt, library)
-			return false
-		}
+	if !phase.reboots() {
+		// INFO: The workflow expects the plugins to restart the node.
+		log.Println("Skipping the reboot as per the workflow.")
+		return true
 	}
 
 	// Reboot the system after prereboot plugins are run successfully.
-	cmdStr := "systemctl"
-	cmdParams := []string{"reboot"}
-
-	cmd := exec.Command(os.ExpandEnv(cmdStr), cmdParams...)
-	stdOutErr, err := cmd.CombinedOutput()
-	log.Println("Stdout & Stderr:", string(stdOutErr))
-	if err != nil {
-		log.Printf("Failed to reboot the system. Error: %s\n", err.Error())
-		result.StdOutErr = "Failed to reboot the system."
+	if err := rebootSystem(); err != nil {
+		result.StdOutErr = err.Error()
+		result.ErrorCode = errcode.Of(err)
+		removePostRebootTrigger()
 		return false
 	}
 
 	return true
 }
 
-func runPM(result *pm.RunStatus, pluginType, library string) error {
+// runPM runs the plugins of the specified plugin type, and kills them if they
+// 	don't complete by the deadline of the plugin type. A zero deadline of
+// 	the operation means that only the plugin type's timeout (if any) applies.
+func runPM(result *pm.RunStatus, pluginType, library string, opDeadline time.Time) error {
 	log.Println("Entering update::runPM")
 	defer log.Println("Exiting update::runPM")
 
 	logutil.PrintNLog("Running %s plugins...", pluginType)
 	config.SetPluginsLibrary(library)
-
-	err := pm.Run(result, pluginType)
+	os.Setenv(EnvPluginType, pluginType)
+
+	deadline := getPluginTypeDeadline(pluginType, opDeadline)
+	timedOut, err := runWithDeadline(deadline, func() error {
+		return pm.Run(result, pluginType)
+	})
+	if timedOut {
+		result.Status = dStatusTimedOut
+		result.StdOutErr = timeoutError(pluginType, deadline).Error()
+		return newPluginError(pluginType, errcode.TimedOut,
+			"Timed out running %s plugins. %s.", pluginType, result.StdOutErr)
+	}
+	if sig := getInterruption(); err != nil && sig != nil {
+		result.Status = dStatusInterrupted
+		return newPluginError(pluginType, errcode.Interrupted,
+			"Interrupted running %s plugins by %s.", pluginType, sig)
+	}
 	if err != nil {
 		log.Printf("Failed to run %s plugins. Error: %s\n",
 			pluginType, err.Error())
-		return err
+		return &PluginError{PluginType: pluginType, Code: errcode.PluginFailed,
+			Message: err.Error()}
 	}
 	fmt.Println()
 	return nil
 }
 
-// Rollback runs the required rollback plugins of the update workflow in the
-// 	new version/partition.
+// Rollback runs the rollback phase (by default, the rollback-precheck and
+// 	prerollback plugins) of the update workflow in the new version/partition
+// 	i.e., the plugins to be run before restarting the node into the previous
+// 	version.
 func Rollback(result *Status, library string) bool {
 	log.Println("Entering update::Rollback")
 	defer log.Println("Exiting update::Rollback")
 
-	// Plugin Types to run for update workflow as part of rollback script.
-	pluginTypes := []string{"rollback-precheck", "prerollback"}
-
-	for _, pt := range pluginTypes {
-		result.Rollback = append(result.Rollback, pm.RunStatus{})
-		resIdx := len(result.Rollback) - 1
-
-		err := runPM(&result.Rollback[resIdx], pt, library)
-		if err != nil {
-			return false
-		}
+	_, err := runWorkflowPhase(result, &result.Rollback, PhaseRollback, library)
+	if err != nil {
+		return false
 	}
 	result.Status = dStatusOk
 	return true
@@ -275,10 +380,69 @@ func Rollback(result *Status, library string) bool {
 
 // cmdOptions contains subcommands and parameters of the pm command.
 var cmdOptions struct {
-	commitCmd   *flag.FlagSet
-	installCmd  *flag.FlagSet
-	rebootCmd   *flag.FlagSet
-	rollbackCmd *flag.FlagSet
+	commitCmd     *flag.FlagSet
+	historyCmd    *flag.FlagSet
+	installCmd    *flag.FlagSet
+	rebootCmd     *flag.FlagSet
+	postRebootCmd *flag.FlagSet
+	resumeCmd     *flag.FlagSet
+	rollbackCmd   *flag.FlagSet
+	scheduleCmd   *flag.FlagSet
+	statusCmd     *flag.FlagSet
+
+	// allowUnverified indicates whether to install the software whose
+	// 	checksum isn't recorded, without verifying it.
+	allowUnverified bool
+
+	// autoCommit indicates whether to commit the update after the
+	// 	post-reboot actions succeed.
+	autoCommit bool
+
+	// autoReboot indicates whether to reboot the node after the install.
+	autoReboot bool
+
+	// autoRollback indicates whether to roll back the update when the
+	// 	post-reboot actions fail.
+	autoRollback bool
+
+	// dryRun indicates whether to only list the plugins that the operation
+	// 	would run.
+	dryRun bool
+
+	// onBoot indicates that the post-reboot operation is run at boot time.
+	onBoot bool
+
+	// progress is the file, or the file descriptor to stream the progress
+	// 	of the operation to.
+	progress string
+
+	// rollbackOnInterrupt indicates whether to run the failure handler of
+	// 	the phase when the operation is interrupted by a signal.
+	rollbackOnInterrupt bool
+
+	// productVersion indicates the version of the product being updated.
+	productVersion string
+
+	// resume indicates whether to continue the interrupted operation from
+	// 	the first incomplete plugin type.
+	resume bool
+
+	// scheduleAt indicates the time to run the scheduled operation.
+	scheduleAt string
+
+	// scheduleID indicates the ID of the scheduled operation.
+	scheduleID int
+
+	// since indicates the time since when the history is listed.
+	since string
+
+	// soakEnded indicates that the post-reboot operation is run by the soak
+	// 	timer to commit the update.
+	soakEnded bool
+
+	// soakPeriod indicates the time to wait after the post-reboot actions
+	// 	before the auto commit.
+	soakPeriod time.Duration
 
 	// softwareName indicates the name of the software.
 	softwareName string
@@ -289,6 +453,9 @@ var cmdOptions struct {
 	// softwareType indicates the type of the software.
 	softwareType string
 
+	// wait indicates how long to wait for another operation to complete.
+	wait time.Duration
+
 	// logDir indicates the location for writing log file.
 	logDir string
 
@@ -303,6 +470,13 @@ func registerCmdOptions(f *flag.FlagSet) {
 		"",
 		"File name of the software.",
 	)
+	f.StringVar(
+		&cmdOptions.productVersion,
+		"product-version",
+		"",
+		"Version of the product being updated, used to determine the "+
+			"compatibility info of the software.",
+	)
 	f.StringVar(
 		&cmdOptions.softwareRepo,
 		"repo",
@@ -315,9 +489,21 @@ func registerCmdOptions(f *flag.FlagSet) {
 		"",
 		"Type of the software.",
 	)
+	registerDryRunOption(f)
+	registerProgressOption(f)
+	registerWaitOption(f)
 	output.RegisterCommandOptions(f, map[string]string{"output-format": "yaml"})
 }
 
+func registerWaitOption(f *flag.FlagSet) {
+	f.DurationVar(
+		&cmdOptions.wait,
+		"wait",
+		0,
+		"Duration to wait for another operation in progress to complete (ex: 10m).",
+	)
+}
+
 // registerCommandCommit registers install command and its options
 func registerCommandCommit(progname string) {
 	log.Printf("Entering update::registerCommandCommit(%s)", progname)
@@ -325,6 +511,7 @@ func registerCommandCommit(progname string) {
 
 	cmdOptions.commitCmd = flag.NewFlagSet(progname+" commit", flag.PanicOnError)
 	registerCmdOptions(cmdOptions.commitCmd)
+	registerResumeOption(cmdOptions.commitCmd)
 }
 
 // registerCommandInstall registers install command and its options
@@ -334,6 +521,16 @@ func registerCommandInstall(progname string) {
 
 	cmdOptions.installCmd = flag.NewFlagSet(progname+" install", flag.PanicOnError)
 	registerCmdOptions(cmdOptions.installCmd)
+	registerAutoRollbackOption(cmdOptions.installCmd)
+	registerChainOptions(cmdOptions.installCmd)
+	registerRollbackOnInterruptOption(cmdOptions.installCmd)
+	registerResumeOption(cmdOptions.installCmd)
+	cmdOptions.installCmd.BoolVar(
+		&cmdOptions.allowUnverified,
+		"allow-unverified",
+		false,
+		"Install the software even if its checksum isn't recorded, without verifying it.",
+	)
 }
 
 // registerCommandReboot registers reboot command and its options
@@ -343,6 +540,8 @@ func registerCommandReboot(progname string) {
 
 	cmdOptions.rebootCmd = flag.NewFlagSet(progname+" reboot", flag.PanicOnError)
 	registerCmdOptions(cmdOptions.rebootCmd)
+	registerAutoRollbackOption(cmdOptions.rebootCmd)
+	registerRollbackOnInterruptOption(cmdOptions.rebootCmd)
 }
 
 // registerCommandRollback registers rollback command and its options
@@ -352,6 +551,27 @@ func registerCommandRollback(progname string) {
 
 	cmdOptions.rollbackCmd = flag.NewFlagSet(progname+" rollback", flag.PanicOnError)
 	registerCmdOptions(cmdOptions.rollbackCmd)
+	registerResumeOption(cmdOptions.rollbackCmd)
+}
+
+// registerCommandResume registers resume command and its options
+func registerCommandResume(progname string) {
+	log.Printf("Entering update::registerCommandResume(%s)", progname)
+	defer log.Println("Exiting update::registerCommandResume")
+
+	cmdOptions.resumeCmd = flag.NewFlagSet(progname+" resume", flag.PanicOnError)
+	registerProgressOption(cmdOptions.resumeCmd)
+	registerWaitOption(cmdOptions.resumeCmd)
+	output.RegisterCommandOptions(cmdOptions.resumeCmd, map[string]string{"output-format": "yaml"})
+}
+
+func registerResumeOption(f *flag.FlagSet) {
+	f.BoolVar(
+		&cmdOptions.resume,
+		"resume",
+		false,
+		"Resume the interrupted operation from the first incomplete plugin type.",
+	)
 }
 
 // RegisterCommandOptions registers the command options that are supported
@@ -360,9 +580,15 @@ func RegisterCommandOptions(progname string) {
 	defer log.Println("Exiting update::RegisterCommandOptions")
 
 	registerCommandCommit(progname)
+	registerCommandHistory(progname)
 	registerCommandInstall(progname)
 	registerCommandReboot(progname)
+	registerCommandPostReboot(progname)
+	registerCommandResume(progname)
 	registerCommandRollback(progname)
+	registerCommandSchedule(progname)
+	registerCommandStatus(progname)
+	repo.SetRetentionSource(getRetention)
 }
 
 // ScanCommandOptions scans for the command line options and makes appropriate
@@ -375,6 +601,8 @@ func RegisterCommandOptions(progname string) {
 func ScanCommandOptions(options map[string]interface{}) error {
 	log.Printf("Entering ScanCommandOptions(%+v)...", options)
 	defer log.Println("Exiting ScanCommandOptions")
+	// INFO: Give the events a chance to be delivered before `sum` exits.
+	defer flushEvents()
 
 	progname := filepath.Base(os.Args[0])
 	cmdIndex := 1
@@ -388,19 +616,90 @@ func ScanCommandOptions(options map[string]interface{}) error {
 	log.Println("progname: ", progname, " cmd with arguments: ", os.Args[cmdIndex:])
 
 	var err error
+	defer func() {
+		opLock.Release()
+		opLock = nil
+	}()
+
 	switch cmd {
 	case "commit":
 		err = cmdOptions.commitCmd.Parse(os.Args[cmdIndex+1:])
 
+	case "history":
+		return runHistoryCommand(os.Args[cmdIndex+1:])
+
 	case "install":
 		err = cmdOptions.installCmd.Parse(os.Args[cmdIndex+1:])
 
 	case "reboot":
 		err = cmdOptions.rebootCmd.Parse(os.Args[cmdIndex+1:])
 
+	case "postreboot":
+		err = cmdOptions.postRebootCmd.Parse(os.Args[cmdIndex+1:])
+		if err != nil {
+			return errcode.New(errcode.InvalidUsage, "%s command arguments parse error: %s", cmd, err.Error())
+		}
+		if opLock, err = acquireLock(cmd); err != nil {
+			return err
+		}
+		journal, err := LoadJournal()
+		if err != nil {
+			return err
+		}
+		if cmdOptions.soakEnded {
+			return commitAfterSoak(journal, options["library"].(string))
+		}
+		return runPostReboot(journal, options["library"].(string),
+			cmdOptions.onBoot, cmdOptions.autoRollback)
+
+	case "resume":
+		err = cmdOptions.resumeCmd.Parse(os.Args[cmdIndex+1:])
+		if err != nil {
+			return errcode.New(errcode.InvalidUsage, "%s command arguments parse error: %s", cmd, err.Error())
+		}
+		if opLock, err = acquireLock(cmd); err != nil {
+			return err
+		}
+		journal, err := LoadJournal()
+		if err != nil {
+			return err
+		}
+		if !journal.isInterrupted() || !isResumable(journal.Operation) {
+			err = errcode.New(errcode.InvalidState, "There is no interrupted operation to "+
+				"resume. Update is %s.", journal.State)
+			output.Write(failedStatus(err))
+			return err
+		}
+		// Continue the interrupted operation with its original options.
+		logutil.PrintNLog("Resuming the interrupted %s operation...\n", journal.Operation)
+		cmd = journal.Operation
+		cmdOptions.resume = true
+		cmdOptions.softwareName = journal.SoftwareName
+		cmdOptions.softwareType = journal.SoftwareType
+		cmdOptions.softwareRepo = journal.SoftwareRepo
+
 	case "rollback":
 		err = cmdOptions.rollbackCmd.Parse(os.Args[cmdIndex+1:])
 
+	case "schedule":
+		if len(os.Args) < cmdIndex+2 {
+			cmdOptions.scheduleCmd.Usage()
+			return errcode.New(errcode.InvalidUsage, "Invalid usage. The schedule "+
+				"command requires an action.")
+		}
+		return runScheduleCommand(os.Args[cmdIndex+1], os.Args[cmdIndex+2:])
+
+	case "status":
+		err = cmdOptions.statusCmd.Parse(os.Args[cmdIndex+1:])
+		if err != nil {
+			return errcode.New(errcode.InvalidUsage, "%s command arguments parse error: %s", cmd, err.Error())
+		}
+		status, err := GetStatus(cmdOptions.softwareType)
+		if err != nil {
+			return err
+		}
+		return output.Write(status)
+
 	case "help":
 		subcmd := ""
 		if len(os.Args) == cmdIndex+2 {
@@ -410,6 +709,7 @@ func ScanCommandOptions(options map[string]interface{}) error {
 			os.Exit(2)
 		}
 		usage(progname, subcmd)
+		return nil
 
 	default:
 		fmt.Fprintf(os.Stderr, "%s: unknown command \"%s\"\n", progname, cmd)
@@ -418,17 +718,123 @@ func ScanCommandOptions(options map[string]interface{}) error {
 	}
 
 	if err != nil {
-		return logutil.PrintNLogError(cmd, "command arguments parse error:", err.Error())
+		return errcode.New(errcode.InvalidUsage, "%s command arguments parse error: %s", cmd, err.Error())
+	}
+	if cmdOptions.dryRun {
+		return dryRun(cmd, options["library"].(string))
+	}
+	var progressStream io.WriteCloser
+	if cmdOptions.progress != "" {
+		if progressStream, err = openProgressStream(cmdOptions.progress); err != nil {
+			return err
+		}
+		defer progressStream.Close()
+	}
+	if opLock == nil {
+		if opLock, err = acquireLock(cmd); err != nil {
+			return err
+		}
 	}
 
+	journal, err := LoadJournal()
+	if err != nil {
+		return err
+	}
+	// INFO: When the operation is run by the scripts of the same operation,
+	// 	the outer operation owns the journal, so leave it as is.
+	nested := journal.isNested(cmd)
+	if !nested && cmdOptions.resume {
+		err = journal.resume(cmd)
+		if err != nil {
+			output.Write(failedStatus(err))
+			return err
+		}
+		// INFO: The completed results of the interrupted run are reported
+		// 	by the resumed run.
+		discardInterruptedRuns()
+	} else if !nested {
+		err = journal.begin(cmd, cmdOptions.softwareName, cmdOptions.softwareType)
+		if err != nil {
+			output.Write(failedStatus(err))
+			return err
+		}
+		if cmdOptions.autoRollback || cmdOptions.rollbackOnInterrupt ||
+			cmdOptions.productVersion != "" || cmdOptions.softwareRepo != "" {
+			journal.AutoRollback = journal.AutoRollback || cmdOptions.autoRollback
+			journal.RollbackOnInterrupt = journal.RollbackOnInterrupt ||
+				cmdOptions.rollbackOnInterrupt
+			if cmdOptions.productVersion != "" {
+				journal.ProductVersion = cmdOptions.productVersion
+			}
+			if cmdOptions.softwareRepo != "" {
+				journal.SoftwareRepo = cmdOptions.softwareRepo
+			}
+			if err = journal.save(); err != nil {
+				return err
+			}
+		}
+		if cmdOptions.autoReboot || cmdOptions.autoCommit {
+			err = journal.setChain(cmdOptions.autoReboot, cmdOptions.autoCommit,
+				cmdOptions.soakPeriod)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	stopProgress := func() {}
+	if progressStream != nil && !nested {
+		stopProgress = streamProgress(progressStream)
+		defer stopProgress()
+	}
+	// INFO: The chained operations report the results of all the operations
+	// 	together once they're done.
+	chained := !nested && cmd == "install" && journal.AutoReboot
+
 	if cmdOptions.softwareName != "" {
 		params := map[string]string{}
 		params["softwareRepo"] = cmdOptions.softwareRepo
-		err = runCmdFromRPM(cmd, cmdOptions.softwareName, cmdOptions.softwareType, params)
+		params["productVersion"] = journal.ProductVersion
+		if cmdOptions.resume {
+			params["resume"] = "true"
+		}
+		if cmdOptions.allowUnverified {
+			params["allowUnverified"] = "true"
+		}
+		if journal.RollbackOnInterrupt {
+			params["rollbackOnInterrupt"] = "true"
+		}
+		var rpmJournal *Journal
+		if !nested {
+			rpmJournal = journal
+		}
+		err = runCmdFromRPM(rpmJournal, cmd, cmdOptions.softwareName, cmdOptions.softwareType, params)
+		status := Status{Status: dStatusOk}
+		if err != nil {
+			status = failedStatus(err)
+			if getInterruption() != nil {
+				status.Status = dStatusInterrupted
+			}
+		}
+		status.save()
+		// INFO: The results are written by the script of the software, which
+		// 	isn't run when the preflight checks fail.
+		if _, ok := err.(*PreflightError); ok && !chained {
+			stopProgress()
+			output.Write(status)
+		}
 	} else {
 		library := options["library"].(string)
+		if cmd == "reboot" {
+			// Post-reboot plugins are run from the library of reboot plugins.
+			if err = journal.setLibrary(library); err != nil {
+				return err
+			}
+		}
 
-		var status Status
+		status := journal.newStatus()
+		if isResumable(cmd) {
+			status.checkpoint = newCheckpoint(cmd, cmdOptions.resume)
+		}
 		var ret bool
 		switch cmd {
 		case "commit":
@@ -438,33 +844,104 @@ func ScanCommandOptions(options map[string]interface{}) error {
 		case "reboot":
 			ret = Reboot(&status, library)
 		case "rollback":
-			ret = Rollback(&status, library)
+			ret = runRollback(journal, &status, library)
 		}
 		if ret {
 			status.Status = dStatusOk
+		} else if sig := getInterruption(); sig != nil {
+			status.ErrorCode = errcode.Interrupted
+			err = status.fail("The %s of the update is interrupted by %s.", cmd, sig)
+			status.Status = dStatusInterrupted
 		} else {
-			err = logutil.PrintNLogError("Failed to %s the update.", cmd)
-			status.Status = dStatusFail
-			status.StdOutErr = err.Error()
+			err = status.fail("Failed to %s the update.", cmd)
 		}
+		status.save()
+		status.progress.finish(status.Status)
 
-		output.Write(status)
+		if !chained {
+			stopProgress()
+			output.Write(status)
+		}
+	}
 
+	if !nested {
+		if jerr := journal.end(cmd, err == nil); jerr != nil && err == nil {
+			err = jerr
+		}
+	}
+	if chained {
+		if err == nil {
+			err = autoReboot(journal, options["library"].(string))
+		}
+		writeChainStatus(journal)
 	}
 	return err
 }
 
+// dryRun writes the plan of the operation without running it.
+func dryRun(cmd, library string) error {
+	params := map[string]string{
+		"softwareName":   cmdOptions.softwareName,
+		"softwareRepo":   cmdOptions.softwareRepo,
+		"softwareType":   cmdOptions.softwareType,
+		"productVersion": cmdOptions.productVersion,
+	}
+	if params["productVersion"] == "" {
+		// INFO: Use the product version of the update in progress, if any.
+		if journal, err := LoadJournal(); err == nil {
+			params["productVersion"] = journal.ProductVersion
+		}
+	}
+	plan, err := DryRun(cmd, library, params)
+	if err != nil {
+		output.Write(failedStatus(err))
+		return err
+	}
+	return output.Write(plan)
+}
+
+// opLock is the system-wide lock held by the operation of this process, which
+// 	serializes the operations that modify the system.
+var opLock *lock.Lock
+
+// acquireLock takes the system-wide lock for the operation, so that no other
+// 	SUM operation modifies the system at the same time.
+func acquireLock(cmd string) (*lock.Lock, error) {
+	l, err := lock.Acquire(cmd, cmdOptions.wait)
+	if err != nil {
+		if lock.IsBusy(err) {
+			logutil.PrintNLogError("Cannot %s the update as %s.", cmd, err.Error())
+		}
+		output.Write(failedStatus(err))
+		return nil, err
+	}
+	// INFO: Trap the signals once the operation owns the system, so that
+	// 	an interruption is recorded.
+	trapSignals()
+	return l, nil
+}
+
 // Usage of command.
 func usage(progname, subcmd string) {
 	switch subcmd {
 	case "commit":
 		cmdOptions.commitCmd.Usage()
+	case "history":
+		cmdOptions.historyCmd.Usage()
 	case "install":
 		cmdOptions.installCmd.Usage()
 	case "reboot":
 		cmdOptions.rebootCmd.Usage()
+	case "postreboot":
+		cmdOptions.postRebootCmd.Usage()
+	case "resume":
+		cmdOptions.resumeCmd.Usage()
 	case "rollback":
 		cmdOptions.rollbackCmd.Usage()
+	case "schedule":
+		cmdOptions.scheduleCmd.Usage()
+	case "status":
+		cmdOptions.statusCmd.Usage()
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown help topic `%s`. Run '%s'.", subcmd, progname+" help")
 		fmt.Println()
@@ -0,0 +1,126 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"fmt"
+	pm "github.com/VeritasOS/plugin-manager"
+	"github.com/VeritasOS/plugin-manager/config"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"github.com/VeritasOS/software-update-manager/utils/lock"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var mockedExitStatus = 0
+
+// mockedCommands records the commands run through execCommand.
+var mockedCommands []string
+
+func fakeExecCommand(command string, args ...string) *exec.Cmd {
+	mockedCommands = append(mockedCommands,
+		strings.Join(append([]string{command}, args...), " "))
+	cs := []string{"-test.run=TestExecCommandHelper", "--", command}
+	cs = append(cs, args...)
+	cmd := exec.Command(os.Args[0], cs...)
+	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1",
+		"EXIT_STATUS=" + strconv.Itoa(mockedExitStatus)}
+	return cmd
+}
+
+func TestExecCommandHelper(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	fmt.Fprintf(os.Stdout, "")
+	i, _ := strconv.Atoi(os.Getenv("EXIT_STATUS"))
+	os.Exit(i)
+}
+
+func init() {
+	// INFO: PM requires its command options to be registered before running
+	// 	the plugins.
+	pm.RegisterCommandOptions("pm")
+}
+
+// setupTestEnv creates the state, log and plugins library directories for
+// 	running update operations, and returns the plugins library path along
+// 	with the function to clean up the directories.
+// 	The plugins are specified as a map of plugin file path (relative to the
+// 	library) and its contents.
+func setupTestEnv(t *testing.T, plugins map[string]string) (string, func()) {
+	tmpDir, err := ioutil.TempDir("", "sum-update")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir. Error: %s", err.Error())
+	}
+	library := filepath.Join(tmpDir, "library")
+	for file, contents := range plugins {
+		path := filepath.Join(library, file)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s. Error: %s", filepath.Dir(path), err.Error())
+		}
+		if err = ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write %s. Error: %s", path, err.Error())
+		}
+	}
+	os.MkdirAll(library, 0755)
+
+	SetStateDir(filepath.Join(tmpDir, "state"))
+	SetConfigFile(filepath.Join(tmpDir, "sum.yaml"))
+	config.SetPMLogDir(filepath.Join(tmpDir, "log"))
+	config.SetPMLogFile("sum")
+	prevUnitDir := systemdUnitDir
+	systemdUnitDir = filepath.Join(tmpDir, "systemd") + string(os.PathSeparator)
+	execCommand = fakeExecCommand
+	mockedExitStatus = 0
+	mockedCommands = nil
+	lock.SetLockFile(filepath.Join(tmpDir, "sum.lock"))
+
+	return library, func() {
+		lock.SetLockFile(lock.DefaultLockFile)
+		SetStateDir(DefaultStateDir)
+		SetConfigFile(DefaultConfigFile)
+		systemdUnitDir = prevUnitDir
+		execCommand = exec.Command
+		os.Unsetenv(runIDEnv)
+		os.RemoveAll(tmpDir)
+	}
+}
+
+func Test_runScript(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sum-scripts")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The SDK scripts run `sum` from their directory, which is stubbed to
+	// 	exit with the status of the class of the failure.
+	for _, action := range []string{"commit", "install", "reboot", "rollback"} {
+		data, err := ioutil.ReadFile(filepath.Join("..", "sdk", "scripts", action))
+		if err != nil {
+			t.Fatalf("Failed to read %s script. Error: %s", action, err.Error())
+		}
+		ioutil.WriteFile(filepath.Join(tmpDir, action), data, 0755)
+	}
+	for _, code := range []errcode.Code{errcode.PluginFailed, errcode.TimedOut,
+		errcode.Interrupted, errcode.PreflightFailed, ""} {
+		stub := fmt.Sprintf("#!/bin/sh\nexit %d\n", errcode.ExitStatus(code))
+		if code == "" {
+			stub = "#!/bin/sh\nexit 0\n"
+		}
+		ioutil.WriteFile(filepath.Join(tmpDir, "sum"), []byte(stub), 0755)
+		for _, action := range []string{"commit", "install", "reboot", "rollback"} {
+			err := runScript(filepath.Join(tmpDir, action), action, nil, time.Time{})
+			if got := errcode.Of(err); got != code {
+				t.Errorf("runScript(%s) code = %q, want %q", action, got, code)
+			}
+		}
+	}
+}
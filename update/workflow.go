@@ -0,0 +1,463 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"fmt"
+	pm "github.com/VeritasOS/plugin-manager"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// WorkflowFileName is the name of the workflow definition that a software
+// 	could ship in its plugins library to customize the update workflow.
+const WorkflowFileName = "workflow.yaml"
+
+// Phase is a step of the update workflow.
+type Phase struct {
+	// PluginTypes are the plugin types run in the phase in the given order.
+	PluginTypes []string `yaml:"plugin-types"`
+	// OnFailure are the plugin types run when any of the plugin types of
+	// 	the phase fail.
+	OnFailure []string `yaml:"on-failure,omitempty"`
+	// Reboot indicates whether the node is restarted after the phase.
+	Reboot *bool `yaml:",omitempty"`
+	// FailurePolicy is what to do when any of the plugin types of the phase
+	// 	fail i.e., auto-rollback (default), halt or retry-N.
+	FailurePolicy string `yaml:"failure-policy,omitempty"`
+	// Before and After are the built-in phase that the custom phase is run
+	// 	before or after, as part of the operation of that phase.
+	Before string `yaml:",omitempty"`
+	After  string `yaml:",omitempty"`
+}
+
+// reboots tells whether the node is restarted after the phase.
+func (p Phase) reboots() bool {
+	return p.Reboot != nil && *p.Reboot
+}
+
+// attachedTo returns the built-in phase that the custom phase is run with.
+func (p Phase) attachedTo() string {
+	if p.Before != "" {
+		return p.Before
+	}
+	return p.After
+}
+
+// Workflow is the definition of the update workflow phases.
+type Workflow struct {
+	Phases map[string]Phase
+}
+
+// Failure policies of a phase.
+// INFO: auto-rollback runs the failure handler (i.e., on-failure plugin
+// 	types) of the phase, halt leaves the system as is for inspection, and
+// 	retry-N runs the failed plugin type again up to N times before running
+// 	the failure handler.
+const (
+	FailurePolicyAutoRollback = "auto-rollback"
+	FailurePolicyHalt         = "halt"
+	failurePolicyRetryPrefix  = "retry-"
+)
+
+// failurePolicy is the parsed failure policy of a phase.
+type failurePolicy struct {
+	halt    bool
+	retries int
+}
+
+// parseFailurePolicy parses the specified failure policy.
+func parseFailurePolicy(policy string) (failurePolicy, error) {
+	switch policy {
+	case "", FailurePolicyAutoRollback:
+		return failurePolicy{}, nil
+	case FailurePolicyHalt:
+		return failurePolicy{halt: true}, nil
+	}
+	if strings.HasPrefix(policy, failurePolicyRetryPrefix) {
+		retries, err := strconv.Atoi(strings.TrimPrefix(policy, failurePolicyRetryPrefix))
+		if err == nil && retries > 0 {
+			return failurePolicy{retries: retries}, nil
+		}
+	}
+	return failurePolicy{}, fmt.Errorf("Invalid failure policy '%s'. "+
+		"Supported policies are %s, %s and %sN.", policy,
+		FailurePolicyAutoRollback, FailurePolicyHalt, failurePolicyRetryPrefix)
+}
+
+// Phases of the update workflow.
+// INFO: When rollback requires a restart, the node is restarted into the
+// 	previous version after the rollback phase, and the complete-rollback
+// 	phase is run after the restart.
+const (
+	PhaseInstall          = "install"
+	PhaseReboot           = "reboot"
+	PhasePostReboot       = "postreboot"
+	PhaseCommit           = "commit"
+	PhaseRollback         = "rollback"
+	PhaseCompleteRollback = "complete-rollback"
+)
+
+// rebootPhases are the phases that could be followed by a reboot.
+var rebootPhases = map[string]bool{
+	PhaseInstall:  true,
+	PhaseReboot:   true,
+	PhaseRollback: true,
+}
+
+func newBool(b bool) *bool {
+	return &b
+}
+
+// DefaultWorkflow returns the built-in update workflow, which is used when
+// 	the software doesn't ship its own workflow.
+func DefaultWorkflow() Workflow {
+	return Workflow{Phases: map[string]Phase{
+		PhaseInstall: {
+			PluginTypes: []string{"preinstall", "install"},
+			OnFailure:   []string{"rollback"},
+		},
+		PhaseReboot: {
+			PluginTypes: []string{"prereboot"},
+			OnFailure:   []string{"rollback"},
+			Reboot:      newBool(true),
+		},
+		PhasePostReboot: {
+			PluginTypes: []string{"postreboot"},
+		},
+		PhaseCommit: {
+			PluginTypes: []string{"commit-precheck", "commit"},
+		},
+		PhaseRollback: {
+			PluginTypes: []string{"rollback-precheck", "prerollback"},
+		},
+		PhaseCompleteRollback: {
+			PluginTypes: []string{"rollback"},
+		},
+	}}
+}
+
+func getWorkflowPath(library string) string {
+	return filepath.Join(library, WorkflowFileName)
+}
+
+// LoadWorkflow returns the update workflow of the specified plugins library.
+// 	The phases defined in the library's workflow override the corresponding
+// 	phases of the default workflow, and the fields that are not specified in
+// 	a phase are taken from the default workflow. The failure policies in the
+// 	SUM configuration override the ones in the workflow.
+func LoadWorkflow(library string) (Workflow, error) {
+	log.Printf("Entering update::LoadWorkflow(%s)", library)
+	defer log.Println("Exiting update::LoadWorkflow")
+
+	wf := DefaultWorkflow()
+	path := getWorkflowPath(library)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return wf, wf.setFailurePolicies()
+	}
+	if err != nil {
+		log.Printf("ioutil.ReadFile(%s); Error: %s", path, err.Error())
+		return wf, logutil.PrintNLogError("Failed to read the workflow %s.", path)
+	}
+
+	custom := Workflow{}
+	if err = yaml.UnmarshalStrict(data, &custom); err != nil {
+		log.Printf("yaml.UnmarshalStrict(%s); Error: %s", path, err.Error())
+		return wf, logutil.PrintNLogError("Failed to parse the workflow %s.", path)
+	}
+	if err = custom.validate(); err != nil {
+		return wf, logutil.PrintNLogError("Invalid workflow %s. %s", path, err.Error())
+	}
+	for name, phase := range custom.Phases {
+		def := wf.Phases[name]
+		if phase.PluginTypes != nil {
+			def.PluginTypes = phase.PluginTypes
+		}
+		if phase.OnFailure != nil {
+			def.OnFailure = phase.OnFailure
+		}
+		if phase.Reboot != nil {
+			def.Reboot = phase.Reboot
+		}
+		if phase.FailurePolicy != "" {
+			def.FailurePolicy = phase.FailurePolicy
+		}
+		def.Before = phase.Before
+		def.After = phase.After
+		wf.Phases[name] = def
+	}
+	if err = wf.setFailurePolicies(); err != nil {
+		return wf, err
+	}
+	wf.inheritFailureHandling()
+	log.Printf("Workflow of %s: %+v", library, wf)
+	return wf, nil
+}
+
+// validate checks whether the phases and the plugin types of the workflow
+// 	are supported. A custom phase i.e., a phase that's not built-in, must
+// 	be run either before or after a built-in phase.
+func (wf Workflow) validate() error {
+	pluginTypeRegex := regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	defaults := DefaultWorkflow()
+	for name, phase := range wf.Phases {
+		if _, ok := defaults.Phases[name]; ok {
+			if phase.attachedTo() != "" {
+				return fmt.Errorf("Built-in phase %s can't be run before or "+
+					"after another phase.", name)
+			}
+		} else {
+			if !pluginTypeRegex.MatchString(name) {
+				return fmt.Errorf("Invalid phase name '%s'.", name)
+			}
+			if (phase.Before == "") == (phase.After == "") {
+				return fmt.Errorf("Custom phase %s must specify either the "+
+					"built-in phase to run before or after.", name)
+			}
+			if _, ok := defaults.Phases[phase.attachedTo()]; !ok {
+				return fmt.Errorf("Unknown phase %s to run %s phase with.",
+					phase.attachedTo(), name)
+			}
+			if len(phase.PluginTypes) == 0 {
+				return fmt.Errorf("No plugin types in %s phase.", name)
+			}
+		}
+		for _, pt := range append(append([]string{}, phase.PluginTypes...), phase.OnFailure...) {
+			if !pluginTypeRegex.MatchString(pt) {
+				return fmt.Errorf("Invalid plugin type '%s' in %s phase.", pt, name)
+			}
+		}
+		if phase.reboots() && !rebootPhases[name] {
+			return fmt.Errorf("Reboot is not supported after %s phase.", name)
+		}
+		if _, err := parseFailurePolicy(phase.FailurePolicy); err != nil {
+			return fmt.Errorf("%s in %s phase", err.Error(), name)
+		}
+	}
+	return nil
+}
+
+// setFailurePolicies overrides the failure policies of the phases with the
+// 	ones in the SUM configuration of the node.
+func (wf Workflow) setFailurePolicies() error {
+	conf, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	for name, policy := range conf.FailurePolicies {
+		phase, ok := wf.Phases[name]
+		if !ok {
+			return logutil.PrintNLogError("Unknown phase %s in the failure "+
+				"policies of %s.", name, configFile)
+		}
+		if _, err = parseFailurePolicy(policy); err != nil {
+			return logutil.PrintNLogError("%s in the failure policies of %s.",
+				err.Error(), configFile)
+		}
+		phase.FailurePolicy = policy
+		wf.Phases[name] = phase
+	}
+	return nil
+}
+
+// inheritFailureHandling sets the failure handler and the failure policy of
+// 	the custom phases that don't specify them, to the ones of the built-in
+// 	phase that they're run with.
+func (wf Workflow) inheritFailureHandling() {
+	for name, phase := range wf.Phases {
+		attached := phase.attachedTo()
+		if attached == "" {
+			continue
+		}
+		if phase.OnFailure == nil {
+			phase.OnFailure = wf.Phases[attached].OnFailure
+		}
+		if phase.FailurePolicy == "" {
+			phase.FailurePolicy = wf.Phases[attached].FailurePolicy
+		}
+		wf.Phases[name] = phase
+	}
+}
+
+// sequence returns the phases run for the specified built-in phase i.e.,
+// 	the custom phases to be run before it, the phase itself, and the custom
+// 	phases to be run after it. The custom phases run at the same point are
+// 	run in the lexical order of their names.
+func (wf Workflow) sequence(name string) []string {
+	before, after := []string{}, []string{}
+	for custom, phase := range wf.Phases {
+		switch {
+		case phase.Before == name:
+			before = append(before, custom)
+		case phase.After == name:
+			after = append(after, custom)
+		}
+	}
+	sort.Strings(before)
+	sort.Strings(after)
+	return append(append(before, name), after...)
+}
+
+// pluginTypes returns the plugin types run for the specified built-in phase,
+// 	including the ones of the custom phases run with it, in order.
+func (wf Workflow) pluginTypes(name string) []string {
+	pluginTypes := []string{}
+	for _, seqName := range wf.sequence(name) {
+		pluginTypes = append(pluginTypes, wf.Phases[seqName].PluginTypes...)
+	}
+	return pluginTypes
+}
+
+// getWorkflowPhase returns the specified phase of the update workflow of
+// 	the plugins library.
+func getWorkflowPhase(name, library string) (Phase, error) {
+	wf, err := LoadWorkflow(library)
+	if err != nil {
+		return Phase{}, err
+	}
+	return wf.Phases[name], nil
+}
+
+// runWorkflowPhase runs the specified built-in phase along with the custom
+// 	phases to be run before and after it, and records the results of their
+// 	plugin types into the specified results of the operation. The phases
+// 	after a failed phase are not run.
+func runWorkflowPhase(result *Status, results *[]pm.RunStatus, name, library string) (phase Phase, err error) {
+	log.Printf("Entering update::runWorkflowPhase(%s, %s)", name, library)
+	defer log.Println("Exiting update::runWorkflowPhase")
+
+	wf, err := LoadWorkflow(library)
+	if err != nil {
+		return phase, err
+	}
+	for _, seqName := range wf.sequence(name) {
+		if err = runWorkflowStep(result, results, wf, seqName, library); err != nil {
+			break
+		}
+	}
+	return wf.Phases[name], err
+}
+
+// runWorkflowStep runs the plugin types of the specified phase of the
+// 	workflow. When any of the plugin types fail, the failure policy of the
+// 	phase is applied, and the result of the failure handler, if run, is
+// 	recorded in the status.
+func runWorkflowStep(result *Status, results *[]pm.RunStatus, wf Workflow, name, library string) (err error) {
+	log.Printf("Entering update::runWorkflowStep(%s, %s)", name, library)
+	defer log.Println("Exiting update::runWorkflowStep")
+
+	phase := wf.Phases[name]
+	result.progress.startPhase(wf, name, library)
+	setPluginEnv(name)
+	event := newEvent(EventPhaseStarted)
+	event.Phase = name
+	emitEvent(event)
+	defer func() {
+		event = newEvent(EventPhaseFinished)
+		event.Phase = name
+		event.Status = dStatusOk
+		if err != nil {
+			event.Status = dStatusFail
+			if getInterruption() != nil {
+				event.Status = dStatusInterrupted
+			}
+			event.ErrorCode = result.ErrorCode
+			event.Message = err.Error()
+		}
+		emitEvent(event)
+	}()
+	// INFO: The policy is validated when the workflow is loaded.
+	policy, _ := parseFailurePolicy(phase.FailurePolicy)
+	for _, pt := range phase.PluginTypes {
+		if sig := getInterruption(); sig != nil {
+			err = newPluginError(pt, errcode.Interrupted, "Skipping %s plugins "+
+				"as the operation is interrupted by %s.", pt, sig)
+		} else {
+			err = runPhase(result, results, pt, library)
+		}
+		for try := 1; err != nil && try <= policy.retries && getInterruption() == nil; try++ {
+			logutil.PrintNLog("Retrying %s plugins (%d of %d)...\n", pt, try,
+				policy.retries)
+			err = runPhase(result, results, pt, library)
+		}
+		if err == nil {
+			continue
+		}
+		result.ErrorCode = errcode.Of(err)
+		if isLeftForResume(result.rollbackOnInterrupt) {
+			// INFO: The interrupted operation is left as is for resuming.
+			return err
+		}
+		if policy.halt {
+			logutil.PrintNLog("Leaving the system as is for inspection, as the "+
+				"failure policy of %s is %s.\n", name, FailurePolicyHalt)
+			return err
+		}
+		runFailureHandler(result, results, phase, library)
+		return err
+	}
+	return nil
+}
+
+// runFailureHandler runs the failure handler plugin types of the phase, and
+// 	records whether they succeeded in the status.
+func runFailureHandler(result *Status, results *[]pm.RunStatus, phase Phase, library string) {
+	if len(phase.OnFailure) == 0 {
+		return
+	}
+	// INFO: The failure handler is run even when the operation has timed
+	// 	out, and so only the timeouts of its plugin types apply.
+	result.deadline = time.Time{}
+	var rerr error
+	for _, fpt := range phase.OnFailure {
+		if err := runPhase(result, results, fpt, library); err != nil && rerr == nil {
+			rerr = err
+		}
+	}
+	result.RollbackStatus = dStatusOk
+	result.RollbackStdOutErr = ""
+	if rerr != nil {
+		result.RollbackStatus = dStatusFail
+		result.RollbackStdOutErr = rerr.Error()
+		result.ErrorCode = errcode.RollbackFailed
+	}
+	result.save()
+}
+
+// runRebootCommand runs the reboot operation of the update, same as the
+// 	install plugins calling `sum reboot` as their last step.
+func runRebootCommand() error {
+	log.Println("Entering update::runRebootCommand")
+	defer log.Println("Exiting update::runRebootCommand")
+
+	sumPath, err := os.Executable()
+	if err != nil {
+		log.Printf("os.Executable(); Error: %s", err.Error())
+		return logutil.PrintNLogError("Failed to determine the %s path.", os.Args[0])
+	}
+	cmd := execCommand(sumPath, "reboot")
+	stdOutErr, err := cmd.CombinedOutput()
+	log.Println("Stdout & Stderr:", string(stdOutErr))
+	if err != nil {
+		log.Printf("Failed to run %s reboot. Error: %s", sumPath, err.Error())
+		code := errcode.RebootFailed
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			code = errcode.FromExitStatus(exitErr.ExitCode())
+		}
+		return errcode.New(code, "Failed to reboot the node after install.")
+	}
+	return nil
+}
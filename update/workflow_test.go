@@ -0,0 +1,339 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package update
+
+import (
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadWorkflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		workflow string
+		want     map[string]Phase
+		wantErr  bool
+	}{
+		{
+			name: "Default workflow",
+			want: DefaultWorkflow().Phases,
+		},
+		{
+			name: "Extra plugin types",
+			workflow: `phases:
+  install:
+    plugin-types: [preflight, preinstall, install]
+  commit:
+    plugin-types: [commit-precheck, commit, postcommit]
+    on-failure: [commit-failed]
+`,
+			want: map[string]Phase{
+				PhaseInstall: {
+					PluginTypes: []string{"preflight", "preinstall", "install"},
+					OnFailure:   []string{"rollback"},
+				},
+				PhaseCommit: {
+					PluginTypes: []string{"commit-precheck", "commit", "postcommit"},
+					OnFailure:   []string{"commit-failed"},
+				},
+				PhaseReboot: DefaultWorkflow().Phases[PhaseReboot],
+			},
+		},
+		{
+			name: "Reboot after install",
+			workflow: `phases:
+  install:
+    reboot: true
+`,
+			want: map[string]Phase{
+				PhaseInstall: {
+					PluginTypes: []string{"preinstall", "install"},
+					OnFailure:   []string{"rollback"},
+					Reboot:      newBool(true),
+				},
+			},
+		},
+		{
+			name: "Custom phase",
+			workflow: `phases:
+  preflight:
+    plugin-types: [preflight]
+    before: install
+  postcommit:
+    plugin-types: [postcommit]
+    after: commit
+    on-failure: []
+    failure-policy: halt
+`,
+			want: map[string]Phase{
+				"preflight": {
+					PluginTypes: []string{"preflight"},
+					OnFailure:   []string{"rollback"},
+					Before:      PhaseInstall,
+				},
+				"postcommit": {
+					PluginTypes:   []string{"postcommit"},
+					OnFailure:     []string{},
+					FailurePolicy: FailurePolicyHalt,
+					After:         PhaseCommit,
+				},
+			},
+		},
+		{
+			name:     "Custom phase not run with a built-in phase",
+			workflow: "phases:\n  verify:\n    plugin-types: [verify]\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Custom phase run with an unknown phase",
+			workflow: "phases:\n  verify:\n    plugin-types: [verify]\n    after: preflight\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Custom phase run before and after",
+			workflow: "phases:\n  verify:\n    plugin-types: [verify]\n    before: install\n    after: install\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Custom phase without plugin types",
+			workflow: "phases:\n  verify:\n    after: install\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Reboot after custom phase",
+			workflow: "phases:\n  verify:\n    plugin-types: [verify]\n    after: install\n    reboot: true\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Built-in phase run with another",
+			workflow: "phases:\n  commit:\n    after: install\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Unknown field",
+			workflow: "phases:\n  commit:\n    plugins: [commit]\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Invalid plugin type",
+			workflow: "phases:\n  commit:\n    plugin-types: [../commit]\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Reboot after commit",
+			workflow: "phases:\n  commit:\n    reboot: true\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Failure policy",
+			workflow: "phases:\n  install:\n    failure-policy: retry-2\n",
+			want: map[string]Phase{
+				PhaseInstall: {
+					PluginTypes:   []string{"preinstall", "install"},
+					OnFailure:     []string{"rollback"},
+					FailurePolicy: "retry-2",
+				},
+			},
+		},
+		{
+			name:     "Invalid failure policy",
+			workflow: "phases:\n  install:\n    failure-policy: retry-many\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			library, cleanup := setupTestEnv(t, nil)
+			defer cleanup()
+			if tt.workflow != "" {
+				path := filepath.Join(library, WorkflowFileName)
+				if err := ioutil.WriteFile(path, []byte(tt.workflow), 0644); err != nil {
+					t.Fatalf("Failed to write %s. Error: %s", path, err.Error())
+				}
+			}
+
+			got, err := LoadWorkflow(library)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadWorkflow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for name, want := range tt.want {
+				if !reflect.DeepEqual(got.Phases[name], want) {
+					t.Errorf("LoadWorkflow() %s phase = %+v, want %+v",
+						name, got.Phases[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCommit_workflow(t *testing.T) {
+	plugins := map[string]string{
+		"A/a.commit":     "Description=Commit\nExecStart=/bin/true\n",
+		"A/a.postcommit": "Description=Post commit\nExecStart=/bin/false\n",
+		"A/a.revert":     "Description=Revert\nExecStart=/bin/true\n",
+		WorkflowFileName: `phases:
+  commit:
+    plugin-types: [commit, postcommit]
+    on-failure: [revert]
+`,
+	}
+	library, cleanup := setupTestEnv(t, plugins)
+	defer cleanup()
+
+	status := Status{}
+	if Commit(&status, library) {
+		t.Errorf("Commit() = true, want false")
+	}
+	gotTypes := []string{}
+	for _, rs := range status.Commit {
+		gotTypes = append(gotTypes, rs.Type)
+	}
+	wantTypes := []string{"commit", "postcommit", "revert"}
+	if !reflect.DeepEqual(gotTypes, wantTypes) {
+		t.Errorf("Commit() results %v, want %v", gotTypes, wantTypes)
+	}
+}
+
+func TestInstall_failurePolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       string
+		rollback     string
+		wantTypes    []string
+		wantRollback string
+		wantCode     errcode.Code
+	}{
+		{
+			name:         "Auto rollback",
+			rollback:     "/bin/true",
+			wantTypes:    []string{"preinstall", "rollback"},
+			wantRollback: dStatusOk,
+			wantCode:     errcode.PluginFailed,
+		},
+		{
+			name:         "Auto rollback fails",
+			policy:       "failure-policies:\n  install: auto-rollback\n",
+			rollback:     "/bin/false",
+			wantTypes:    []string{"preinstall", "rollback"},
+			wantRollback: dStatusFail,
+			wantCode:     errcode.RollbackFailed,
+		},
+		{
+			name:      "Halt",
+			policy:    "failure-policies:\n  install: halt\n",
+			rollback:  "/bin/true",
+			wantTypes: []string{"preinstall"},
+			wantCode:  errcode.PluginFailed,
+		},
+		{
+			name:         "Retry",
+			policy:       "failure-policies:\n  install: retry-2\n",
+			rollback:     "/bin/true",
+			wantTypes:    []string{"preinstall", "preinstall", "preinstall", "rollback"},
+			wantRollback: dStatusOk,
+			wantCode:     errcode.PluginFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugins := map[string]string{
+				"A/a.preinstall": "Description=Pre install\nExecStart=/bin/false\n",
+				"A/a.install":    "Description=Install\nExecStart=/bin/true\n",
+				"A/a.rollback":   "Description=Rollback\nExecStart=" + tt.rollback + "\n",
+			}
+			library, cleanup := setupTestEnv(t, plugins)
+			defer cleanup()
+			writeTestConfig(t, library, tt.policy)
+
+			status := Status{}
+			if Install(&status, library) {
+				t.Errorf("Install() = true, want false")
+			}
+			gotTypes := []string{}
+			for _, rs := range status.Install {
+				gotTypes = append(gotTypes, rs.Type)
+			}
+			if !reflect.DeepEqual(gotTypes, tt.wantTypes) {
+				t.Errorf("Install() results %v, want %v", gotTypes, tt.wantTypes)
+			}
+			if status.RollbackStatus != tt.wantRollback {
+				t.Errorf("Install() rollback status = %q, want %q",
+					status.RollbackStatus, tt.wantRollback)
+			}
+			if status.ErrorCode != tt.wantCode {
+				t.Errorf("Install() error code = %q, want %q",
+					status.ErrorCode, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestInstall_customPhases(t *testing.T) {
+	workflow := `phases:
+  preflight:
+    plugin-types: [preflight]
+    before: install
+  verify:
+    plugin-types: [verify]
+    after: install
+  checks:
+    plugin-types: [checks]
+    before: install
+`
+	tests := []struct {
+		name      string
+		preflight string
+		wantOk    bool
+		wantTypes []string
+	}{
+		{
+			name:      "Succeeds",
+			preflight: "/bin/true",
+			wantOk:    true,
+			wantTypes: []string{"checks", "preflight", "preinstall", "install", "verify"},
+		},
+		{
+			// The phases after the failed one are not run, and the failure
+			// 	handler of the install phase is inherited.
+			name:      "Fails",
+			preflight: "/bin/false",
+			wantTypes: []string{"checks", "preflight", "rollback"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugins := map[string]string{
+				"A/a.checks":     "Description=Checks\nExecStart=/bin/true\n",
+				"A/a.preflight":  "Description=Preflight\nExecStart=" + tt.preflight + "\n",
+				"A/a.preinstall": "Description=Pre install\nExecStart=/bin/true\n",
+				"A/a.install":    "Description=Install\nExecStart=/bin/true\n",
+				"A/a.verify":     "Description=Verify\nExecStart=${PM_LIBRARY}/A/phase.sh\n",
+				"A/a.rollback":   "Description=Rollback\nExecStart=/bin/true\n",
+				"A/phase.sh":     "#!/bin/sh\n[ \"$SUM_PHASE\" = verify ]\n",
+				WorkflowFileName: workflow,
+			}
+			library, cleanup := setupTestEnv(t, plugins)
+			defer cleanup()
+			os.Chmod(filepath.Join(library, "A", "phase.sh"), 0755)
+
+			status := Status{}
+			if got := Install(&status, library); got != tt.wantOk {
+				t.Errorf("Install() = %v, want %v. Status: %+v", got, tt.wantOk, status)
+			}
+			gotTypes := []string{}
+			for _, rs := range status.Install {
+				gotTypes = append(gotTypes, rs.Type)
+			}
+			if !reflect.DeepEqual(gotTypes, tt.wantTypes) {
+				t.Errorf("Install() results %v, want %v", gotTypes, tt.wantTypes)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+// Package errcode defines the classes of SUM failures, which are reported as
+// 	the ErrorCode in the output documents, and as the exit status of `sum`.
+package errcode
+
+import (
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+)
+
+// Version of the error code table.
+// INFO: The version is incremented whenever a code is added. The codes and
+// 	the exit statuses once published are never changed or reused, so that
+// 	the orchestration tools can rely on them.
+const Version = 4
+
+// Code is the class of a SUM failure.
+type Code string
+
+// Classes of SUM failures.
+const (
+	Unknown          Code = "unknown"
+	InvalidUsage     Code = "invalid-usage"
+	Busy             Code = "busy"
+	SoftwareNotFound Code = "software-not-found"
+	SignatureInvalid Code = "signature-invalid"
+	NotCompatible    Code = "not-compatible"
+	InvalidState     Code = "invalid-state"
+	PluginFailed     Code = "plugin-failed"
+	TimedOut         Code = "timed-out"
+	Interrupted      Code = "interrupted"
+	RebootFailed     Code = "reboot-failed"
+	RollbackFailed   Code = "rollback-failed"
+	PreflightFailed  Code = "preflight-failed"
+	ChecksumMismatch Code = "checksum-mismatch"
+	SoftwareConflict Code = "software-conflict"
+)
+
+// exitStatuses maps the classes of failures to the exit status of `sum`.
+var exitStatuses = map[Code]int{
+	Unknown:          1,
+	InvalidUsage:     2,
+	Busy:             3,
+	SoftwareNotFound: 4,
+	SignatureInvalid: 5,
+	NotCompatible:    6,
+	InvalidState:     7,
+	PluginFailed:     8,
+	TimedOut:         9,
+	Interrupted:      10,
+	RebootFailed:     11,
+	RollbackFailed:   12,
+	PreflightFailed:  13,
+	ChecksumMismatch: 14,
+	SoftwareConflict: 15,
+}
+
+// ExitStatus returns the exit status of `sum` for the class of failure.
+func ExitStatus(code Code) int {
+	if status, ok := exitStatuses[code]; ok {
+		return status
+	}
+	return exitStatuses[Unknown]
+}
+
+// FromExitStatus returns the class of failure of a `sum` that exited with
+// 	the specified status.
+func FromExitStatus(status int) Code {
+	for code, s := range exitStatuses {
+		if s == status {
+			return code
+		}
+	}
+	return Unknown
+}
+
+// Coder is implemented by the errors of a known class of failure.
+type Coder interface {
+	ErrorCode() Code
+}
+
+// Of returns the class of failure of the error. A nil error has no class,
+// 	and the errors that are not of a known class are of Unknown class.
+func Of(err error) Code {
+	if err == nil {
+		return ""
+	}
+	if c, ok := err.(Coder); ok {
+		return c.ErrorCode()
+	}
+	return Unknown
+}
+
+// Error is a failure of a known class, which doesn't have a specific error
+// 	type.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ErrorCode returns the class of the failure.
+func (e *Error) ErrorCode() Code {
+	return e.Code
+}
+
+// New prints and logs the error message same as logutil.PrintNLogError, and
+// 	returns the error of the specified class.
+func New(code Code, format string, a ...interface{}) error {
+	return &Error{Code: code, Message: logutil.PrintNLogError(format, a...).Error()}
+}
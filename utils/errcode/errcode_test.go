@@ -0,0 +1,63 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package errcode
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExitStatus(t *testing.T) {
+	// INFO: The exit statuses are part of the interface of `sum`, and must
+	// 	not change.
+	want := map[Code]int{
+		Unknown:          1,
+		InvalidUsage:     2,
+		Busy:             3,
+		SoftwareNotFound: 4,
+		SignatureInvalid: 5,
+		NotCompatible:    6,
+		InvalidState:     7,
+		PluginFailed:     8,
+		TimedOut:         9,
+		Interrupted:      10,
+		RebootFailed:     11,
+		RollbackFailed:   12,
+		PreflightFailed:  13,
+		ChecksumMismatch: 14,
+		SoftwareConflict: 15,
+	}
+	if len(exitStatuses) != len(want) {
+		t.Errorf("exitStatuses has %d codes, want %d", len(exitStatuses), len(want))
+	}
+	for code, status := range want {
+		if got := ExitStatus(code); got != status {
+			t.Errorf("ExitStatus(%s) = %d, want %d", code, got, status)
+		}
+		if got := FromExitStatus(status); got != code {
+			t.Errorf("FromExitStatus(%d) = %s, want %s", status, got, code)
+		}
+	}
+	if got := ExitStatus("no-such-code"); got != 1 {
+		t.Errorf("ExitStatus(no-such-code) = %d, want 1", got)
+	}
+}
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Code
+	}{
+		{name: "No error", want: ""},
+		{name: "Untyped error", err: errors.New("failed"), want: Unknown},
+		{name: "Typed error", err: &Error{Code: TimedOut}, want: TimedOut},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Of(tt.err); got != tt.want {
+				t.Errorf("Of() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
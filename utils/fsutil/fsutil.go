@@ -0,0 +1,62 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+// Package fsutil contains file system utility functions required by SUM.
+package fsutil
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes data to the specified file such that readers either
+// 	see the old contents or the new contents, but never a partial file.
+// 	The data is written into a temporary file in the same directory, synced
+// 	to the disk, and then renamed to the specified file.
+func WriteFileAtomic(filePath string, data []byte, perm os.FileMode) error {
+	log.Printf("Entering fsutil::WriteFileAtomic(%s)", filePath)
+	defer log.Println("Exiting fsutil::WriteFileAtomic")
+
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("os.MkdirAll(%s); Error: %s", dir, err.Error())
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(dir, "."+filepath.Base(filePath)+".")
+	if err != nil {
+		log.Printf("ioutil.TempFile(%s); Error: %s", dir, err.Error())
+		return err
+	}
+	tmpName := tmpFile.Name()
+	// Remove the temporary file on any failure. After a successful rename,
+	// 	the removal fails silently as the file no longer exists.
+	defer os.Remove(tmpName)
+
+	if _, err = tmpFile.Write(data); err == nil {
+		err = tmpFile.Sync()
+	}
+	if cerr := tmpFile.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmpName, perm)
+	}
+	if err != nil {
+		log.Printf("Failed to write to %s file. Error: %s", tmpName, err.Error())
+		return err
+	}
+
+	if err = os.Rename(tmpName, filePath); err != nil {
+		log.Printf("os.Rename(%s, %s); Error: %s", tmpName, filePath, err.Error())
+		return err
+	}
+
+	// Sync the directory so that the rename is persisted as well.
+	if d, derr := os.Open(dir); derr == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
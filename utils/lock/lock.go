@@ -0,0 +1,187 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+// Package lock provides the system-wide lock that serializes the SUM
+// 	operations modifying the system or the software repository.
+package lock
+
+import (
+	"fmt"
+	logutil "github.com/VeritasOS/plugin-manager/utils/log"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultLockFile is the location of the SUM operation lock.
+const DefaultLockFile = "/var/lock/sum.lock"
+
+// HolderEnv is the environment variable that carries the PID of the lock
+// 	holder to its child processes, so that a `sum` invoked by the plugins or
+// 	scripts of an operation doesn't wait for the lock held by its parent.
+const HolderEnv = "SUM_LOCK_PID"
+
+var lockFile = DefaultLockFile
+
+// pollInterval is the interval at which the lock is retried while waiting.
+var pollInterval = time.Second
+
+// SetLockFile sets the location of the SUM operation lock.
+func SetLockFile(path string) {
+	lockFile = filepath.Clean(path)
+}
+
+// Holder contains the details of the operation holding the lock.
+type Holder struct {
+	PID     int
+	Command string
+	Started time.Time
+}
+
+// BusyError is returned when the lock is held by another operation.
+type BusyError struct {
+	Holder Holder
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("operation %s in progress since %s by PID %d",
+		e.Holder.Command, e.Holder.Started.Format(time.RFC3339), e.Holder.PID)
+}
+
+// ErrorCode returns the class of the failure.
+func (e *BusyError) ErrorCode() errcode.Code {
+	return errcode.Busy
+}
+
+// IsBusy tells whether the error is due to the lock being held by another
+// 	operation.
+func IsBusy(err error) bool {
+	_, ok := err.(*BusyError)
+	return ok
+}
+
+// Lock is the SUM operation lock held by this process.
+type Lock struct {
+	file *os.File
+}
+
+// Acquire takes the lock for the specified command. If the lock is held by
+// 	another operation, it's retried until the wait duration elapses, after
+// 	which a BusyError is returned.
+// INFO: The lock is an advisory lock on the lock file, and so it's released
+// 	by the kernel when the holder dies. The holder details left behind by
+// 	such a holder are stale, and are overwritten by the next holder.
+func Acquire(command string, wait time.Duration) (*Lock, error) {
+	log.Printf("Entering lock::Acquire(%s, %s)", command, wait)
+	defer log.Println("Exiting lock::Acquire")
+
+	if err := os.MkdirAll(filepath.Dir(lockFile), 0755); err != nil {
+		log.Printf("os.MkdirAll(%s); Error: %s", filepath.Dir(lockFile), err.Error())
+		return nil, logutil.PrintNLogError("Failed to create the lock file %s.", lockFile)
+	}
+	file, err := os.OpenFile(lockFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		log.Printf("os.OpenFile(%s); Error: %s", lockFile, err.Error())
+		return nil, logutil.PrintNLogError("Failed to open the lock file %s.", lockFile)
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK {
+			file.Close()
+			log.Printf("syscall.Flock(%s); Error: %s", lockFile, err.Error())
+			return nil, logutil.PrintNLogError("Failed to lock %s.", lockFile)
+		}
+
+		holder := readHolder(file)
+		if os.Getenv(HolderEnv) == strconv.Itoa(holder.PID) {
+			// INFO: Run as part of the operation holding the lock.
+			log.Printf("Lock is held by the parent operation %+v.", holder)
+			file.Close()
+			return &Lock{}, nil
+		}
+		if !time.Now().Before(deadline) {
+			file.Close()
+			return nil, &BusyError{Holder: holder}
+		}
+		log.Printf("Waiting for the lock held by %+v.", holder)
+		time.Sleep(pollInterval)
+	}
+
+	if stale := readHolder(file); stale.PID != 0 {
+		logutil.PrintNLogWarning("Recovering the stale lock of %s operation "+
+			"(PID %d) started at %s.", stale.Command, stale.PID,
+			stale.Started.Format(time.RFC3339))
+	}
+	holder := Holder{PID: os.Getpid(), Command: command, Started: time.Now()}
+	if err = writeHolder(file, holder); err != nil {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+		return nil, logutil.PrintNLogError("Failed to record the lock holder in %s.", lockFile)
+	}
+	os.Setenv(HolderEnv, strconv.Itoa(holder.PID))
+	return &Lock{file: file}, nil
+}
+
+// Release gives up the lock.
+func (l *Lock) Release() {
+	log.Println("Entering lock::Release")
+	defer log.Println("Exiting lock::Release")
+
+	if l == nil || l.file == nil {
+		return
+	}
+	// Clear the holder details so that they aren't mistaken as stale.
+	if err := l.file.Truncate(0); err != nil {
+		log.Printf("Failed to clear %s. Error: %s", lockFile, err.Error())
+	}
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	l.file.Close()
+	l.file = nil
+	os.Unsetenv(HolderEnv)
+}
+
+func readHolder(file *os.File) Holder {
+	holder := Holder{}
+	if _, err := file.Seek(0, 0); err != nil {
+		log.Printf("Failed to seek %s. Error: %s", lockFile, err.Error())
+		return holder
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		log.Printf("Failed to read %s. Error: %s", lockFile, err.Error())
+		return holder
+	}
+	if err = yaml.Unmarshal(data, &holder); err != nil {
+		log.Printf("yaml.Unmarshal(%s); Error: %s", lockFile, err.Error())
+	}
+	return holder
+}
+
+func writeHolder(file *os.File, holder Holder) error {
+	out, err := yaml.Marshal(holder)
+	if err != nil {
+		log.Printf("yaml.Marshal(%+v); Error: %s", holder, err.Error())
+		return err
+	}
+	if err = file.Truncate(0); err == nil {
+		_, err = file.WriteAt(out, 0)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		log.Printf("Failed to write %s. Error: %s", lockFile, err.Error())
+	}
+	return err
+}
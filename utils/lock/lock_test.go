@@ -0,0 +1,63 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package lock
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquire(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sum-lock")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(tmpDir)
+	SetLockFile(filepath.Join(tmpDir, "sum.lock"))
+	defer SetLockFile(DefaultLockFile)
+	pollInterval = 10 * time.Millisecond
+	defer func() { pollInterval = time.Second }()
+	defer os.Unsetenv(HolderEnv)
+
+	// A lock left behind by a holder that died is recovered.
+	stale := "pid: 1\ncommand: install\nstarted: 2021-01-01T00:00:00Z\n"
+	if err = ioutil.WriteFile(lockFile, []byte(stale), 0644); err != nil {
+		t.Fatalf("Failed to write %s. Error: %s", lockFile, err.Error())
+	}
+	l, err := Acquire("install", 0)
+	if err != nil {
+		t.Fatalf("Acquire() with stale lock error = %v", err)
+	}
+
+	// Child processes of the holder run as part of the holder's operation.
+	nested, err := Acquire("reboot", 0)
+	if err != nil {
+		t.Fatalf("Acquire() by the holder's child error = %v", err)
+	}
+	nested.Release()
+
+	// Other processes are refused, even after waiting.
+	os.Unsetenv(HolderEnv)
+	_, err = Acquire("remove", 50*time.Millisecond)
+	if !IsBusy(err) {
+		t.Fatalf("Acquire() while locked error = %v, want BusyError", err)
+	}
+	if !strings.Contains(err.Error(), "operation install in progress since") {
+		t.Errorf("Acquire() while locked error = %v", err)
+	}
+
+	// Waiting callers get the lock once it's released.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		l.Release()
+	}()
+	l, err = Acquire("remove", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Acquire() with wait error = %v", err)
+	}
+	l.Release()
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+// Package process contains process management utility functions required by
+// 	SUM.
+package process
+
+import (
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// procDir is where the kernel exposes the details of the processes.
+var procDir = "/proc"
+
+// getParents returns the parent of each of the running processes.
+func getParents() map[int]int {
+	parents := map[int]int{}
+	statFiles, err := filepath.Glob(filepath.Join(procDir, "[0-9]*", "stat"))
+	if err != nil {
+		log.Printf("filepath.Glob(%s); Error: %s", procDir, err.Error())
+		return parents
+	}
+	for _, statFile := range statFiles {
+		data, err := ioutil.ReadFile(statFile)
+		if err != nil {
+			// INFO: The process might have exited in the meantime.
+			continue
+		}
+		// INFO: The stat is "pid (comm) state ppid ...", where comm could
+		// 	contain spaces and parentheses, so parse after the last ')'.
+		stat := string(data)
+		idx := strings.LastIndex(stat, ")")
+		if idx < 0 {
+			continue
+		}
+		fields := strings.Fields(stat[idx+1:])
+		if len(fields) < 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.Fields(stat)[0])
+		if err != nil {
+			continue
+		}
+		ppid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		parents[pid] = ppid
+	}
+	return parents
+}
+
+// Descendants returns the children, grandchildren and so on of the specified
+// 	process.
+func Descendants(pid int) []int {
+	children := map[int][]int{}
+	for child, parent := range getParents() {
+		children[parent] = append(children[parent], child)
+	}
+	descendants := []int{}
+	queue := []int{pid}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, child := range children[cur] {
+			descendants = append(descendants, child)
+			queue = append(queue, child)
+		}
+	}
+	return descendants
+}
+
+// SignalDescendants sends the signal to all the descendants of the specified
+// 	process, except the ones in the specified process groups, and returns
+// 	the number of processes signalled.
+func SignalDescendants(pid int, sig syscall.Signal, excludeGroups ...int) int {
+	log.Printf("Entering process::SignalDescendants(%d, %s, %v)", pid, sig, excludeGroups)
+	defer log.Println("Exiting process::SignalDescendants")
+
+	excluded := map[int]bool{}
+	for _, pgid := range excludeGroups {
+		excluded[pgid] = true
+	}
+	signalled := 0
+	for _, child := range Descendants(pid) {
+		if len(excluded) != 0 {
+			if pgid, err := syscall.Getpgid(child); err == nil && excluded[pgid] {
+				continue
+			}
+		}
+		if err := syscall.Kill(child, sig); err != nil {
+			log.Printf("syscall.Kill(%d, %s); Error: %s", child, sig, err.Error())
+			continue
+		}
+		signalled++
+	}
+	return signalled
+}
+
+// KillDescendants kills all the descendants of the specified process, except
+// 	the ones in the specified process groups, and returns the number of
+// 	processes killed.
+func KillDescendants(pid int, excludeGroups ...int) int {
+	return SignalDescendants(pid, syscall.SIGKILL, excludeGroups...)
+}
+
+// Cmdline returns the command line of the specified process, with its
+// 	arguments separated by a space.
+func Cmdline(pid int) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return "", err
+	}
+	args := strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+	return strings.Join(args, " "), nil
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2021 Veritas Technologies LLC. All rights reserved. IP63-2828-7171-04-15-9
+
+package process
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKillDescendants(t *testing.T) {
+	// The shell runs a background sleep (grandchild) and a foreground one.
+	cmd := exec.Command("/bin/sh", "-c", "sleep 60 & sleep 60")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start %v. Error: %s", cmd.Args, err.Error())
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	// Wait for the shell to start the sleeps.
+	for i := 0; i < 100 && len(Descendants(cmd.Process.Pid)) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := len(Descendants(cmd.Process.Pid)); got != 2 {
+		t.Fatalf("Descendants() of the shell = %d, want 2", got)
+	}
+
+	if got := KillDescendants(os.Getpid()); got < 3 {
+		t.Errorf("KillDescendants() = %d, want at least 3", got)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("KillDescendants() didn't kill the shell")
+	}
+}
+
+func TestKillDescendants_excludeGroups(t *testing.T) {
+	// The shell is run in its own process group, which is excluded.
+	cmd := exec.Command("/bin/sh", "-c", "sleep 60; true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start %v. Error: %s", cmd.Args, err.Error())
+	}
+	defer cmd.Wait()
+	defer syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	for i := 0; i < 100 && len(Descendants(cmd.Process.Pid)) < 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := KillDescendants(os.Getpid(), cmd.Process.Pid); got != 0 {
+		t.Errorf("KillDescendants() = %d, want 0", got)
+	}
+	if err := syscall.Kill(cmd.Process.Pid, 0); err != nil {
+		t.Errorf("KillDescendants() killed the excluded shell. Error: %s", err.Error())
+	}
+}
+
+func TestCmdline(t *testing.T) {
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start %v. Error: %s", cmd.Args, err.Error())
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	got, err := Cmdline(cmd.Process.Pid)
+	if err != nil {
+		t.Fatalf("Cmdline() error = %v", err)
+	}
+	if got != "sleep 60" {
+		t.Errorf("Cmdline() = %q, want %q", got, "sleep 60")
+	}
+}
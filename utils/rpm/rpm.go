@@ -67,6 +67,30 @@ func Install(rpmPath string) error {
 	return nil
 }
 
+// Extract extracts the contents of the specified RPM file into the specified
+// 	directory without installing it.
+func Extract(rpmPath, destDir string) error {
+	log.Printf("Entering rpm::Extract(%s, %s)", rpmPath, destDir)
+	defer log.Println("Exiting rpm::Extract")
+
+	absRPMPath, err := filepath.Abs(filepath.FromSlash(rpmPath))
+	if err != nil {
+		log.Printf("filepath.Abs(%s); Error: %s", rpmPath, err.Error())
+		return err
+	}
+	cmdParams := []string{"-c", `rpm2cpio "$0" | cpio -idm --quiet`, absRPMPath}
+	cmd := exec.Command("/bin/sh", cmdParams...)
+	cmd.Dir = destDir
+	stdOutErr, err := cmd.CombinedOutput()
+	log.Println("Stdout & Stderr:", string(stdOutErr))
+	if err != nil {
+		log.Printf("Failed to extract %s RPM. Error: %s\n",
+			rpmPath, err.Error())
+		return err
+	}
+	return nil
+}
+
 // ParseMetaData parses the RPM metadata
 // 	into key-value pair.
 func ParseMetaData(metaData string) map[string]string {
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	logutil "github.com/VeritasOS/plugin-manager/utils/log"
 	"github.com/VeritasOS/software-update-manager/repo"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
 	"github.com/VeritasOS/software-update-manager/validate/version"
 	"log"
 	"os"
@@ -17,6 +18,39 @@ import (
 
 var execCommand = exec.Command
 
+// SignatureError is returned when the software file is not signed, or its
+// 	signature is invalid.
+type SignatureError struct {
+	File    string
+	Message string
+}
+
+func (e *SignatureError) Error() string {
+	return e.Message
+}
+
+// ErrorCode returns the class of the failure.
+func (e *SignatureError) ErrorCode() errcode.Code {
+	return errcode.SignatureInvalid
+}
+
+// CompatibilityError is returned when the software file is not compatible
+// 	with the product version.
+type CompatibilityError struct {
+	File           string
+	ProductVersion string
+}
+
+func (e *CompatibilityError) Error() string {
+	return fmt.Sprintf("The %s software file is not compatibile for %s version.",
+		filepath.Base(e.File), e.ProductVersion)
+}
+
+// ErrorCode returns the class of the failure.
+func (e *CompatibilityError) ErrorCode() errcode.Code {
+	return errcode.NotCompatible
+}
+
 func isRPMCompatibile(productVersion string, rpmFile string) error {
 	log.Printf("Entering validate::isRPMCompatibile(%s, %s)...",
 		productVersion, rpmFile)
@@ -34,8 +68,9 @@ func isRPMCompatibile(productVersion string, rpmFile string) error {
 
 	curInfo := info[0]
 	if !version.Compare(productVersion, curInfo.GetMatchedVersion()) {
-		return logutil.PrintNLogError("The %s software file is not compatibile for %s version.",
-			filepath.Base(rpmFile), productVersion)
+		err = &CompatibilityError{File: rpmFile, ProductVersion: productVersion}
+		logutil.PrintNLogError("%s", err.Error())
+		return err
 	}
 	return nil
 }
@@ -52,9 +87,10 @@ func isSigned(rpmFile string) error {
 
 	rpmSign := strings.TrimSpace(string(out))
 	if strings.Contains(rpmSign, "(none)") {
-		return logutil.PrintNLogError("RPM file %s is not signed. Only "+
+		err = logutil.PrintNLogError("RPM file %s is not signed. Only "+
 			"install updates that have been downloaded from or provided by Veritas",
 			rpmFile)
+		return &SignatureError{File: rpmFile, Message: err.Error()}
 	}
 
 	return nil
@@ -71,7 +107,7 @@ func verifySign(rpmFile string) error {
 			"Only install updates that have been downloaded from or provided by "+
 			"Veritas. Error %v",
 			rpmFile, err.Error())
-		return err
+		return &SignatureError{File: rpmFile, Message: err.Error()}
 	}
 	return nil
 }
@@ -96,8 +132,8 @@ func validateSignature(rpmFile string) error {
 func fileExists(filePath string) error {
 	_, err := os.Stat(filePath)
 	if os.IsNotExist(err) {
-		err := fmt.Errorf(filePath + " file does not exist")
-		return err
+		return &errcode.Error{Code: errcode.SoftwareNotFound,
+			Message: filePath + " file does not exist"}
 	}
 	return nil
 }
@@ -116,27 +152,27 @@ func Exec(args []string) {
 	if *versionFlag {
 		if *productVersion == "" || *rpmFile == "" {
 			flag.PrintDefaults()
-			os.Exit(1)
+			os.Exit(errcode.ExitStatus(errcode.InvalidUsage))
 		}
 		err := isRPMCompatibile(*productVersion, *rpmFile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%v\n", err.Error())
-			os.Exit(1)
+			os.Exit(errcode.ExitStatus(errcode.Of(err)))
 		}
 	}
 	if *signFlag {
 		if *rpmFile == "" {
 			flag.PrintDefaults()
-			os.Exit(1)
+			os.Exit(errcode.ExitStatus(errcode.InvalidUsage))
 		}
 		err := validateSignature(*rpmFile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%v\n", err.Error())
-			os.Exit(1)
+			os.Exit(errcode.ExitStatus(errcode.Of(err)))
 		}
 	}
 	if !*signFlag && !*versionFlag {
 		flag.PrintDefaults()
-		os.Exit(1)
+		os.Exit(errcode.ExitStatus(errcode.InvalidUsage))
 	}
 }
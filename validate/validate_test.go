@@ -4,6 +4,7 @@ package validate
 
 import (
 	"fmt"
+	"github.com/VeritasOS/software-update-manager/utils/errcode"
 	"os"
 	"os/exec"
 	"strconv"
@@ -77,6 +78,9 @@ func Test_verifySign(t *testing.T) {
 			if (err != nil) && (tt.wantErr) && (err.Error() != tt.args.errorMsg) {
 				t.Errorf("expected: <%v>, but got <%v>", tt.args.errorMsg, err.Error())
 			}
+			if tt.wantErr && errcode.Of(err) != errcode.SignatureInvalid {
+				t.Errorf("error code = %v, want %v", errcode.Of(err), errcode.SignatureInvalid)
+			}
 		})
 	}
 }